@@ -11,12 +11,16 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/ardanlabs/conf"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/rakshans1/service/internal/platform/auth"
 	"github.com/rakshans1/service/internal/platform/database"
+	"github.com/rakshans1/service/internal/product"
 	"github.com/rakshans1/service/internal/user"
 )
 
@@ -70,6 +74,8 @@ func run() error {
 		err = useradd(dbConfig, cfg.Args.Num(1), cfg.Args.Num(2))
 	case "keygen":
 		err = keygen(cfg.Args.Num(1))
+	case "import-products":
+		err = importProducts(dbConfig, cfg.Args.Num(1), cfg.Args.Num(2), cfg.Args.Num(3) == "dry-run")
 	default:
 		err = errors.New("Must specify a command")
 	}
@@ -114,7 +120,7 @@ func useradd(cfg database.Config, email, password string) error {
 		Roles:           []string{auth.RoleAdmin, auth.RoleUser},
 	}
 
-	u, err := user.Create(ctx, db, nu, time.Now())
+	u, err := user.NewPostgres(db).Create(ctx, nu, time.Now())
 	if err != nil {
 		return err
 	}
@@ -123,6 +129,61 @@ func useradd(cfg database.Config, email, password string) error {
 	return nil
 }
 
+// importProducts creates the products listed in a CSV or JSON file, owned by
+// the user with the given id. The file format is chosen by its extension. With
+// dryRun the rows are only validated.
+func importProducts(cfg database.Config, path, ownerID string, dryRun bool) error {
+	if path == "" || ownerID == "" {
+		return errors.New("import-products command must be called with a file path and an owner user id")
+	}
+	if _, err := uuid.Parse(ownerID); err != nil {
+		return errors.Wrap(err, "parsing owner user id")
+	}
+
+	read := product.ReadJSON
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		read = product.ReadCSV
+	case ".json":
+	default:
+		return errors.New("import file must have a .csv or .json extension")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening import file")
+	}
+	defer file.Close()
+
+	rows, err := read(file)
+	if err != nil {
+		return errors.Wrap(err, "reading import file")
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	now := time.Now()
+	owner := auth.NewClaims(ownerID, []string{auth.RoleAdmin, auth.RoleUser}, now, time.Hour)
+
+	// Imports never touch attachments so the store needs no blob store.
+	report, err := product.NewPostgres(db, nil).Import(context.Background(), owner, rows, dryRun, now)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		for _, fe := range row.Errors {
+			fmt.Printf("row %d: %s: %s\n", row.Row, fe.Field, fe.Error)
+		}
+	}
+	fmt.Printf("%d rows, %d valid, %d created\n", report.Total, report.Valid, report.Created)
+	return nil
+}
+
 // keygen creates an x509 private key for signing auth tokens.
 func keygen(path string) error {
 	if path == "" {
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// UploadImage attaches an image to a product. The image is sent as the "file"
+// part of a multipart form. The new attachment, with its download and
+// thumbnail URLs, is returned to the caller.
+func (p *Products) UploadImage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.uploadimage")
+	defer span.End()
+
+	return p.upload(ctx, w, r, product.AttachmentImage)
+}
+
+// UploadDocument attaches a document, such as a PDF manual, to a product. The
+// document is sent as the "file" part of a multipart form.
+func (p *Products) UploadDocument(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.uploaddocument")
+	defer span.End()
+
+	return p.upload(ctx, w, r, product.AttachmentDocument)
+}
+
+// upload reads the file part of a multipart upload and attaches it to the
+// product identified in the request URL as the given kind of attachment.
+func (p *Products) upload(ctx context.Context, w http.ResponseWriter, r *http.Request, kind string) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	id := web.Param(r, "id")
+
+	// Leave room for the multipart framing around the largest allowed file.
+	r.Body = http.MaxBytesReader(w, r.Body, product.MaxAttachmentSize+1<<20)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return web.NewRequestError(errors.Wrap(err, "reading multipart form"), http.StatusBadRequest)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return web.NewRequestError(errors.New("file is required"), http.StatusBadRequest)
+		}
+		if err != nil {
+			return web.NewRequestError(errors.Wrap(err, "reading multipart form"), http.StatusBadRequest)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		a, err := p.products.AddAttachment(ctx, claims, id, kind, part.FileName(), part, time.Now())
+		if err != nil {
+			switch err {
+			case product.ErrNotFound:
+				return web.NewRequestError(err, http.StatusNotFound)
+			case product.ErrInvalidID, product.ErrInvalidImage:
+				return web.NewRequestError(err, http.StatusBadRequest)
+			case product.ErrFileTooLarge:
+				return web.NewRequestError(err, http.StatusRequestEntityTooLarge)
+			case product.ErrUnsupportedType:
+				return web.NewRequestError(err, http.StatusUnsupportedMediaType)
+			default:
+				return errors.Wrapf(err, "attaching %s to product %q", kind, id)
+			}
+		}
+
+		return web.Respond(ctx, w, a, http.StatusCreated)
+	}
+}
+
+// DownloadAttachment sends the file of an attachment of a product.
+func (p *Products) DownloadAttachment(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.downloadattachment")
+	defer span.End()
+
+	return p.download(ctx, w, r, false)
+}
+
+// DownloadThumbnail sends the thumbnail of an image attached to a product.
+func (p *Products) DownloadThumbnail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.downloadthumbnail")
+	defer span.End()
+
+	return p.download(ctx, w, r, true)
+}
+
+// download streams the file, or thumbnail, of the attachment identified in the
+// request URL.
+func (p *Products) download(ctx context.Context, w http.ResponseWriter, r *http.Request, thumb bool) error {
+	productID := web.Param(r, "id")
+	attachmentID := web.Param(r, "attachment_id")
+
+	a, rc, err := p.products.OpenAttachment(ctx, productID, attachmentID, thumb)
+	if err != nil {
+		switch err {
+		case product.ErrAttachmentNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "opening attachment %q", attachmentID)
+		}
+	}
+	defer rc.Close()
+
+	contentType := a.ContentType
+	disposition := "attachment"
+	if a.Kind == product.AttachmentImage {
+		disposition = "inline"
+	}
+	if thumb {
+		contentType = "image/png"
+	} else {
+		w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if err := web.RespondStream(ctx, w, contentType, http.StatusOK); err != nil {
+		return err
+	}
+
+	// The status is sent so a failure now can only cut the download short.
+	_, err = io.Copy(w, rc)
+	return err
+}
+
+// DeleteAttachment removes an attachment from a product.
+func (p *Products) DeleteAttachment(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.deleteattachment")
+	defer span.End()
+
+	productID := web.Param(r, "id")
+	attachmentID := web.Param(r, "attachment_id")
+
+	if err := p.products.DeleteAttachment(ctx, productID, attachmentID); err != nil {
+		switch err {
+		case product.ErrAttachmentNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "deleting attachment %q", attachmentID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// batchItem is the outcome of one item of a batch as sent to the client.
+// Status is what a single request for the item would have been answered with.
+type batchItem struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchReport summarizes a batch. Applied counts the items that were saved.
+type batchReport struct {
+	Mode    string      `json:"mode"`
+	Applied int         `json:"applied"`
+	Items   []batchItem `json:"items"`
+}
+
+// BatchUpdate applies a list of product updates in one transaction. Each item
+// names a product and the fields to change, with an optional version. The
+// response reports the outcome of every item with the status code a single
+// update would have given it.
+func (p *Products) BatchUpdate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.batchupdate")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var bu product.BatchUpdate
+	if err := web.Decode(r, &bu); err != nil {
+		return errors.Wrap(err, "decoding batch update")
+	}
+
+	results, err := p.products.UpdateBatch(ctx, claims, bu, time.Now())
+	if err != nil {
+		if err == product.ErrNeedsDatabase {
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		}
+		return errors.Wrap(err, "updating products in batch")
+	}
+
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
+	return web.Respond(ctx, w, newBatchReport(bu.Mode, results), http.StatusOK)
+}
+
+// BatchDelete moves a list of products to the trash in one transaction. The
+// response reports the outcome of every product.
+func (p *Products) BatchDelete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.batchdelete")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var bd product.BatchDelete
+	if err := web.Decode(r, &bd); err != nil {
+		return errors.Wrap(err, "decoding batch delete")
+	}
+
+	results, err := p.products.DeleteBatch(ctx, claims, bd, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "deleting products in batch")
+	}
+
+	return web.Respond(ctx, w, newBatchReport(bd.Mode, results), http.StatusOK)
+}
+
+// newBatchReport builds the report of a batch from its results. Items that
+// were held back by the failure of another are answered with 424 Failed
+// Dependency.
+func newBatchReport(mode string, results []product.BatchResult) batchReport {
+	if mode == "" {
+		mode = product.BatchAtomic
+	}
+
+	report := batchReport{
+		Mode:  mode,
+		Items: make([]batchItem, len(results)),
+	}
+	for i, res := range results {
+		item := batchItem{ID: res.ID, Status: http.StatusNoContent}
+		switch {
+		case res.Err == nil:
+			report.Applied++
+		case res.Err == product.ErrBatchAborted:
+			item.Status = http.StatusFailedDependency
+			item.Error = res.Err.Error()
+		default:
+			item.Status = http.StatusInternalServerError
+			if werr, ok := updateError(res.Err).(*web.Error); ok {
+				item.Status = werr.Status
+			}
+			item.Error = res.Err.Error()
+		}
+		report.Items[i] = item
+	}
+
+	return report
+}
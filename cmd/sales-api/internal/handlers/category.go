@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/category"
+	"github.com/rakshans1/service/internal/platform/web"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Categories holds handlers for dealing with product categories.
+type Categories struct {
+	db *sqlx.DB
+}
+
+// List gets all existing categories from the db and encodes them in a
+// response client.
+func (c *Categories) List(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.categories.list")
+	defer span.End()
+
+	list, err := category.List(ctx, c.db)
+	if err != nil {
+		return errors.Wrap(err, "getting category list")
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// Create decodes the body of a request to create a new category. The full
+// category with generated fields is sent back in the response.
+func (c *Categories) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.categories.create")
+	defer span.End()
+
+	var nc category.NewCategory
+	if err := web.Decode(r, &nc); err != nil {
+		return errors.Wrap(err, "decoding new category")
+	}
+
+	cat, err := category.Create(ctx, c.db, nc, time.Now())
+	if err != nil {
+		switch err {
+		case category.ErrInvalidID, category.ErrParentNotFound:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "creating new category")
+		}
+	}
+
+	return web.Respond(ctx, w, cat, http.StatusCreated)
+}
+
+// Retrieve finds a single category identified by an ID in the request URL.
+func (c *Categories) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.categories.get")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	cat, err := category.Get(ctx, c.db, id)
+	if err != nil {
+		switch err {
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting category %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, cat, http.StatusOK)
+}
+
+// Update decodes the body of a request to update an existing category. The ID
+// of the category is part of the request URL.
+func (c *Categories) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.categories.update")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	var uc category.UpdateCategory
+	if err := web.Decode(r, &uc); err != nil {
+		return errors.Wrap(err, "decoding category update")
+	}
+
+	if err := category.Update(ctx, c.db, id, uc, time.Now()); err != nil {
+		switch err {
+		case category.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case category.ErrInvalidID, category.ErrParentNotFound, category.ErrCycle:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "updating category %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Delete removes a single category identified by an ID in the request URL.
+// Products in it are left uncategorized.
+func (c *Categories) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.categories.delete")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	if err := category.Delete(ctx, c.db, id); err != nil {
+		switch err {
+		case category.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case category.ErrHasChildren:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "deleting category %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
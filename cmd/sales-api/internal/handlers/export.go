@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// These are the formats the export endpoints can produce.
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// flushEvery is how many rows are written between flushes to the client.
+const flushEvery = 100
+
+// ExportProducts streams every product as CSV or newline delimited JSON.
+func (p *Products) ExportProducts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.exportproducts")
+	defer span.End()
+
+	format, err := exportFormat(r)
+	if err != nil {
+		return err
+	}
+
+	header := []string{"id", "name", "description", "cost", "currency", "quantity", "sold", "revenue", "user_id", "category_id", "tags", "version", "date_created", "date_updated"}
+	ew := newExportWriter(ctx, w, format, header)
+
+	err = p.products.ExportProducts(ctx, func(prod product.Product) error {
+		return ew.write(prod, func() []string {
+			var categoryID string
+			if prod.CategoryID != nil {
+				categoryID = *prod.CategoryID
+			}
+			return []string{
+				prod.ID, prod.Name, prod.Description,
+				strconv.Itoa(prod.Cost.Amount), prod.Cost.Currency, strconv.Itoa(prod.Quantity),
+				strconv.Itoa(prod.Sold), prod.Revenue.String(),
+				prod.UserID, categoryID, strings.Join(prod.Tags, ";"),
+				strconv.Itoa(prod.Version),
+				prod.DateCreated.Format(time.RFC3339Nano), prod.DateUpdated.Format(time.RFC3339Nano),
+			}
+		})
+	})
+	if err == nil {
+		err = ew.finish()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "exporting products")
+		if !ew.started {
+			return err
+		}
+		abortStream(ctx, p.log, err)
+	}
+
+	return nil
+}
+
+// ExportSales streams sales as CSV or newline delimited JSON. The query string
+// may limit them to those made between from and to (RFC 3339).
+func (p *Products) ExportSales(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.exportsales")
+	defer span.End()
+
+	format, err := exportFormat(r)
+	if err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	from, err := optionalTime(q, "from")
+	if err != nil {
+		return err
+	}
+	to, err := optionalTime(q, "to")
+	if err != nil {
+		return err
+	}
+
+	header := []string{"id", "product_id", "variant_id", "quantity", "paid", "currency", "user_id", "order_id", "promotion_id", "discount", "expected", "date_created"}
+	ew := newExportWriter(ctx, w, format, header)
+
+	err = p.products.ExportSales(ctx, from, to, func(s product.Sale) error {
+		return ew.write(s, func() []string {
+			var variantID, userID, orderID, promotionID, expected string
+			if s.VariantID != nil {
+				variantID = *s.VariantID
+			}
+			if s.UserID != nil {
+				userID = *s.UserID
+			}
+			if s.OrderID != nil {
+				orderID = *s.OrderID
+			}
+			if s.PromotionID != nil {
+				promotionID = *s.PromotionID
+			}
+			if s.Expected != nil {
+				expected = strconv.Itoa(*s.Expected)
+			}
+			return []string{
+				s.ID, s.ProductID, variantID,
+				strconv.Itoa(s.Quantity), strconv.Itoa(s.Paid.Amount), s.Paid.Currency, userID, orderID,
+				promotionID, strconv.Itoa(s.Discount), expected,
+				s.DateCreated.Format(time.RFC3339Nano),
+			}
+		})
+	})
+	if err == nil {
+		err = ew.finish()
+	}
+	if err != nil {
+		err = errors.Wrap(err, "exporting sales")
+		if !ew.started {
+			return err
+		}
+		abortStream(ctx, p.log, err)
+	}
+
+	return nil
+}
+
+// exportFormat picks the export format from the format query parameter or,
+// failing that, the Accept header. NDJSON is the default. An unknown format
+// is a bad request while an Accept header listing none of the formats is not
+// acceptable.
+func exportFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case formatCSV, formatNDJSON:
+		return f, nil
+	case "":
+	default:
+		return "", web.NewRequestError(errors.Errorf("format %q is not supported", f), http.StatusBadRequest)
+	}
+
+	switch accepted(r, "application/x-ndjson", "application/json", "text/csv") {
+	case "text/csv":
+		return formatCSV, nil
+	case "":
+		return "", web.NewRequestError(errors.New("export is available as text/csv or application/x-ndjson"), http.StatusNotAcceptable)
+	}
+
+	return formatNDJSON, nil
+}
+
+// accepted gives the first media type in the Accept header of r that is one
+// of offers, or "" when none is. A missing header or one listing */* accepts
+// the first offer. Quality values are not weighed; clients list what they
+// prefer first.
+func accepted(r *http.Request, offers ...string) string {
+	h := r.Header.Get("Accept")
+	if strings.TrimSpace(h) == "" {
+		return offers[0]
+	}
+
+	for _, part := range strings.Split(h, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mt == "*/*" {
+			return offers[0]
+		}
+		for _, offer := range offers {
+			if mt == offer {
+				return offer
+			}
+		}
+	}
+	return ""
+}
+
+// abortStream gives up on a response whose status and part of whose body have
+// already been sent. Returning err would have Errors append an error to the
+// body, which a client could take for the end of a complete file, so it is
+// logged and the connection dropped instead.
+func abortStream(ctx context.Context, log *log.Logger, err error) {
+	var traceID string
+	if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok {
+		traceID = v.TraceID
+	}
+	log.Printf("%s : ERROR : aborting response : %+v", traceID, err)
+
+	panic(http.ErrAbortHandler)
+}
+
+// exportWriter writes rows of an export to the client as they are produced.
+// The response is only started with the first row, so a store that fails
+// before producing one can still be answered with an error. Once started is
+// set the status has gone out and a failure can only cut the export short.
+type exportWriter struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	format  string
+	header  []string
+	csv     *csv.Writer
+	json    *json.Encoder
+	rows    int
+	started bool
+}
+
+// newExportWriter prepares the response for an export. CSV exports begin
+// with the header record.
+func newExportWriter(ctx context.Context, w http.ResponseWriter, format string, header []string) *exportWriter {
+	return &exportWriter{ctx: ctx, w: w, format: format, header: header}
+}
+
+// start sends the status and the CSV header record.
+func (ew *exportWriter) start() error {
+	ew.started = true
+
+	switch ew.format {
+	case formatCSV:
+		if err := web.RespondStream(ew.ctx, ew.w, "text/csv; charset=utf-8", http.StatusOK); err != nil {
+			return err
+		}
+		ew.csv = csv.NewWriter(ew.w)
+		return ew.csv.Write(ew.header)
+	default:
+		if err := web.RespondStream(ew.ctx, ew.w, "application/x-ndjson", http.StatusOK); err != nil {
+			return err
+		}
+		ew.json = json.NewEncoder(ew.w)
+	}
+	return nil
+}
+
+// write adds one row to the export. record is only called for CSV.
+func (ew *exportWriter) write(v interface{}, record func() []string) error {
+	if !ew.started {
+		if err := ew.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if ew.format == formatCSV {
+		err = ew.csv.Write(record())
+	} else {
+		err = ew.json.Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	ew.rows++
+	if ew.rows%flushEvery == 0 {
+		return ew.flush()
+	}
+	return nil
+}
+
+// finish completes the export, starting it first if there were no rows.
+func (ew *exportWriter) finish() error {
+	if !ew.started {
+		if err := ew.start(); err != nil {
+			return err
+		}
+	}
+	return ew.flush()
+}
+
+// flush sends any buffered rows to the client.
+func (ew *exportWriter) flush() error {
+	if ew.csv != nil {
+		ew.csv.Flush()
+		if err := ew.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if f, ok := ew.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/web"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Invoices holds handlers for issuing and reading invoices. Seller is printed
+// on every invoice issued.
+type Invoices struct {
+	db     *sqlx.DB
+	seller invoice.Seller
+}
+
+// Create decodes the body of a request to invoice a sale or an order. The
+// issued invoice is sent back in the response.
+func (i *Invoices) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.invoices.create")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ni invoice.NewInvoice
+	if err := web.Decode(r, &ni); err != nil {
+		return errors.Wrap(err, "decoding new invoice")
+	}
+
+	inv, err := invoice.Create(ctx, i.db, claims, ni, i.seller, time.Now())
+	if err != nil {
+		switch err {
+		case invoice.ErrInvalidID, invoice.ErrInvalidSource, invoice.ErrPartOfOrder:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case invoice.ErrSourceNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case invoice.ErrAlreadyInvoiced:
+			return web.NewRequestError(err, http.StatusConflict)
+		case invoice.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrap(err, "creating new invoice")
+		}
+	}
+
+	return web.Respond(ctx, w, inv, http.StatusCreated)
+}
+
+// Retrieve finds a single invoice identified by an ID in the request URL. It
+// is sent as JSON, an HTML page or plain text, whichever the Accept header
+// lists first, and as JSON when it lists none of them. Only admins may see the
+// invoices of other users.
+func (i *Invoices) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.invoices.get")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	id := web.Param(r, "id")
+
+	inv, err := invoice.Get(ctx, i.db, claims, id)
+	if err != nil {
+		switch err {
+		case invoice.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case invoice.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case invoice.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "getting invoice %q", id)
+		}
+	}
+
+	// The invoice is rendered in full before anything is sent so a template
+	// failure can still be answered with an error.
+	var (
+		buf         bytes.Buffer
+		contentType string
+	)
+	switch accepted(r, "application/json", "text/html", "text/plain") {
+	case "text/html":
+		contentType = "text/html; charset=utf-8"
+		err = invoice.RenderHTML(&buf, inv)
+	case "text/plain":
+		contentType = "text/plain; charset=utf-8"
+		err = invoice.RenderText(&buf, inv)
+	default:
+		return web.Respond(ctx, w, inv, http.StatusOK)
+	}
+	if err != nil {
+		return errors.Wrap(err, "rendering invoice")
+	}
+
+	if err := web.RespondStream(ctx, w, contentType, http.StatusOK); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
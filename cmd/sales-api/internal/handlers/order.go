@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Orders holds handlers for checking out several products at once.
+type Orders struct {
+	products product.Store
+	log      *log.Logger
+	notifier notify.Notifier
+}
+
+// Create decodes the body of a request to place an order. Every line is sold
+// or none is: an unknown product is answered with 400 Bad Request and a line
+// asking for more units than are in stock with 409 Conflict.
+func (o *Orders) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.orders.create")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var no product.NewOrder
+	if err := web.Decode(r, &no); err != nil {
+		return errors.Wrap(err, "decoding new order")
+	}
+
+	order, err := o.products.CreateOrder(ctx, claims, no, time.Now())
+	if err != nil {
+		if _, ok := errors.Cause(err).(*product.InsufficientStockError); ok {
+			return web.NewRequestError(err, http.StatusConflict)
+		}
+		if rerr := redemptionError(err); rerr != nil {
+			return rerr
+		}
+		switch err {
+		case product.ErrNotFound, product.ErrInvalidID, product.ErrVariantNotFound, product.ErrVariantRequired:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNeedsDatabase:
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		default:
+			return errors.Wrap(err, "creating new order")
+		}
+	}
+
+	deliverAlerts(ctx, o.products, o.log, o.notifier)
+
+	return web.Respond(ctx, w, order, http.StatusCreated)
+}
+
+// Retrieve finds a single order identified by an ID in the request URL. Only
+// admins may see the orders of other users.
+func (o *Orders) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.orders.get")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	id := web.Param(r, "id")
+
+	order, err := o.products.GetOrder(ctx, claims, id)
+	if err != nil {
+		switch err {
+		case product.ErrOrderNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "getting order %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, order, http.StatusOK)
+}
@@ -3,12 +3,16 @@ package handlers
 import (
 	"context"
 	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/platform/notify"
 	"github.com/rakshans1/service/internal/platform/web"
 	"github.com/rakshans1/service/internal/product"
 	"go.opentelemetry.io/otel/api/global"
@@ -17,22 +21,39 @@ import (
 // Products defines all of the handlers related to products. It holds the
 // application state needed by the handler methods.
 type Products struct {
-	db  *sqlx.DB
-	log *log.Logger
+	products product.Store
+	log      *log.Logger
+	notifier notify.Notifier
 }
 
-// List gets all products from the service layer and encodes them for the
-// client response.
+// List gets a page of products from the service layer and encodes them for
+// the client response. The query string may narrow the listing with name,
+// min_cost, max_cost, currency, user_id, in_stock, category_id, sku (a prefix
+// of a variant SKU) and any number of tag parameters, order it with sort
+// (prefix the key with "-" for descending) and page through it with limit and
+// cursor.
 func (p *Products) List(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := global.Tracer("service").Start(ctx, "handlers.product.list")
 	defer span.End()
 
-	list, err := product.List(ctx, p.db)
+	f, err := parseListFilter(r)
 	if err != nil {
-		return errors.Wrap(err, "getting product list")
+		return err
 	}
 
-	return web.Respond(ctx, w, list, http.StatusOK)
+	page, err := p.products.List(ctx, f)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidID, product.ErrInvalidSort, product.ErrInvalidCursor:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNeedsDatabase:
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		default:
+			return errors.Wrap(err, "getting product list")
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
 }
 
 // Create decode the body of a request to create a new product. The full
@@ -52,9 +73,16 @@ func (p *Products) Create(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return errors.Wrap(err, "decoding new product")
 	}
 
-	prod, err := product.Create(ctx, p.db, claims, np, time.Now())
+	prod, err := p.products.Create(ctx, claims, np, time.Now())
 	if err != nil {
-		return errors.Wrap(err, "creating new product")
+		switch err {
+		case product.ErrCategoryNotFound:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNeedsDatabase:
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		default:
+			return errors.Wrap(err, "creating new product")
+		}
 	}
 
 	return web.Respond(ctx, w, &prod, http.StatusCreated)
@@ -67,7 +95,7 @@ func (p *Products) Retrive(ctx context.Context, w http.ResponseWriter, r *http.R
 
 	id := web.Param(r, "id")
 
-	prod, err := product.Get(ctx, p.db, id)
+	prod, err := p.products.Get(ctx, id)
 	if err != nil {
 		switch err {
 		case product.ErrNotFound:
@@ -81,17 +109,25 @@ func (p *Products) Retrive(ctx context.Context, w http.ResponseWriter, r *http.R
 		}
 	}
 
+	w.Header().Set("ETag", etag(prod.Version))
+
 	return web.Respond(ctx, w, prod, http.StatusOK)
 }
 
 // Update decodes the body of a request to update an existing product. The ID
-// of the product is part of the request URL.
+// of the product is part of the request URL. When the request carries an
+// If-Match header the update only applies to the version it names.
 func (p *Products) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.update")
 	defer span.End()
 
 	id := web.Param(r, "id")
 
+	version, err := ifMatch(r)
+	if err != nil {
+		return err
+	}
+
 	var update product.UpdateProduct
 	if err := web.Decode(r, &update); err != nil {
 		return errors.Wrap(err, "decoding product update")
@@ -102,33 +138,165 @@ func (p *Products) Update(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return errors.New("claims missing from context")
 	}
 
-	if err := product.Update(ctx, p.db, claims, id, update, time.Now()); err != nil {
+	if err := p.products.Update(ctx, claims, id, update, version, time.Now()); err != nil {
+		if uerr := updateError(err); uerr != nil {
+			return uerr
+		}
+		return errors.Wrapf(err, "updating product %q", id)
+	}
+
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
+	// An update moves the product on by exactly one version. Without a
+	// condition the version it started from is not known so no tag is sent.
+	if version != 0 {
+		w.Header().Set("ETag", etag(version+1))
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// updateError translates the expected errors of changing a product into
+// request errors. It returns nil for any other error.
+func updateError(err error) error {
+	switch err {
+	case product.ErrNotFound:
+		return web.NewRequestError(err, http.StatusNotFound)
+	case product.ErrInvalidID, product.ErrCategoryNotFound:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case product.ErrNeedsDatabase:
+		return web.NewRequestError(err, http.StatusServiceUnavailable)
+	case product.ErrForbidden:
+		return web.NewRequestError(err, http.StatusForbidden)
+	case product.ErrVersionConflict:
+		return web.NewRequestError(err, http.StatusPreconditionFailed)
+	case product.ErrHasVariants:
+		return web.NewRequestError(err, http.StatusConflict)
+	}
+	return nil
+}
+
+// Delete moves a single product identified by an ID in the request URL to the
+// trash.
+func (p *Products) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.delete")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	id := web.Param(r, "id")
+
+	if err := p.products.Delete(ctx, claims, id, time.Now()); err != nil {
+		switch err {
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "deleting product %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Search gets a page of products matching the full-text query in q, best
+// matches first. It pages with limit and cursor the same way as List.
+func (p *Products) Search(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.search")
+	defer span.End()
+
+	q := r.URL.Query()
+
+	sq := product.SearchQuery{
+		Text:   q.Get("q"),
+		Cursor: q.Get("cursor"),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return web.NewRequestError(errors.New("limit must be a positive integer"), http.StatusBadRequest)
+		}
+		sq.Limit = n
+	}
+
+	page, err := p.products.Search(ctx, sq)
+	if err != nil {
+		switch err {
+		case product.ErrEmptySearch, product.ErrInvalidCursor:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "searching products")
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// Trash gets a page of deleted products. It accepts the same query string as
+// List.
+func (p *Products) Trash(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.trash")
+	defer span.End()
+
+	f, err := parseListFilter(r)
+	if err != nil {
+		return err
+	}
+	f.Deleted = true
+
+	page, err := p.products.List(ctx, f)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidID, product.ErrInvalidSort, product.ErrInvalidCursor:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting product trash")
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// Restore takes a single product identified by an ID in the request URL out of
+// the trash.
+func (p *Products) Restore(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.restore")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	if err := p.products.Restore(ctx, id, time.Now()); err != nil {
 		switch err {
 		case product.ErrNotFound:
 			return web.NewRequestError(err, http.StatusNotFound)
 		case product.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
 		default:
-			return errors.Wrapf(err, "updating product %q", id)
+			return errors.Wrapf(err, "restoring product %q", id)
 		}
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
-// Delete removes a single product identified by an ID in the request URL.
-func (p *Products) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.delete")
+// Purge permanently removes a single trashed product identified by an ID in
+// the request URL, along with its sales and attachments.
+func (p *Products) Purge(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.purge")
 	defer span.End()
 
 	id := web.Param(r, "id")
 
-	if err := product.Delete(r.Context(), p.db, id); err != nil {
+	if err := p.products.Purge(ctx, id); err != nil {
 		switch err {
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
 		case product.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
 		default:
-			return errors.Wrapf(err, "deleting product %q", id)
+			return errors.Wrapf(err, "purging product %q", id)
 		}
 	}
 
@@ -136,11 +304,18 @@ func (p *Products) Delete(ctx context.Context, w http.ResponseWriter, r *http.Re
 }
 
 // AddSale creates a new Sale for a particular product. It looks for a JSON
-// object in the request body. The full model is returned to the caller.
+// object in the request body. The full model is returned to the caller. A sale
+// of more units than are in stock is answered with 409 Conflict, as is one
+// with a promotion code that is used up or not active.
 func (p *Products) AddSale(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.addsale")
 	defer span.End()
 
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
 	var ns product.NewSale
 	if err := web.Decode(r, &ns); err != nil {
 		return errors.Wrap(err, "decoding new sale")
@@ -148,25 +323,425 @@ func (p *Products) AddSale(ctx context.Context, w http.ResponseWriter, r *http.R
 
 	productID := web.Param(r, "id")
 
-	sale, err := product.AddSale(ctx, p.db, ns, productID, time.Now())
+	sale, err := p.products.AddSale(ctx, claims, ns, productID, time.Now())
 	if err != nil {
-		return errors.Wrap(err, "adding new sale")
+		if _, ok := errors.Cause(err).(*product.InsufficientStockError); ok {
+			return web.NewRequestError(err, http.StatusConflict)
+		}
+		if rerr := redemptionError(err); rerr != nil {
+			return rerr
+		}
+		switch err {
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrVariantNotFound, product.ErrVariantRequired:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNeedsDatabase:
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		default:
+			return errors.Wrapf(err, "adding new sale for product %q", productID)
+		}
 	}
 
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
 	return web.Respond(ctx, w, sale, http.StatusCreated)
 }
 
-// ListSales gets all sales for a particular product.
+// ListSales gets a page of the sales for a particular product, oldest first.
+// The query string may limit them to those made between from and to (RFC
+// 3339) and pages through them with limit and cursor.
 func (p *Products) ListSales(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.listsales")
 	defer span.End()
 
 	id := web.Param(r, "id")
 
-	list, err := product.ListSales(ctx, p.db, id)
+	q := r.URL.Query()
+
+	f := product.SalesFilter{
+		Cursor: q.Get("cursor"),
+	}
+
+	var err error
+	if f.From, err = optionalTime(q, "from"); err != nil {
+		return err
+	}
+	if f.To, err = optionalTime(q, "to"); err != nil {
+		return err
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return web.NewRequestError(errors.New("limit must be a positive integer"), http.StatusBadRequest)
+		}
+		f.Limit = n
+	}
+
+	page, err := p.products.ListSales(ctx, id, f)
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidCursor:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting sales list for product %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// SalesByUser gets all sales made by the user identified by an ID in the
+// request URL. Only admins may see the sales of other users.
+func (p *Products) SalesByUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.salesbyuser")
+	defer span.End()
+
+	return p.userSales(ctx, w, web.Param(r, "id"))
+}
+
+// MySales gets all sales made by the authenticated user.
+func (p *Products) MySales(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.mysales")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	return p.userSales(ctx, w, claims.Subject)
+}
+
+// userSales responds with the sales made by a user on behalf of the
+// authenticated caller.
+func (p *Products) userSales(ctx context.Context, w http.ResponseWriter, userID string) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	list, err := p.products.ListSalesByUser(ctx, claims, userID)
+	if err != nil {
+		switch err {
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "getting sales list for user %q", userID)
+		}
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// History gets the recorded changes to a product, oldest first. The field
+// query parameter limits them to changes of one field.
+func (p *Products) History(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.history")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	list, err := p.products.History(ctx, id, r.URL.Query().Get("field"))
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting history for product %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// CostAt gives the cost of a product at the RFC 3339 time in the at query
+// parameter, defaulting to now.
+func (p *Products) CostAt(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.costat")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	at := time.Now()
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return web.NewRequestError(errors.New("at must be an RFC 3339 time"), http.StatusBadRequest)
+		}
+		at = t
+	}
+
+	cost, err := p.products.CostAt(ctx, id, at)
+	if err != nil {
+		switch err {
+		case product.ErrNotFound, product.ErrNotCreated:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting cost of product %q", id)
+		}
+	}
+
+	resp := struct {
+		Cost money.Money `json:"cost"`
+		At   time.Time   `json:"at"`
+	}{
+		Cost: cost,
+		At:   at,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// parseListFilter reads the product listing options from the query string.
+func parseListFilter(r *http.Request) (product.ListFilter, error) {
+	q := r.URL.Query()
+
+	f := product.ListFilter{
+		Name:       q.Get("name"),
+		UserID:     q.Get("user_id"),
+		Currency:   q.Get("currency"),
+		CategoryID: q.Get("category_id"),
+		Tags:       q["tag"],
+		SKU:        q.Get("sku"),
+		Sort:       strings.TrimPrefix(q.Get("sort"), "-"),
+		Desc:       strings.HasPrefix(q.Get("sort"), "-"),
+		Cursor:     q.Get("cursor"),
+	}
+
+	for key, dst := range map[string]**int{"min_cost": &f.MinCost, "max_cost": &f.MaxCost} {
+		if v := q.Get(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return f, web.NewRequestError(errors.Errorf("%s must be an integer", key), http.StatusBadRequest)
+			}
+			*dst = &n
+		}
+	}
+
+	if v := q.Get("in_stock"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, web.NewRequestError(errors.New("in_stock must be a boolean"), http.StatusBadRequest)
+		}
+		f.InStock = b
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return f, web.NewRequestError(errors.New("limit must be a positive integer"), http.StatusBadRequest)
+		}
+		f.Limit = n
+	}
+
+	return f, nil
+}
+
+// etag formats a product version as a strong entity tag.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ifMatch reads the product version a request is conditional on from its
+// If-Match header. It returns 0 when there is no condition to check.
+func ifMatch(r *http.Request) (int, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	if h == "" || h == "*" {
+		return 0, nil
+	}
+
+	// A version can never match a weak or malformed tag so the precondition
+	// fails, the same as it would for a stale version.
+	v, err := strconv.Unquote(h)
+	if err != nil {
+		return 0, web.NewRequestError(product.ErrVersionConflict, http.StatusPreconditionFailed)
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return 0, web.NewRequestError(product.ErrVersionConflict, http.StatusPreconditionFailed)
+	}
+
+	return version, nil
+}
+
+// AddRefund records a refund against a sale of a particular product. It looks
+// for a JSON object in the request body. The full model is returned to the
+// caller.
+func (p *Products) AddRefund(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.addrefund")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nr product.NewRefund
+	if err := web.Decode(r, &nr); err != nil {
+		return errors.Wrap(err, "decoding new refund")
+	}
+
+	productID, saleID := web.Param(r, "id"), web.Param(r, "sale_id")
+
+	refund, err := p.products.AddRefund(ctx, claims, nr, productID, saleID, time.Now())
+	if err != nil {
+		return refundError(err, "refunding", saleID)
+	}
+
+	return web.Respond(ctx, w, refund, http.StatusCreated)
+}
+
+// VoidSale refunds everything that remains of a sale recorded in error. It
+// looks for a JSON object with the reason in the request body.
+func (p *Products) VoidSale(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.voidsale")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nv product.NewVoid
+	if err := web.Decode(r, &nv); err != nil {
+		return errors.Wrap(err, "decoding new void")
+	}
+
+	productID, saleID := web.Param(r, "id"), web.Param(r, "sale_id")
+
+	refund, err := p.products.VoidSale(ctx, claims, nv, productID, saleID, time.Now())
+	if err != nil {
+		return refundError(err, "voiding", saleID)
+	}
+
+	return web.Respond(ctx, w, refund, http.StatusCreated)
+}
+
+// ListRefunds gets all refunds of a sale of a particular product.
+func (p *Products) ListRefunds(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.listrefunds")
+	defer span.End()
+
+	productID, saleID := web.Param(r, "id"), web.Param(r, "sale_id")
+
+	list, err := p.products.ListRefunds(ctx, productID, saleID)
+	if err != nil {
+		return refundError(err, "listing refunds of", saleID)
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// refundError translates the errors of the refund functions for the client.
+// Unexpected errors are wrapped with the action that was being taken.
+func refundError(err error, action, saleID string) error {
+	switch err {
+	case product.ErrSaleNotFound:
+		return web.NewRequestError(err, http.StatusNotFound)
+	case product.ErrInvalidID, product.ErrEmptyRefund:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case product.ErrRefundExceedsSale:
+		return web.NewRequestError(err, http.StatusConflict)
+	default:
+		return errors.Wrapf(err, "%s sale %q", action, saleID)
+	}
+}
+
+// maxImportBytes limits the size of a bulk import request body.
+const maxImportBytes = 10 << 20
+
+// Import creates products in bulk from a CSV document (Content-Type text/csv)
+// or a JSON array of products. Each row is validated like a single create and
+// the response reports the outcome of every row. With dry_run=true in the
+// query string rows are only validated.
+func (p *Products) Import(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.import")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return web.NewRequestError(errors.New("dry_run must be a boolean"), http.StatusBadRequest)
+		}
+		dryRun = b
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	read := product.ReadJSON
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "text/csv" {
+		read = product.ReadCSV
+	}
+
+	rows, err := read(body)
+	if err != nil {
+		if err == product.ErrImportTooLarge || bodyTooLarge(err) {
+			return web.NewRequestError(err, http.StatusRequestEntityTooLarge)
+		}
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	report, err := p.products.Import(ctx, claims, rows, dryRun, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrImportTooLarge:
+			return web.NewRequestError(err, http.StatusRequestEntityTooLarge)
+		case product.ErrCategoryNotFound:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrNeedsDatabase:
+			return web.NewRequestError(err, http.StatusServiceUnavailable)
+		default:
+			return errors.Wrap(err, "importing products")
+		}
+	}
+
+	return web.Respond(ctx, w, report, http.StatusOK)
+}
+
+// bodyTooLarge reports whether err came from reading past the limit of an
+// http.MaxBytesReader. The error has no type of its own before Go 1.19 so it
+// is recognized by its message.
+func bodyTooLarge(err error) bool {
+	return errors.Cause(err).Error() == "http: request body too large"
+}
+
+// LowStock gets the products whose quantity is below their reorder threshold.
+func (p *Products) LowStock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.lowstock")
+	defer span.End()
+
+	list, err := p.products.LowStock(ctx)
 	if err != nil {
-		return errors.Wrap(err, "getting sales list")
+		return errors.Wrap(err, "getting low stock products")
 	}
 
 	return web.Respond(ctx, w, list, http.StatusOK)
 }
+
+// deliverAlerts sends the stock alerts raised by a change that has just been
+// committed. The change stands whether or not they can be delivered, so a
+// failure is only logged; the alerts are tried again after the next change.
+func deliverAlerts(ctx context.Context, products product.Store, log *log.Logger, n notify.Notifier) {
+	if _, err := products.DeliverAlerts(ctx, n, time.Now()); err != nil {
+		var traceID string
+		if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok {
+			traceID = v.TraceID
+		}
+		log.Printf("%s : ERROR : delivering stock alerts : %+v", traceID, err)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/promotion"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Promotions holds handlers for managing discount codes.
+type Promotions struct {
+	db *sqlx.DB
+}
+
+// List gets all existing promotions from the db and encodes them in a
+// response client.
+func (pr *Promotions) List(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.promotions.list")
+	defer span.End()
+
+	list, err := promotion.List(ctx, pr.db)
+	if err != nil {
+		return errors.Wrap(err, "getting promotion list")
+	}
+
+	return web.Respond(ctx, w, list, http.StatusOK)
+}
+
+// Create decodes the body of a request to create a new promotion. The full
+// promotion with generated fields is sent back in the response.
+func (pr *Promotions) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.promotions.create")
+	defer span.End()
+
+	var np promotion.NewPromotion
+	if err := web.Decode(r, &np); err != nil {
+		return errors.Wrap(err, "decoding new promotion")
+	}
+
+	p, err := promotion.Create(ctx, pr.db, np, time.Now())
+	if err != nil {
+		switch err {
+		case promotion.ErrInvalidDiscount, promotion.ErrInvalidWindow:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case promotion.ErrCodeTaken:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrap(err, "creating new promotion")
+		}
+	}
+
+	return web.Respond(ctx, w, p, http.StatusCreated)
+}
+
+// Retrieve finds a single promotion identified by an ID in the request URL.
+func (pr *Promotions) Retrieve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.promotions.get")
+	defer span.End()
+
+	id := web.Param(r, "id")
+
+	p, err := promotion.Get(ctx, pr.db, id)
+	if err != nil {
+		switch err {
+		case promotion.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case promotion.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "getting promotion %q", id)
+		}
+	}
+
+	return web.Respond(ctx, w, p, http.StatusOK)
+}
+
+// redemptionError turns the errors of redeeming a promotion code into
+// responses: a code that does not fit the sale is the client's mistake and
+// one that is used up or out of its window conflicts with the current state.
+// It returns nil for other errors.
+func redemptionError(err error) error {
+	switch err {
+	case promotion.ErrNotFound, promotion.ErrNotApplicable, promotion.ErrCurrencyMismatch, promotion.ErrPaidMismatch:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case promotion.ErrNotActive, promotion.ErrExhausted:
+		return web.NewRequestError(err, http.StatusConflict)
+	}
+	return nil
+}
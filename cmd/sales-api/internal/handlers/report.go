@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/report"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Reports holds handlers for the finance reports.
+type Reports struct {
+	db *sqlx.DB
+}
+
+// Sales reports units sold and revenue in time buckets. The query string sets
+// the range with from and to (RFC 3339, defaulting to the last 30 days), the
+// bucket width with interval (day, week or month), the breakdown with group
+// (product, user or category) and the time zone buckets are aligned to with tz.
+func (rp *Reports) Sales(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.reports.sales")
+	defer span.End()
+
+	q := r.URL.Query()
+
+	sq := report.SalesQuery{
+		Interval: q.Get("interval"),
+		GroupBy:  q.Get("group"),
+		TimeZone: q.Get("tz"),
+	}
+	if sq.Interval == "" {
+		sq.Interval = report.IntervalDay
+	}
+
+	var err error
+	if sq.From, sq.To, err = parseRange(r, time.Now(), 30*24*time.Hour); err != nil {
+		return err
+	}
+
+	buckets, err := report.Sales(ctx, rp.db, sq)
+	if err != nil {
+		switch err {
+		case report.ErrInvalidRange, report.ErrInvalidInterval, report.ErrInvalidGroup, report.ErrInvalidTimeZone:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting sales report")
+		}
+	}
+
+	return web.Respond(ctx, w, buckets, http.StatusOK)
+}
+
+// TopProducts ranks the products that sold the most over a period and compares
+// them with the period of the same length before it. The query string sets the
+// range with from and to as for Sales, the measure with by (units, the default,
+// or revenue), the currency revenue is ranked in with currency, the number of
+// products with limit (default 10) and an optional category with category.
+func (rp *Reports) TopProducts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.reports.topproducts")
+	defer span.End()
+
+	q := r.URL.Query()
+
+	tq := report.TopQuery{
+		By:         q.Get("by"),
+		Limit:      10,
+		Currency:   q.Get("currency"),
+		CategoryID: q.Get("category"),
+	}
+	if tq.By == "" {
+		tq.By = report.RankUnits
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return web.NewRequestError(report.ErrInvalidLimit, http.StatusBadRequest)
+		}
+		tq.Limit = n
+	}
+
+	var err error
+	if tq.From, tq.To, err = parseRange(r, time.Now(), 30*24*time.Hour); err != nil {
+		return err
+	}
+
+	top, err := report.TopProducts(ctx, rp.db, tq)
+	if err != nil {
+		switch err {
+		case report.ErrInvalidRange, report.ErrInvalidRank, report.ErrInvalidLimit, report.ErrCurrencyRequired, report.ErrInvalidCategory:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "getting top products report")
+		}
+	}
+
+	return web.Respond(ctx, w, top, http.StatusOK)
+}
+
+// parseRange reads an RFC 3339 time range from the from and to query
+// parameters. When to is missing it defaults to now and when from is missing
+// it defaults to span before to.
+func parseRange(r *http.Request, now time.Time, span time.Duration) (from, to time.Time, err error) {
+	q := r.URL.Query()
+
+	if to, err = optionalTime(q, "to"); err != nil {
+		return from, to, err
+	}
+	if to.IsZero() {
+		to = now
+	}
+
+	if from, err = optionalTime(q, "from"); err != nil {
+		return from, to, err
+	}
+	if from.IsZero() {
+		from = to.Add(-span)
+	}
+
+	return from, to, nil
+}
+
+// optionalTime reads an RFC 3339 time from the query parameter key. It gives
+// the zero time when the parameter is missing.
+func optionalTime(q url.Values, key string) (time.Time, error) {
+	v := q.Get(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, web.NewRequestError(errors.Errorf("%s must be an RFC 3339 time", key), http.StatusBadRequest)
+	}
+	return t, nil
+}
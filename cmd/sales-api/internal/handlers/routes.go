@@ -6,15 +6,38 @@ import (
 	"os"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/rakshans1/service/internal/invoice"
 	"github.com/rakshans1/service/internal/mid"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/idempotency"
+	"github.com/rakshans1/service/internal/platform/notify"
 	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/user"
 )
 
-// API constructs an http.Handler will all apllication routes definde.
-func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *auth.Authenticator) http.Handler {
+// API constructs an http.Handler will all apllication routes definde. Products
+// and users are kept in the given stores; the other handlers use db. Responses
+// to creating requests sent with an idempotency key are kept in keys. Invoices
+// name seller as the business issuing them. db may be nil when the stores
+// keep their data in memory, in which case promotions, categories, reports
+// and invoices answer 503 Service Unavailable, as do product requests naming
+// a category or a promotion code.
+func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *auth.Authenticator, notifier notify.Notifier, products product.Store, users user.Store, keys idempotency.Store, seller invoice.Seller) http.Handler {
 	app := web.NewApp(shutdown, log, mid.Logger(log), mid.Errors(log), mid.Metrics(), mid.Panics(log))
 
+	// Creating requests may be retried by clients with an Idempotency-Key.
+	// Imports take larger bodies than anything else.
+	idempotent := mid.Idempotency(log, keys, mid.MaxIdempotentBody)
+	idempotentImport := mid.Idempotency(log, keys, maxImportBytes)
+
+	// Handlers reading db directly are cut off when there is none. A nil
+	// middleware is skipped.
+	var needsDB web.Middleware
+	if db == nil {
+		needsDB = noDatabase
+	}
+
 	{
 		c := Check{db: db}
 		app.Handle(http.MethodGet, "/v1/health", c.Health)
@@ -22,22 +45,92 @@ func API(shutdown chan os.Signal, db *sqlx.DB, log *log.Logger, authenticator *a
 
 	{
 		// Register user handlers.
-		u := Users{db: db, authenticator: authenticator}
+		u := Users{users: users, authenticator: authenticator}
 		app.Handle(http.MethodGet, "/v1/users/token", u.Token)
 	}
 
 	{
 
-		p := Products{db: db, log: log}
+		p := Products{products: products, log: log, notifier: notifier}
 		app.Handle(http.MethodGet, "/v1/products", p.List, mid.Authenticate(authenticator))
+		app.Handle(http.MethodGet, "/v1/products/search", p.Search, mid.Authenticate(authenticator))
+		app.Handle(http.MethodGet, "/v1/products/low-stock", p.LowStock, mid.Authenticate(authenticator))
 		app.Handle(http.MethodGet, "/v1/products/{id}", p.Retrive, mid.Authenticate(authenticator))
-		app.Handle(http.MethodPost, "/v1/products", p.Create, mid.Authenticate(authenticator))
+		app.Handle(http.MethodPost, "/v1/products", p.Create, mid.Authenticate(authenticator), idempotent)
+		app.Handle(http.MethodPost, "/v1/products/import", p.Import, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotentImport)
+		app.Handle(http.MethodPost, "/v1/products/batch/update", p.BatchUpdate, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodPost, "/v1/products/batch/delete", p.BatchDelete, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodGet, "/v1/export/products", p.ExportProducts, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodGet, "/v1/export/sales", p.ExportSales, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
 		app.Handle(http.MethodPut, "/v1/products/{id}", p.Update, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
 		app.Handle(http.MethodDelete, "/v1/products/{id}", p.Delete, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
 
-		app.Handle(http.MethodPost, "/v1/products/{id}/sales", p.AddSale, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodGet, "/v1/products/{id}/history", p.History, mid.Authenticate(authenticator))
+		app.Handle(http.MethodGet, "/v1/products/{id}/cost", p.CostAt, mid.Authenticate(authenticator))
+
+		app.Handle(http.MethodPost, "/v1/products/{id}/variants", p.AddVariant, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotent)
+		app.Handle(http.MethodPut, "/v1/products/{id}/variants/{variant_id}", p.UpdateVariant, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodDelete, "/v1/products/{id}/variants/{variant_id}", p.DeleteVariant, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+
+		app.Handle(http.MethodPost, "/v1/products/{id}/images", p.UploadImage, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodPost, "/v1/products/{id}/documents", p.UploadDocument, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodGet, "/v1/products/{id}/attachments/{attachment_id}", p.DownloadAttachment, mid.Authenticate(authenticator))
+		app.Handle(http.MethodGet, "/v1/products/{id}/attachments/{attachment_id}/thumbnail", p.DownloadThumbnail, mid.Authenticate(authenticator))
+		app.Handle(http.MethodDelete, "/v1/products/{id}/attachments/{attachment_id}", p.DeleteAttachment, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+
+		app.Handle(http.MethodGet, "/v1/products/trash", p.Trash, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodPost, "/v1/products/{id}/restore", p.Restore, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+		app.Handle(http.MethodDelete, "/v1/products/{id}/purge", p.Purge, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin))
+
+		app.Handle(http.MethodPost, "/v1/products/{id}/sales", p.AddSale, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotent)
 		app.Handle(http.MethodGet, "/v1/products/{id}/sales", p.ListSales, mid.Authenticate(authenticator))
 
+		app.Handle(http.MethodGet, "/v1/users/{id}/sales", p.SalesByUser, mid.Authenticate(authenticator))
+		app.Handle(http.MethodGet, "/v1/me/sales", p.MySales, mid.Authenticate(authenticator))
+
+		app.Handle(http.MethodPost, "/v1/products/{id}/sales/{sale_id}/refunds", p.AddRefund, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotent)
+		app.Handle(http.MethodGet, "/v1/products/{id}/sales/{sale_id}/refunds", p.ListRefunds, mid.Authenticate(authenticator))
+		app.Handle(http.MethodPost, "/v1/products/{id}/sales/{sale_id}/void", p.VoidSale, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotent)
+
+	}
+
+	{
+		// Register order handlers.
+		o := Orders{products: products, log: log, notifier: notifier}
+		app.Handle(http.MethodPost, "/v1/orders", o.Create, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), idempotent)
+		app.Handle(http.MethodGet, "/v1/orders/{id}", o.Retrieve, mid.Authenticate(authenticator))
+	}
+
+	{
+		// Register promotion handlers.
+		pr := Promotions{db: db}
+		app.Handle(http.MethodGet, "/v1/promotions", pr.List, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+		app.Handle(http.MethodGet, "/v1/promotions/{id}", pr.Retrieve, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+		app.Handle(http.MethodPost, "/v1/promotions", pr.Create, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB, idempotent)
+	}
+
+	{
+		// Register category handlers.
+		c := Categories{db: db}
+		app.Handle(http.MethodGet, "/v1/categories", c.List, mid.Authenticate(authenticator), needsDB)
+		app.Handle(http.MethodGet, "/v1/categories/{id}", c.Retrieve, mid.Authenticate(authenticator), needsDB)
+		app.Handle(http.MethodPost, "/v1/categories", c.Create, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB, idempotent)
+		app.Handle(http.MethodPut, "/v1/categories/{id}", c.Update, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+		app.Handle(http.MethodDelete, "/v1/categories/{id}", c.Delete, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+	}
+
+	{
+		// Register report handlers.
+		rp := Reports{db: db}
+		app.Handle(http.MethodGet, "/v1/reports/sales", rp.Sales, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+		app.Handle(http.MethodGet, "/v1/reports/top-products", rp.TopProducts, mid.Authenticate(authenticator), mid.HasRole(auth.RoleAdmin), needsDB)
+	}
+
+	{
+		// Register invoice handlers.
+		i := Invoices{db: db, seller: seller}
+		app.Handle(http.MethodPost, "/v1/invoices", i.Create, mid.Authenticate(authenticator), needsDB, idempotent)
+		app.Handle(http.MethodGet, "/v1/invoices/{id}", i.Retrieve, mid.Authenticate(authenticator), needsDB)
 	}
 
 	return app
@@ -4,7 +4,6 @@ import (
 	"context"
 	"net/http"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/rakshans1/service/internal/platform/auth"
 	"github.com/rakshans1/service/internal/platform/web"
@@ -14,7 +13,7 @@ import (
 
 // Users holds handlers for dealing with user.
 type Users struct {
-	db            *sqlx.DB
+	users         user.Store
 	authenticator *auth.Authenticator
 }
 
@@ -36,7 +35,7 @@ func (u *Users) Token(ctx context.Context, w http.ResponseWriter, r *http.Reques
 		return web.NewRequestError(err, http.StatusUnauthorized)
 	}
 
-	claims, err := user.Authenticate(ctx, u.db, v.Start, email, pass)
+	claims, err := u.users.Authenticate(ctx, v.Start, email, pass)
 	if err != nil {
 		switch err {
 		case user.ErrAuthenticationFailure:
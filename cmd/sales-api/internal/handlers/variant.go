@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// AddVariant decodes the body of a request to add a variant to the product
+// identified in the request URL. A SKU already in use is answered with 409
+// Conflict.
+func (p *Products) AddVariant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.addvariant")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nv product.NewVariant
+	if err := web.Decode(r, &nv); err != nil {
+		return errors.Wrap(err, "decoding new variant")
+	}
+
+	productID := web.Param(r, "id")
+
+	v, err := p.products.AddVariant(ctx, claims, productID, nv, time.Now())
+	if err != nil {
+		switch err {
+		case product.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidSKU:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrSKUTaken:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "adding variant to product %q", productID)
+		}
+	}
+
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
+	return web.Respond(ctx, w, v, http.StatusCreated)
+}
+
+// UpdateVariant decodes the body of a request to change a variant of a
+// product. Both IDs are part of the request URL.
+func (p *Products) UpdateVariant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.updatevariant")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var uv product.UpdateVariant
+	if err := web.Decode(r, &uv); err != nil {
+		return errors.Wrap(err, "decoding variant update")
+	}
+
+	productID := web.Param(r, "id")
+	variantID := web.Param(r, "variant_id")
+
+	if err := p.products.EditVariant(ctx, claims, productID, variantID, uv, time.Now()); err != nil {
+		switch err {
+		case product.ErrNotFound, product.ErrVariantNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID, product.ErrInvalidSKU:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrSKUTaken:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "updating variant %q", variantID)
+		}
+	}
+
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// DeleteVariant removes a variant from a product. A variant that has been sold
+// is kept and answered with 409 Conflict.
+func (p *Products) DeleteVariant(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	ctx, span := global.Tracer("service").Start(ctx, "handlers.products.deletevariant")
+	defer span.End()
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	productID := web.Param(r, "id")
+	variantID := web.Param(r, "variant_id")
+
+	if err := p.products.DeleteVariant(ctx, claims, productID, variantID, time.Now()); err != nil {
+		switch err {
+		case product.ErrNotFound, product.ErrVariantNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case product.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case product.ErrVariantInUse:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "deleting variant %q", variantID)
+		}
+	}
+
+	deliverAlerts(ctx, p.products, p.log, p.notifier)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
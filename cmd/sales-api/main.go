@@ -18,9 +18,15 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/blob"
 	"github.com/rakshans1/service/internal/platform/database"
+	"github.com/rakshans1/service/internal/platform/idempotency"
+	"github.com/rakshans1/service/internal/platform/notify"
 	"github.com/rakshans1/service/internal/platform/tracer"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/user"
 )
 
 func main() {
@@ -64,6 +70,24 @@ func run() error {
 			ServiceName string  `conf:"default:sales-api"`
 			Probability float64 `conf:"default:1"`
 		}
+		Notify struct {
+			Type       string        `conf:"default:log"`
+			WebhookURL string        `conf:"noprint"`
+			Timeout    time.Duration `conf:"default:5s"`
+			OutboxFile string        `conf:"default:notifications.ndjson"`
+		}
+		Blob struct {
+			Dir string `conf:"default:blobs"`
+		}
+		Invoice struct {
+			SellerName    string `conf:"default:Garage Sale"`
+			SellerAddress string
+			SellerTaxID   string
+		}
+		Idempotency struct {
+			Window        time.Duration `conf:"default:24h"`
+			PruneInterval time.Duration `conf:"default:1h"`
+		}
 	}
 
 	if err := conf.Parse(os.Args[1:], "SALES", &cfg); err != nil {
@@ -117,6 +141,21 @@ func run() error {
 	}
 	defer db.Close()
 
+	// =========================================================================
+	// Initialize notifications
+
+	var notifier notify.Notifier
+	switch cfg.Notify.Type {
+	case "log":
+		notifier = notify.NewLog(log)
+	case "webhook":
+		notifier = notify.NewWebhook(cfg.Notify.WebhookURL, &http.Client{Timeout: cfg.Notify.Timeout})
+	case "outbox":
+		notifier = notify.NewOutbox(cfg.Notify.OutboxFile)
+	default:
+		return errors.Errorf("unknown notifier type %q", cfg.Notify.Type)
+	}
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -142,6 +181,28 @@ func run() error {
 		}
 	}()
 
+	// =========================================================================
+	// Start Idempotency Key Pruning
+	//
+	// Expired keys are never replayed; pruning only reclaims their space so it
+	// is not concerned with shutting down either.
+
+	keys := idempotency.NewPostgres(db, cfg.Idempotency.Window)
+
+	go func() {
+		ticker := time.NewTicker(cfg.Idempotency.PruneInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			n, err := keys.Prune(context.Background(), time.Now())
+			if err != nil {
+				log.Printf("main : Pruning idempotency keys : %v", err)
+				continue
+			}
+			log.Printf("main : Pruned %d idempotency keys", n)
+		}
+	}()
+
 	// =========================================================================
 	// Start API Service
 
@@ -150,9 +211,16 @@ func run() error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	products := product.NewPostgres(db, blob.NewLocal(cfg.Blob.Dir))
+	seller := invoice.Seller{
+		Name:    cfg.Invoice.SellerName,
+		Address: cfg.Invoice.SellerAddress,
+		TaxID:   cfg.Invoice.SellerTaxID,
+	}
+
 	api := http.Server{
 		Addr:         cfg.Web.Address,
-		Handler:      handlers.API(shutdown, db, log, authenticator),
+		Handler:      handlers.API(shutdown, db, log, authenticator, notifier, products, user.NewPostgres(db), keys, seller),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 	}
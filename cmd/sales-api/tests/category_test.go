@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/category"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// TestCategories files a product under a subcategory and clears both
+// references by sending them blank. Categories are only kept in the database.
+func TestCategories(t *testing.T) {
+	test := tests.New(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewLog(test.Log), test.Products, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"})
+	token := test.Token("admin@example.com", "gophers")
+
+	send := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+		return resp
+	}
+
+	create := func(body string) category.Category {
+		t.Helper()
+
+		resp := send("POST", "/v1/categories", body)
+		if http.StatusCreated != resp.Code {
+			t.Fatalf("creating %s: expected status code %v, got %v", body, http.StatusCreated, resp.Code)
+		}
+		var c category.Category
+		if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		return c
+	}
+
+	books := create(`{"name":"Books"}`)
+	comics := create(`{"name":"Comics","parent_id":"` + books.ID + `"}`)
+
+	// An empty parent moves the category to the root.
+	if resp := send("PUT", "/v1/categories/"+comics.ID, `{"parent_id":""}`); http.StatusNoContent != resp.Code {
+		t.Fatalf("moving to the root: expected status code %v, got %v: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+
+	resp := send("GET", "/v1/categories/"+comics.ID, "")
+	if http.StatusOK != resp.Code {
+		t.Fatalf("getting category: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+	var c category.Category
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if c.ParentID != nil {
+		t.Fatalf("expected category to be at the root, got parent %q", *c.ParentID)
+	}
+
+	// An empty category takes the product out of its category.
+	const comicsID = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+	if resp := send("PUT", "/v1/products/"+comicsID, `{"category_id":"`+comics.ID+`"}`); http.StatusNoContent != resp.Code {
+		t.Fatalf("filing product: expected status code %v, got %v: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+	if resp := send("PUT", "/v1/products/"+comicsID, `{"category_id":""}`); http.StatusNoContent != resp.Code {
+		t.Fatalf("clearing category: expected status code %v, got %v: %s", http.StatusNoContent, resp.Code, resp.Body)
+	}
+
+	resp = send("GET", "/v1/products/"+comicsID, "")
+	if http.StatusOK != resp.Code {
+		t.Fatalf("getting product: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+	var p product.Product
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if p.CategoryID != nil {
+		t.Fatalf("expected product to have no category, got %q", *p.CategoryID)
+	}
+
+	// Anything else must still be an id.
+	if resp := send("PUT", "/v1/products/"+comicsID, `{"category_id":"comics"}`); http.StatusBadRequest != resp.Code {
+		t.Fatalf("filing under a bad id: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+}
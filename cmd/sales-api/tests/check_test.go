@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// TestNoDatabase ensures that a service running on in-memory stores is healthy
+// and turns away requests for what only a database keeps, categories and
+// promotions included.
+func TestNoDatabase(t *testing.T) {
+	test := tests.NewMemory(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewLog(test.Log), test.Products, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"})
+	token := test.Token("admin@example.com", "gophers")
+
+	req := httptest.NewRequest("GET", "/v1/health", nil)
+	resp := httptest.NewRecorder()
+
+	app.ServeHTTP(resp, req)
+
+	if http.StatusOK != resp.Code {
+		t.Fatalf("checking health: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	for _, url := range []string{
+		"/v1/promotions",
+		"/v1/categories",
+		"/v1/reports/sales",
+		"/v1/reports/top-products",
+		"/v1/invoices/a224a8d6-3f9e-4b11-9900-e81a25d80702",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+
+		if http.StatusServiceUnavailable != resp.Code {
+			t.Fatalf("getting %s: expected status code %v, got %v", url, http.StatusServiceUnavailable, resp.Code)
+		}
+	}
+
+	// Products are kept but they cannot be placed in categories nor sold
+	// with promotion codes.
+	const comics = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+	for _, tc := range []struct {
+		method, url, body string
+	}{
+		{"GET", "/v1/products?category_id=a224a8d6-3f9e-4b11-9900-e81a25d80702", ""},
+		{"PUT", "/v1/products/" + comics, `{"category_id":"a224a8d6-3f9e-4b11-9900-e81a25d80702"}`},
+		{"POST", "/v1/products/" + comics + "/sales", `{"quantity":1,"paid":{"amount":45,"currency":"INR"},"code":"SAVE10"}`},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+
+		if http.StatusServiceUnavailable != resp.Code {
+			t.Fatalf("%s %s: expected status code %v, got %v", tc.method, tc.url, http.StatusServiceUnavailable, resp.Code)
+		}
+	}
+}
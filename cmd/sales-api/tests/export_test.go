@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/platform/web"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// failingExports is a store whose exports fail before producing a row, as
+// they do when the database cannot be queried.
+type failingExports struct {
+	product.Store
+}
+
+func (failingExports) ExportProducts(ctx context.Context, fn func(product.Product) error) error {
+	return errors.New("connection refused")
+}
+
+func (failingExports) ExportSales(ctx context.Context, from, to time.Time, fn func(product.Sale) error) error {
+	return errors.New("connection refused")
+}
+
+// TestExportFailure ensures an export that fails before its first row is
+// answered with an error instead of an empty file.
+func TestExportFailure(t *testing.T) {
+	test := tests.NewMemory(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewLog(test.Log), failingExports{test.Products}, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"})
+	token := test.Token("admin@example.com", "gophers")
+
+	for _, url := range []string{
+		"/v1/export/products?format=csv",
+		"/v1/export/sales",
+	} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+
+		if http.StatusInternalServerError != resp.Code {
+			t.Fatalf("exporting %s: expected status code %v, got %v", url, http.StatusInternalServerError, resp.Code)
+		}
+		var got web.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("exporting %s: decoding error: %s", url, err)
+		}
+	}
+}
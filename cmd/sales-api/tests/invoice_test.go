@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// TestInvoices issues an invoice for a sale and reads it back in each format.
+// Invoices are only kept in the database.
+func TestInvoices(t *testing.T) {
+	test := tests.New(t)
+	defer test.Teardown()
+
+	shutdown := make(chan os.Signal, 1)
+	app := handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewLog(test.Log), test.Products, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"})
+	token := test.Token("admin@example.com", "gophers")
+
+	issue := func() *httptest.ResponseRecorder {
+		body := strings.NewReader(`{"sale_id":"98b6d4b8-f04b-4c79-8c2e-a0aef46854b7"}`)
+		req := httptest.NewRequest("POST", "/v1/invoices", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := issue()
+	if http.StatusCreated != resp.Code {
+		t.Fatalf("issuing: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+	var inv invoice.Invoice
+	if err := json.NewDecoder(resp.Body).Decode(&inv); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := int64(1), inv.Number; exp != got {
+		t.Fatalf("expected invoice number %v, got %v", exp, got)
+	}
+
+	if resp := issue(); http.StatusConflict != resp.Code {
+		t.Fatalf("issuing twice: expected status code %v, got %v", http.StatusConflict, resp.Code)
+	}
+
+	cases := []struct {
+		accept      string
+		contentType string
+		contains    string
+	}{
+		{"", "application/json; charset=utf-8", `"number":1`},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<h1>Invoice 00000001</h1>"},
+		{"text/plain", "text/plain; charset=utf-8", "INVOICE 00000001"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/v1/invoices/"+inv.ID, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", tc.accept)
+		resp := httptest.NewRecorder()
+
+		app.ServeHTTP(resp, req)
+
+		if http.StatusOK != resp.Code {
+			t.Fatalf("getting %q: expected status code %v, got %v", tc.accept, http.StatusOK, resp.Code)
+		}
+		if got := resp.Header().Get("Content-Type"); got != tc.contentType {
+			t.Fatalf("getting %q: expected content type %q, got %q", tc.accept, tc.contentType, got)
+		}
+		if !strings.Contains(resp.Body.String(), tc.contains) {
+			t.Fatalf("getting %q: expected body to contain %q, got:\n%s", tc.accept, tc.contains, resp.Body.String())
+		}
+	}
+}
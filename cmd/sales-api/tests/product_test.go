@@ -1,16 +1,24 @@
 package tests
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
 	"github.com/rakshans1/service/internal/tests"
 )
 
@@ -19,20 +27,43 @@ import (
 // speed and convenience. The downside is the order the tests are ran matters
 // and one test may break if other tests are not ran before it. If a particular
 // subtest needs a fresh instance of the application it can make it or it
-// should be its own Test* function.
+// should be its own Test* function. They run once against each store.
 func TestProducts(t *testing.T) {
-	test := tests.New(t)
-	defer test.Teardown()
+	tests.EachStore(t, testProducts)
+}
+
+func testProducts(t *testing.T, test *tests.Test) {
+	// Notifications go to a file the tests can read back.
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatalf("creating outbox dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	outbox := filepath.Join(dir, "outbox.ndjson")
 
 	shutdown := make(chan os.Signal, 1)
 	tests := ProductTests{
-		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator),
+		app:        handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewOutbox(outbox), test.Products, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"}),
 		adminToken: test.Token("admin@example.com", "gophers"),
+		userToken:  test.Token("user@example.com", "gophers"),
+		outbox:     outbox,
 	}
 
 	t.Run("List", tests.List)
+	t.Run("ListRejectsBadSort", tests.ListRejectsBadSort)
+	t.Run("Export", tests.Export)
 	t.Run("CreateRequiresFields", tests.CreateRequiresFields)
 	t.Run("ProductCRUD", tests.ProductCRUD)
+	t.Run("SaleErrors", tests.SaleErrors)
+	t.Run("UserSales", tests.UserSales)
+	t.Run("Orders", tests.Orders)
+	t.Run("LowStock", tests.LowStock)
+	t.Run("Attachments", tests.Attachments)
+	t.Run("Batch", tests.Batch)
+	t.Run("ImportTooLarge", tests.ImportTooLarge)
+	t.Run("IdempotentImport", tests.IdempotentImport)
+	t.Run("IdempotentSales", tests.IdempotentSales)
+	t.Run("Refunds", tests.Refunds)
 }
 
 // ProductTests holds methods for each product subtest. This type allows
@@ -41,6 +72,8 @@ func TestProducts(t *testing.T) {
 type ProductTests struct {
 	app        http.Handler
 	adminToken string
+	userToken  string
+	outbox     string
 }
 
 func (p *ProductTests) List(t *testing.T) {
@@ -55,41 +88,125 @@ func (p *ProductTests) List(t *testing.T) {
 		t.Fatalf("getting: expected status code %v, got %v", http.StatusOK, resp.Code)
 	}
 
-	var list []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+	var page struct {
+		Items      []map[string]interface{} `json:"items"`
+		Total      int                      `json:"total"`
+		NextCursor string                   `json:"next_cursor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
 		t.Fatalf("decoding: %s", err)
 	}
 
+	if exp, got := 2, page.Total; exp != got {
+		t.Fatalf("expected total %v, got %v", exp, got)
+	}
+
 	want := []map[string]interface{}{
 		{
 			"id":           "a2b0639f-2cc6-44b8-b97b-15d69dbb511e",
 			"name":         "Comic Books",
-			"cost":         float64(50),
+			"cost":         map[string]interface{}{"amount": float64(50), "currency": "INR"},
 			"quantity":     float64(42),
-			"revenue":      float64(350),
+			"revenue":      []interface{}{map[string]interface{}{"amount": float64(350), "currency": "INR"}},
 			"sold":         float64(7),
 			"user_id":      "00000000-0000-0000-0000-000000000000",
+			"version":      float64(1),
 			"date_created": "2019-01-01T00:00:01.000001Z",
 			"date_updated": "2019-01-01T00:00:01.000001Z",
 		},
 		{
 			"id":           "72f8b983-3eb4-48db-9ed0-e45cc6bd716b",
 			"name":         "McDonalds Toys",
-			"cost":         float64(75),
+			"cost":         map[string]interface{}{"amount": float64(75), "currency": "INR"},
 			"quantity":     float64(120),
-			"revenue":      float64(225),
+			"revenue":      []interface{}{map[string]interface{}{"amount": float64(225), "currency": "INR"}},
 			"sold":         float64(3),
 			"user_id":      "00000000-0000-0000-0000-000000000000",
+			"version":      float64(1),
 			"date_created": "2019-01-01T00:00:02.000001Z",
 			"date_updated": "2019-01-01T00:00:02.000001Z",
 		},
 	}
 
-	if diff := cmp.Diff(want, list); diff != "" {
+	if diff := cmp.Diff(want, page.Items); diff != "" {
 		t.Fatalf("Response did not match expected. Diff:\n%s", diff)
 	}
 }
 
+func (p *ProductTests) ListRejectsBadSort(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/products?sort=color", nil)
+	resp := httptest.NewRecorder()
+
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+
+	p.app.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("getting: expected status code %v, got %v", http.StatusBadRequest, resp.Code)
+	}
+}
+
+// Export checks the seeded products and sales can be streamed in both formats.
+func (p *ProductTests) Export(t *testing.T) {
+	cases := []struct {
+		name  string
+		url   string
+		ctype string
+		lines int
+	}{
+		{"ProductsCSV", "/v1/export/products?format=csv", "text/csv; charset=utf-8", 3},
+		{"SalesNDJSON", "/v1/export/sales", "application/x-ndjson", 3},
+		{"SalesRange", "/v1/export/sales?from=2019-01-01T00:00:04Z", "application/x-ndjson", 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			req.Header.Set("Authorization", "Bearer "+p.adminToken)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if resp.Code != http.StatusOK {
+				t.Fatalf("exporting: expected status code %v, got %v", http.StatusOK, resp.Code)
+			}
+			if exp, got := tc.ctype, resp.Header().Get("Content-Type"); exp != got {
+				t.Fatalf("expected content type %q, got %q", exp, got)
+			}
+			if exp, got := tc.lines, strings.Count(resp.Body.String(), "\n"); exp != got {
+				t.Fatalf("expected %v lines, got %v:\n%s", exp, got, resp.Body.String())
+			}
+		})
+	}
+
+	// A format that does not exist is a mistake in the request while an
+	// Accept header listing none of ours cannot be satisfied.
+	for _, tc := range []struct {
+		name   string
+		url    string
+		accept string
+		status int
+	}{
+		{"UnknownFormat", "/v1/export/products?format=xml", "", http.StatusBadRequest},
+		{"NotAcceptable", "/v1/export/products", "application/xml", http.StatusNotAcceptable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			req.Header.Set("Authorization", "Bearer "+p.adminToken)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if resp.Code != tc.status {
+				t.Fatalf("exporting: expected status code %v, got %v", tc.status, resp.Code)
+			}
+		})
+	}
+}
+
 func (p *ProductTests) CreateRequiresFields(t *testing.T) {
 	body := strings.NewReader(`{}`)
 	req := httptest.NewRequest("POST", "/v1/products", body)
@@ -110,7 +227,7 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 	var created map[string]interface{}
 
 	{ // CREATE
-		body := strings.NewReader(`{"name":"product0","cost":55,"quantity":6}`)
+		body := strings.NewReader(`{"name":"product0","cost":{"amount":55,"currency":"INR"},"quantity":6}`)
 
 		req := httptest.NewRequest("POST", "/v1/products", body)
 		req.Header.Set("Content-Type", "application/json")
@@ -142,11 +259,12 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			"date_created": created["date_created"],
 			"date_updated": created["date_updated"],
 			"name":         "product0",
-			"cost":         float64(55),
+			"cost":         map[string]interface{}{"amount": float64(55), "currency": "INR"},
 			"quantity":     float64(6),
 			"sold":         float64(0),
-			"revenue":      float64(0),
+			"revenue":      []interface{}{},
 			"user_id":      tests.AdminID,
+			"version":      float64(1),
 		}
 
 		if diff := cmp.Diff(want, created); diff != "" {
@@ -167,6 +285,10 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			t.Fatalf("retrieving: expected status code %v, got %v", http.StatusOK, resp.Code)
 		}
 
+		if exp, got := `"1"`, resp.Header().Get("ETag"); exp != got {
+			t.Fatalf("expected ETag %s, got %s", exp, got)
+		}
+
 		var fetched map[string]interface{}
 		if err := json.NewDecoder(resp.Body).Decode(&fetched); err != nil {
 			t.Fatalf("decoding: %s", err)
@@ -179,11 +301,12 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 	}
 
 	{ // UPDATE
-		body := strings.NewReader(`{"name":"new name","cost":20,"quantity":10}`)
+		body := strings.NewReader(`{"name":"new name","cost":{"amount":20,"currency":"INR"},"quantity":10}`)
 		url := fmt.Sprintf("/v1/products/%s", created["id"])
 		req := httptest.NewRequest("PUT", url, body)
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("If-Match", `"1"`)
 		resp := httptest.NewRecorder()
 
 		p.app.ServeHTTP(resp, req)
@@ -191,6 +314,23 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 		if http.StatusNoContent != resp.Code {
 			t.Fatalf("updating: expected status code %v, got %v", http.StatusNoContent, resp.Code)
 		}
+		if exp, got := `"2"`, resp.Header().Get("ETag"); exp != got {
+			t.Fatalf("updating: expected ETag %s, got %s", exp, got)
+		}
+
+		// Repeating the update with the now stale version must be refused.
+		body = strings.NewReader(`{"name":"newer name"}`)
+		req = httptest.NewRequest("PUT", url, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("If-Match", `"1"`)
+		resp = httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusPreconditionFailed != resp.Code {
+			t.Fatalf("updating stale: expected status code %v, got %v", http.StatusPreconditionFailed, resp.Code)
+		}
 
 		// Retrieve updated record to be sure it worked.
 		req = httptest.NewRequest("GET", url, nil)
@@ -214,11 +354,12 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			"date_created": created["date_created"],
 			"date_updated": updated["date_updated"],
 			"name":         "new name",
-			"cost":         float64(20),
+			"cost":         map[string]interface{}{"amount": float64(20), "currency": "INR"},
 			"quantity":     float64(10),
 			"sold":         float64(0),
-			"revenue":      float64(0),
+			"revenue":      []interface{}{},
 			"user_id":      tests.AdminID,
+			"version":      float64(2),
 		}
 
 		// Updated product should match the one we created.
@@ -251,4 +392,588 @@ func (p *ProductTests) ProductCRUD(t *testing.T) {
 			t.Fatalf("retrieving: expected status code %v, got %v", http.StatusNotFound, resp.Code)
 		}
 	}
+
+	{ // RESTORE
+		url := fmt.Sprintf("/v1/products/%s/restore", created["id"])
+		req := httptest.NewRequest("POST", url, nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusNoContent != resp.Code {
+			t.Fatalf("restoring: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+		}
+
+		// The restored product can be retrieved again.
+		req = httptest.NewRequest("GET", fmt.Sprintf("/v1/products/%s", created["id"]), nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp = httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusOK != resp.Code {
+			t.Fatalf("retrieving: expected status code %v, got %v", http.StatusOK, resp.Code)
+		}
+	}
+}
+
+// SaleErrors checks that bad sale requests are answered with client errors.
+func (p *ProductTests) SaleErrors(t *testing.T) {
+	const missing = "6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11"
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"AddInvalidID", "POST", "/v1/products/abc/sales", `{"quantity":1,"paid":{"amount":10,"currency":"INR"}}`, http.StatusBadRequest},
+		{"AddMissingProduct", "POST", "/v1/products/" + missing + "/sales", `{"quantity":1,"paid":{"amount":10,"currency":"INR"}}`, http.StatusNotFound},
+		{"AddZeroQuantity", "POST", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales", `{"quantity":0,"paid":{"amount":10,"currency":"INR"}}`, http.StatusBadRequest},
+		{"AddUnknownCurrency", "POST", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales", `{"quantity":1,"paid":{"amount":10,"currency":"XYZ"}}`, http.StatusBadRequest},
+		{"AddTooMany", "POST", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales", `{"quantity":1000,"paid":{"amount":10,"currency":"INR"}}`, http.StatusConflict},
+		{"ListInvalidID", "GET", "/v1/products/abc/sales", "", http.StatusBadRequest},
+		{"ListMissingProduct", "GET", "/v1/products/" + missing + "/sales", "", http.StatusNotFound},
+		{"ListBadFrom", "GET", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales?from=yesterday", "", http.StatusBadRequest},
+		{"ListBadCursor", "GET", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales?cursor=garbage", "", http.StatusBadRequest},
+		{"ListBadLimit", "GET", "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e/sales?limit=many", "", http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+p.adminToken)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if tc.status != resp.Code {
+				t.Fatalf("expected status code %v, got %v", tc.status, resp.Code)
+			}
+		})
+	}
+}
+
+// UserSales checks that users can list their own sales but only admins can
+// list the sales of others.
+func (p *ProductTests) UserSales(t *testing.T) {
+	cases := []struct {
+		name   string
+		url    string
+		token  string
+		status int
+	}{
+		{"Mine", "/v1/me/sales", p.userToken, http.StatusOK},
+		{"Own", "/v1/users/" + tests.UserID + "/sales", p.userToken, http.StatusOK},
+		{"Others", "/v1/users/" + tests.AdminID + "/sales", p.userToken, http.StatusForbidden},
+		{"AdminReviewsOthers", "/v1/users/" + tests.UserID + "/sales", p.adminToken, http.StatusOK},
+		{"InvalidID", "/v1/users/abc/sales", p.adminToken, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.url, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if tc.status != resp.Code {
+				t.Fatalf("expected status code %v, got %v", tc.status, resp.Code)
+			}
+		})
+	}
+}
+
+// Orders checks an order of several products can be placed and read back, and
+// that bad orders are answered with client errors.
+func (p *ProductTests) Orders(t *testing.T) {
+	const (
+		comics = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		toys   = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+	)
+
+	body := `{"items":[
+		{"product_id":"` + comics + `","quantity":2,"paid":{"amount":100,"currency":"INR"}},
+		{"product_id":"` + toys + `","quantity":1,"paid":{"amount":75,"currency":"INR"}},
+		{"product_id":"` + toys + `","quantity":1,"paid":{"amount":2,"currency":"USD"}}
+	]}`
+
+	req := httptest.NewRequest("POST", "/v1/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if http.StatusCreated != resp.Code {
+		t.Fatalf("creating: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+
+	var created struct {
+		ID     string                   `json:"id"`
+		Items  []map[string]interface{} `json:"items"`
+		Totals []map[string]interface{} `json:"totals"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := 3, len(created.Items); exp != got {
+		t.Fatalf("expected %v order items, got %v", exp, got)
+	}
+	wantTotals := []map[string]interface{}{
+		{"amount": float64(175), "currency": "INR"},
+		{"amount": float64(2), "currency": "USD"},
+	}
+	if diff := cmp.Diff(wantTotals, created.Totals); diff != "" {
+		t.Fatalf("order totals did not match:\n%s", diff)
+	}
+
+	url := "/v1/orders/" + created.ID
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		body   string
+		status int
+	}{
+		{"Retrieve", "GET", url, p.adminToken, "", http.StatusOK},
+		{"RetrieveOthers", "GET", url, p.userToken, "", http.StatusForbidden},
+		{"RetrieveInvalidID", "GET", "/v1/orders/abc", p.adminToken, "", http.StatusBadRequest},
+		{"RetrieveMissing", "GET", "/v1/orders/6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11", p.adminToken, "", http.StatusNotFound},
+		{"CreateNoItems", "POST", "/v1/orders", p.adminToken, `{"items":[]}`, http.StatusBadRequest},
+		{"CreateMissingProduct", "POST", "/v1/orders", p.adminToken, `{"items":[{"product_id":"6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11","quantity":1,"paid":{"amount":10,"currency":"INR"}}]}`, http.StatusBadRequest},
+		{"CreateTooMany", "POST", "/v1/orders", p.adminToken, `{"items":[{"product_id":"` + toys + `","quantity":1000,"paid":{"amount":10,"currency":"INR"}}]}`, http.StatusConflict},
+		{"CreateAsUser", "POST", "/v1/orders", p.userToken, body, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if tc.status != resp.Code {
+				t.Fatalf("expected status code %v, got %v", tc.status, resp.Code)
+			}
+		})
+	}
+}
+
+// LowStock checks that raising a product's reorder threshold above its stock
+// lists it as low on stock and sends a single alert for it.
+func (p *ProductTests) LowStock(t *testing.T) {
+	const toys = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+
+	update := func(body string) {
+		t.Helper()
+
+		req := httptest.NewRequest("PUT", "/v1/products/"+toys, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusNoContent != resp.Code {
+			t.Fatalf("updating: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+		}
+	}
+
+	// Setting the threshold crosses it and changing it again while still below
+	// must not alert a second time.
+	update(`{"reorder_threshold": 1000}`)
+	update(`{"reorder_threshold": 2000}`)
+
+	req := httptest.NewRequest("GET", "/v1/products/low-stock", nil)
+	req.Header.Set("Authorization", "Bearer "+p.userToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if http.StatusOK != resp.Code {
+		t.Fatalf("listing: expected status code %v, got %v", http.StatusOK, resp.Code)
+	}
+
+	var list []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if len(list) != 1 || list[0]["id"] != toys {
+		t.Fatalf("expected only the toys to be low on stock, got %v", list)
+	}
+
+	ns, err := notify.ReadOutbox(p.outbox)
+	if err != nil {
+		t.Fatalf("reading outbox: %s", err)
+	}
+	if len(ns) != 1 || ns[0].Kind != "product.low_stock" {
+		t.Fatalf("expected one low stock alert, got %+v", ns)
+	}
+}
+
+// Attachments uploads an image and a document to a product, downloads them
+// and removes them again.
+func (p *ProductTests) Attachments(t *testing.T) {
+	const comics = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+
+	upload := func(path, filename string, data []byte, status int) map[string]interface{} {
+		t.Helper()
+
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatalf("creating form: %s", err)
+		}
+		fw.Write(data)
+		mw.Close()
+
+		req := httptest.NewRequest("POST", "/v1/products/"+comics+path, &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if status != resp.Code {
+			t.Fatalf("uploading %s: expected status code %v, got %v", filename, status, resp.Code)
+		}
+
+		var a map[string]interface{}
+		if status == http.StatusCreated {
+			if err := json.NewDecoder(resp.Body).Decode(&a); err != nil {
+				t.Fatalf("decoding: %s", err)
+			}
+		}
+		return a
+	}
+
+	get := func(url, token string, status int) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if status != resp.Code {
+			t.Fatalf("getting %s: expected status code %v, got %v", url, status, resp.Code)
+		}
+		return resp
+	}
+
+	var cover bytes.Buffer
+	if err := png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatalf("encoding image: %s", err)
+	}
+
+	img := upload("/images", "cover.png", cover.Bytes(), http.StatusCreated)
+	doc := upload("/documents", "manual.txt", []byte("Read from left to right."), http.StatusCreated)
+	upload("/images", "manual.txt", []byte("Not an image."), http.StatusUnsupportedMediaType)
+
+	if img["thumbnail_url"] == nil {
+		t.Fatalf("expected the image to have a thumbnail, got %v", img)
+	}
+	if doc["thumbnail_url"] != nil {
+		t.Fatalf("expected the document to have no thumbnail, got %v", doc)
+	}
+
+	{ // Download
+		resp := get(doc["url"].(string), p.userToken, http.StatusOK)
+		if exp, got := "Read from left to right.", resp.Body.String(); exp != got {
+			t.Fatalf("expected document %q, got %q", exp, got)
+		}
+
+		resp = get(img["thumbnail_url"].(string), p.userToken, http.StatusOK)
+		thumb, err := png.Decode(resp.Body)
+		if err != nil {
+			t.Fatalf("decoding thumbnail: %s", err)
+		}
+		if exp, got := image.Rect(0, 0, 256, 128), thumb.Bounds(); exp != got {
+			t.Fatalf("expected thumbnail bounds %v, got %v", exp, got)
+		}
+	}
+
+	{ // Listed on the product
+		resp := get("/v1/products/"+comics, p.userToken, http.StatusOK)
+
+		var prod struct {
+			Attachments []map[string]interface{} `json:"attachments"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&prod); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		if len(prod.Attachments) != 2 || prod.Attachments[0]["id"] != img["id"] || prod.Attachments[1]["id"] != doc["id"] {
+			t.Fatalf("expected the image and document on the product, got %v", prod.Attachments)
+		}
+	}
+
+	{ // Delete
+		req := httptest.NewRequest("DELETE", doc["url"].(string), nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusNoContent != resp.Code {
+			t.Fatalf("deleting: expected status code %v, got %v", http.StatusNoContent, resp.Code)
+		}
+
+		get(doc["url"].(string), p.userToken, http.StatusNotFound)
+	}
+}
+
+// Batch reprices products in one request and checks each item is reported
+// with the status a single update would have had.
+func (p *ProductTests) Batch(t *testing.T) {
+	const (
+		comics  = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		toys    = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+		missing = "00000000-0000-0000-0000-00000000beef"
+	)
+
+	batch := func(path, body string) map[string]interface{} {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		if http.StatusOK != resp.Code {
+			t.Fatalf("posting batch: expected status code %v, got %v", http.StatusOK, resp.Code)
+		}
+
+		var report map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		return report
+	}
+
+	report := batch("/v1/products/batch/update", `{"mode": "best_effort", "items": [
+		{"id": "`+comics+`", "cost": {"amount": 60, "currency": "INR"}},
+		{"id": "`+missing+`", "cost": {"amount": 60, "currency": "INR"}},
+		{"id": "`+toys+`", "version": 99, "cost": {"amount": 80, "currency": "INR"}}
+	]}`)
+
+	want := map[string]interface{}{
+		"mode":    "best_effort",
+		"applied": float64(1),
+		"items": []interface{}{
+			map[string]interface{}{"id": comics, "status": float64(http.StatusNoContent)},
+			map[string]interface{}{"id": missing, "status": float64(http.StatusNotFound), "error": "product not found"},
+			map[string]interface{}{"id": toys, "status": float64(http.StatusPreconditionFailed), "error": "product has been modified since it was read"},
+		},
+	}
+	if diff := cmp.Diff(want, report); diff != "" {
+		t.Fatalf("batch update report did not match:\n%s", diff)
+	}
+
+	report = batch("/v1/products/batch/delete", `{"ids": ["`+comics+`", "`+missing+`"]}`)
+
+	items := report["items"].([]interface{})
+	if report["applied"] != float64(0) || items[0].(map[string]interface{})["status"] != float64(http.StatusFailedDependency) {
+		t.Fatalf("expected an atomic delete with a missing product to delete nothing, got %v", report)
+	}
+}
+
+// ImportTooLarge checks an import body over the size limit is refused as too
+// large rather than as malformed.
+func (p *ProductTests) ImportTooLarge(t *testing.T) {
+	body := "[" + strings.Repeat(" ", 10<<20) + "]"
+
+	req := httptest.NewRequest("POST", "/v1/products/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	if http.StatusRequestEntityTooLarge != resp.Code {
+		t.Fatalf("expected status code %v, got %v", http.StatusRequestEntityTooLarge, resp.Code)
+	}
+}
+
+// IdempotentImport sends an import larger than other bodies sent with an
+// idempotency key may be and checks it is handled once and then replayed.
+func (p *ProductTests) IdempotentImport(t *testing.T) {
+	body := `[{"name":"Board Games","cost":{"amount":30,"currency":"INR"},"quantity":5}` + strings.Repeat(" ", 2<<20) + "]"
+
+	send := func() *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/v1/products/import?dry_run=true", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("Idempotency-Key", "import-1")
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := send()
+	if http.StatusOK != first.Code {
+		t.Fatalf("importing: expected status code %v, got %v: %s", http.StatusOK, first.Code, first.Body)
+	}
+
+	retry := send()
+	if http.StatusOK != retry.Code {
+		t.Fatalf("retrying: expected status code %v, got %v", http.StatusOK, retry.Code)
+	}
+	if got := retry.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Fatalf("retrying: expected a replayed response, got header %q", got)
+	}
+	if first.Body.String() != retry.Body.String() {
+		t.Fatalf("retrying: expected the same body, got:\n%s\nthen:\n%s", first.Body, retry.Body)
+	}
+}
+
+// IdempotentSales retries sales sent with an idempotency key and checks only
+// the first one is recorded.
+func (p *ProductTests) IdempotentSales(t *testing.T) {
+	const toys = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+
+	sell := func(key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest("POST", "/v1/products/"+toys+"/sales", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		req.Header.Set("Idempotency-Key", key)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+		return resp
+	}
+
+	quantity := func() float64 {
+		t.Helper()
+
+		req := httptest.NewRequest("GET", "/v1/products/"+toys, nil)
+		req.Header.Set("Authorization", "Bearer "+p.adminToken)
+		resp := httptest.NewRecorder()
+
+		p.app.ServeHTTP(resp, req)
+
+		var product map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+			t.Fatalf("decoding: %s", err)
+		}
+		return product["quantity"].(float64)
+	}
+
+	const sale = `{"quantity":1,"paid":{"amount":75,"currency":"INR"}}`
+	before := quantity()
+
+	first := sell("sale-1", sale)
+	if http.StatusCreated != first.Code {
+		t.Fatalf("selling: expected status code %v, got %v", http.StatusCreated, first.Code)
+	}
+
+	retry := sell("sale-1", sale)
+	if http.StatusCreated != retry.Code {
+		t.Fatalf("retrying: expected status code %v, got %v", http.StatusCreated, retry.Code)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatal("expected the retry to be marked as replayed")
+	}
+	if diff := cmp.Diff(first.Body.String(), retry.Body.String()); diff != "" {
+		t.Fatalf("replayed response did not match:\n%s", diff)
+	}
+
+	if exp, got := before-1, quantity(); exp != got {
+		t.Fatalf("expected quantity %v after one sale, got %v", exp, got)
+	}
+
+	if resp := sell("sale-1", `{"quantity":2,"paid":{"amount":150,"currency":"INR"}}`); http.StatusUnprocessableEntity != resp.Code {
+		t.Fatalf("reusing key: expected status code %v, got %v", http.StatusUnprocessableEntity, resp.Code)
+	}
+
+	// A failed request is not kept so the key can be used to try again.
+	if resp := sell("sale-2", `{"quantity":100000,"paid":{"amount":75,"currency":"INR"}}`); http.StatusConflict != resp.Code {
+		t.Fatalf("selling too many: expected status code %v, got %v", http.StatusConflict, resp.Code)
+	}
+	if resp := sell("sale-2", sale); http.StatusCreated != resp.Code {
+		t.Fatalf("selling after a failure: expected status code %v, got %v", http.StatusCreated, resp.Code)
+	}
+}
+
+// Refunds refunds part of a seeded sale, voids the rest and checks refunds
+// that cannot be made are answered with client errors. The cases run in
+// order as each one depends on what the ones before it refunded.
+func (p *ProductTests) Refunds(t *testing.T) {
+	const (
+		comics  = "/v1/products/a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		sale    = comics + "/sales/85f6fb09-eb05-4874-ae39-82d1a30fe0d7"
+		missing = comics + "/sales/6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11"
+	)
+
+	cases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{"Refund", "POST", sale + "/refunds", `{"quantity":1,"amount":50,"reason":"damaged"}`, http.StatusCreated},
+		{"RefundInvalidID", "POST", comics + "/sales/abc/refunds", `{"quantity":1,"amount":50,"reason":"damaged"}`, http.StatusBadRequest},
+		{"RefundMissingSale", "POST", missing + "/refunds", `{"quantity":1,"amount":50,"reason":"damaged"}`, http.StatusNotFound},
+		{"RefundNothing", "POST", sale + "/refunds", `{"quantity":0,"amount":0,"reason":"damaged"}`, http.StatusBadRequest},
+		{"RefundNoReason", "POST", sale + "/refunds", `{"quantity":1,"amount":50}`, http.StatusBadRequest},
+		{"RefundTooMuch", "POST", sale + "/refunds", `{"quantity":5,"amount":250,"reason":"damaged"}`, http.StatusConflict},
+		{"List", "GET", sale + "/refunds", "", http.StatusOK},
+		{"ListInvalidID", "GET", comics + "/sales/abc/refunds", "", http.StatusBadRequest},
+		{"ListMissingSale", "GET", missing + "/refunds", "", http.StatusNotFound},
+		{"Void", "POST", sale + "/void", `{"reason":"entered twice"}`, http.StatusCreated},
+		{"VoidMissingSale", "POST", missing + "/void", `{"reason":"entered twice"}`, http.StatusNotFound},
+		{"VoidTwice", "POST", sale + "/void", `{"reason":"entered twice"}`, http.StatusConflict},
+		{"RefundVoided", "POST", sale + "/refunds", `{"quantity":1,"amount":50,"reason":"damaged"}`, http.StatusConflict},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+p.adminToken)
+			resp := httptest.NewRecorder()
+
+			p.app.ServeHTTP(resp, req)
+
+			if tc.status != resp.Code {
+				t.Fatalf("expected status code %v, got %v", tc.status, resp.Code)
+			}
+		})
+	}
+
+	// The partial refund and the void that followed it are both listed.
+	req := httptest.NewRequest("GET", sale+"/refunds", nil)
+	req.Header.Set("Authorization", "Bearer "+p.adminToken)
+	resp := httptest.NewRecorder()
+
+	p.app.ServeHTTP(resp, req)
+
+	var refunds []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&refunds); err != nil {
+		t.Fatalf("decoding: %s", err)
+	}
+	if exp, got := 2, len(refunds); exp != got {
+		t.Fatalf("expected %v refunds, got %v", exp, got)
+	}
+	if got := refunds[1]; got["quantity"] != float64(4) || got["void"] != true {
+		t.Fatalf("expected the void to refund the remaining 4 units, got %v", got)
+	}
 }
@@ -8,16 +8,19 @@ import (
 	"testing"
 
 	"github.com/rakshans1/service/cmd/sales-api/internal/handlers"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/notify"
 	"github.com/rakshans1/service/internal/tests"
 )
 
 // TestUsers runs a series of tests to exercise User behavior.
 func TestUsers(t *testing.T) {
-	test := tests.New(t)
-	defer test.Teardown()
+	tests.EachStore(t, testUsers)
+}
 
+func testUsers(t *testing.T, test *tests.Test) {
 	shutdown := make(chan os.Signal, 1)
-	ut := UserTests{app: handlers.API(shutdown, test.DB, test.Log, test.Authenticator)}
+	ut := UserTests{app: handlers.API(shutdown, test.DB, test.Log, test.Authenticator, notify.NewLog(test.Log), test.Products, test.Users, test.Idempotency, invoice.Seller{Name: "Garage Sale"})}
 
 	t.Run("TokenRequireAuth", ut.TokenRequireAuth)
 	t.Run("TokenDenyUnknown", ut.TokenDenyUnknown)
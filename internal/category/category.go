@@ -0,0 +1,214 @@
+package category
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Category is requested but does not
+	// exist.
+	ErrNotFound = errors.New("category not found")
+
+	// ErrInvalidID is used when an invalid UUID is provided.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrParentNotFound is used when a Category is placed under a parent that
+	// does not exist.
+	ErrParentNotFound = errors.New("parent category not found")
+
+	// ErrCycle is used when a Category would be placed under itself or one of
+	// its descendants.
+	ErrCycle = errors.New("category cannot be placed under itself")
+
+	// ErrHasChildren is used when deleting a Category that other categories
+	// are placed under.
+	ErrHasChildren = errors.New("category has child categories")
+)
+
+// SubtreeQuery returns a query for the ids of a category and all of its
+// descendants, for use as a sub select. param is the placeholder holding the
+// id of the category at the top of the subtree.
+func SubtreeQuery(param string) string {
+	return `WITH RECURSIVE tree AS (
+			SELECT category_id FROM categories WHERE category_id = ` + param + `
+			UNION ALL
+			SELECT c.category_id FROM categories AS c
+			JOIN tree AS t ON c.parent_id = t.category_id
+		)
+		SELECT category_id FROM tree`
+}
+
+// List gets all Categories from the database ordered by name.
+func List(ctx context.Context, db *sqlx.DB) ([]Category, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.category.list")
+	defer span.End()
+
+	categories := []Category{}
+
+	const q = `SELECT * FROM categories ORDER BY name, category_id`
+	if err := db.SelectContext(ctx, &categories, q); err != nil {
+		return nil, errors.Wrap(err, "selecting categories")
+	}
+
+	return categories, nil
+}
+
+// Create adds a Category to the database. It returns the created Category
+// with fields like ID and DateCreated populated.
+func Create(ctx context.Context, db *sqlx.DB, nc NewCategory, now time.Time) (*Category, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.category.create")
+	defer span.End()
+
+	c := Category{
+		ID:          uuid.New().String(),
+		ParentID:    nc.ParentID,
+		Name:        nc.Name,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+
+	if c.ParentID != nil {
+		if err := checkParent(ctx, db, c.ID, *c.ParentID); err != nil {
+			return nil, err
+		}
+	}
+
+	const q = `INSERT INTO categories
+		(category_id, parent_id, name, date_created, date_updated)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	if _, err := db.ExecContext(ctx, q, c.ID, c.ParentID, c.Name, c.DateCreated, c.DateUpdated); err != nil {
+		return nil, errors.Wrap(err, "inserting category")
+	}
+
+	return &c, nil
+}
+
+// Get finds the Category identified by a given ID.
+func Get(ctx context.Context, db *sqlx.DB, id string) (*Category, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.category.get")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var c Category
+
+	const q = `SELECT * FROM categories WHERE category_id = $1`
+	if err := db.GetContext(ctx, &c, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single category")
+	}
+
+	return &c, nil
+}
+
+// Update modifies data about a Category. It will error if the specified ID is
+// invalid or does not reference an existing Category, or if the new parent
+// would make the Category its own ancestor.
+func Update(ctx context.Context, db *sqlx.DB, id string, uc UpdateCategory, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.category.update")
+	defer span.End()
+
+	c, err := Get(ctx, db, id)
+	if err != nil {
+		return err
+	}
+
+	if uc.Name != nil {
+		c.Name = *uc.Name
+	}
+	if uc.ParentID != nil {
+		c.ParentID = nil
+		if *uc.ParentID != "" {
+			if err := checkParent(ctx, db, c.ID, *uc.ParentID); err != nil {
+				return err
+			}
+			c.ParentID = uc.ParentID
+		}
+	}
+	c.DateUpdated = now.UTC()
+
+	const q = `UPDATE categories SET
+		"name" = $2,
+		"parent_id" = $3,
+		"date_updated" = $4
+		WHERE category_id = $1`
+
+	if _, err := db.ExecContext(ctx, q, id, c.Name, c.ParentID, c.DateUpdated); err != nil {
+		return errors.Wrap(err, "updating category")
+	}
+
+	return nil
+}
+
+// Delete removes the Category identified by a given ID. Products in it are
+// left without a category. A Category with children cannot be deleted.
+func Delete(ctx context.Context, db *sqlx.DB, id string) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.category.delete")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	const children = `SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)`
+
+	var has bool
+	if err := db.GetContext(ctx, &has, children, id); err != nil {
+		return errors.Wrap(err, "checking child categories")
+	}
+	if has {
+		return ErrHasChildren
+	}
+
+	const q = `DELETE FROM categories WHERE category_id = $1`
+	if _, err := db.ExecContext(ctx, q, id); err != nil {
+		return errors.Wrapf(err, "deleting category %s", id)
+	}
+
+	return nil
+}
+
+// checkParent verifies that parentID exists and is not in the subtree of the
+// category with the given id.
+func checkParent(ctx context.Context, db *sqlx.DB, id, parentID string) error {
+	if _, err := uuid.Parse(parentID); err != nil {
+		return ErrInvalidID
+	}
+
+	const exists = `SELECT EXISTS (SELECT 1 FROM categories WHERE category_id = $1)`
+
+	var found bool
+	if err := db.GetContext(ctx, &found, exists, parentID); err != nil {
+		return errors.Wrap(err, "checking parent category")
+	}
+	if !found {
+		return ErrParentNotFound
+	}
+
+	cycle := `SELECT EXISTS (
+		SELECT 1 FROM (` + SubtreeQuery("$1") + `) AS tree WHERE category_id = $2
+	)`
+
+	var inside bool
+	if err := db.GetContext(ctx, &inside, cycle, id, parentID); err != nil {
+		return errors.Wrap(err, "checking category tree")
+	}
+	if inside {
+		return ErrCycle
+	}
+
+	return nil
+}
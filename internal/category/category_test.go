@@ -0,0 +1,59 @@
+package category_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/category"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestCategories(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	toys, err := category.Create(ctx, db, category.NewCategory{Name: "Toys"}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+
+	kites, err := category.Create(ctx, db, category.NewCategory{Name: "Kites", ParentID: &toys.ID}, now)
+	if err != nil {
+		t.Fatalf("creating child category: %s", err)
+	}
+
+	missing := "d3d9446e-0b1c-4b3a-9d1e-000000000000"
+	if _, err := category.Create(ctx, db, category.NewCategory{Name: "Orphan", ParentID: &missing}, now); err != category.ErrParentNotFound {
+		t.Fatalf("creating under a missing parent: expected %v, got %v", category.ErrParentNotFound, err)
+	}
+
+	// Moving a category under its own child would make a loop.
+	if err := category.Update(ctx, db, toys.ID, category.UpdateCategory{ParentID: &kites.ID}, now); err != category.ErrCycle {
+		t.Fatalf("moving under a child: expected %v, got %v", category.ErrCycle, err)
+	}
+
+	if err := category.Delete(ctx, db, toys.ID); err != category.ErrHasChildren {
+		t.Fatalf("deleting a parent: expected %v, got %v", category.ErrHasChildren, err)
+	}
+
+	// Moving the child to the root frees the parent to be deleted.
+	root := ""
+	if err := category.Update(ctx, db, kites.ID, category.UpdateCategory{ParentID: &root}, now); err != nil {
+		t.Fatalf("moving to the root: %s", err)
+	}
+	if err := category.Delete(ctx, db, toys.ID); err != nil {
+		t.Fatalf("deleting category: %s", err)
+	}
+
+	list, err := category.List(ctx, db)
+	if err != nil {
+		t.Fatalf("listing categories: %s", err)
+	}
+	if len(list) != 1 || list[0].ID != kites.ID || list[0].ParentID != nil {
+		t.Fatalf("expected only the root Kites category, got %+v", list)
+	}
+}
@@ -0,0 +1,3 @@
+// Package category implements all business logic regarding the hierarchy of
+// categories products are classified in.
+package category
@@ -0,0 +1,3 @@
+// Package invoice implements all business logic regarding the numbered
+// invoices issued for sales and orders.
+package invoice
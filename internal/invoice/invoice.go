@@ -0,0 +1,275 @@
+package invoice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Invoice is requested but does not
+	// exist.
+	ErrNotFound = errors.New("invoice not found")
+
+	// ErrInvalidID is used when an invalid UUID is provided.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrInvalidSource is used when an Invoice is asked for with neither or
+	// both of a Sale and an Order.
+	ErrInvalidSource = errors.New("invoice must be for either a sale or an order")
+
+	// ErrSourceNotFound is used when the Sale or Order to invoice does not
+	// exist.
+	ErrSourceNotFound = errors.New("sale or order not found")
+
+	// ErrPartOfOrder is used when a Sale made as a line of an Order is
+	// invoiced on its own.
+	ErrPartOfOrder = errors.New("sale is part of an order, invoice the order instead")
+
+	// ErrAlreadyInvoiced is used when an Invoice has already been issued for
+	// the Sale or Order.
+	ErrAlreadyInvoiced = errors.New("an invoice has already been issued for this sale or order")
+
+	// ErrForbidden occurs when a user asks for the Invoice of a Sale or Order
+	// that is not theirs.
+	ErrForbidden = errors.New("Attempted action is not allowed")
+)
+
+// line is a Sale being invoiced along with what describes it.
+type line struct {
+	SaleID    string      `db:"sale_id"`
+	ProductID string      `db:"product_id"`
+	Name      string      `db:"name"`
+	SKU       *string     `db:"sku"`
+	Quantity  int         `db:"quantity"`
+	UnitPrice string      `db:"unit_price"`
+	Paid      money.Money `db:"paid"`
+	Discount  int         `db:"discount"`
+	UserID    *string     `db:"user_id"`
+	OrderID   *string     `db:"order_id"`
+}
+
+// selectLines reads the Sales to invoice with the names of their Products and
+// the SKUs of their Variants as they are now. The unit price is the list
+// price a promotion was worked out from when one was redeemed. Otherwise it is
+// the cost of the Variant sold, or the cost the Product had in its history
+// when the Sale was made, formatted like money.Money.String.
+const selectLines = `SELECT
+	s.sale_id, s.product_id, p.name, v.sku, s.quantity,
+	CASE
+		WHEN s.expected IS NOT NULL THEN ((s.expected + s.discount) / s.quantity) || ' ' || s.currency
+		WHEN v.variant_id IS NOT NULL THEN v.cost || ' ' || v.currency
+		ELSE COALESCE(
+			(SELECT h.new_value FROM product_history AS h
+			WHERE h.product_id = s.product_id AND h.field = 'cost' AND h.date_changed <= s.date_created
+			ORDER BY h.date_changed DESC LIMIT 1),
+			(SELECT h.old_value FROM product_history AS h
+			WHERE h.product_id = s.product_id AND h.field = 'cost' AND h.date_changed > s.date_created
+			ORDER BY h.date_changed LIMIT 1),
+			p.cost || ' ' || p.currency
+		)
+	END AS unit_price,
+	s.paid AS "paid.amount", s.currency AS "paid.currency",
+	s.discount, s.user_id, s.order_id
+	FROM sales AS s
+	JOIN products AS p ON p.product_id = s.product_id
+	LEFT JOIN variants AS v ON v.variant_id = s.variant_id`
+
+// Create issues an Invoice for a Sale or an Order, taking the next number.
+// Only admins may invoice the Sales and Orders of other users, and each can be
+// invoiced once.
+func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, ni NewInvoice, seller Seller, now time.Time) (*Invoice, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.invoice.create")
+	defer span.End()
+
+	if (ni.SaleID == nil) == (ni.OrderID == nil) {
+		return nil, ErrInvalidSource
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting invoice transaction")
+	}
+	defer tx.Rollback()
+
+	var (
+		lines []line
+		owner *string
+	)
+	if ni.SaleID != nil {
+		lines, owner, err = saleLines(ctx, tx, *ni.SaleID)
+	} else {
+		lines, owner, err = orderLines(ctx, tx, *ni.OrderID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := snapshot(seller, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && (owner == nil || *owner != user.Subject) {
+		return nil, ErrForbidden
+	}
+
+	inv := Invoice{
+		ID:          uuid.New().String(),
+		SaleID:      ni.SaleID,
+		OrderID:     ni.OrderID,
+		UserID:      owner,
+		Snapshot:    snap,
+		DateCreated: now.UTC(),
+	}
+
+	// The counter row stays locked until the transaction ends so invoices are
+	// numbered one at a time, and a rollback hands the number back.
+	const next = `UPDATE invoice_numbers SET last_number = last_number + 1 RETURNING last_number`
+	if err := tx.GetContext(ctx, &inv.Number, next); err != nil {
+		return nil, errors.Wrap(err, "taking invoice number")
+	}
+
+	doc, err := json.Marshal(inv.Snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding invoice snapshot")
+	}
+
+	const q = `INSERT INTO invoices
+		(invoice_id, number, sale_id, order_id, user_id, snapshot, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, q,
+		inv.ID, inv.Number, inv.SaleID, inv.OrderID, inv.UserID, string(doc), inv.DateCreated,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrAlreadyInvoiced
+		}
+		return nil, errors.Wrap(err, "inserting invoice")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing invoice")
+	}
+
+	return &inv, nil
+}
+
+// saleLines reads a Sale to invoice on its own and the user it belongs to.
+func saleLines(ctx context.Context, tx *sqlx.Tx, id string) ([]line, *string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, ErrInvalidID
+	}
+
+	var l line
+	if err := tx.GetContext(ctx, &l, selectLines+` WHERE s.sale_id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrSourceNotFound
+		}
+		return nil, nil, errors.Wrap(err, "selecting sale to invoice")
+	}
+	if l.OrderID != nil {
+		return nil, nil, ErrPartOfOrder
+	}
+
+	return []line{l}, l.UserID, nil
+}
+
+// orderLines reads the Sales of an Order to invoice and the user it belongs
+// to.
+func orderLines(ctx context.Context, tx *sqlx.Tx, id string) ([]line, *string, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, ErrInvalidID
+	}
+
+	var owner *string
+	const q = `SELECT user_id FROM orders WHERE order_id = $1`
+	if err := tx.GetContext(ctx, &owner, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, ErrSourceNotFound
+		}
+		return nil, nil, errors.Wrap(err, "selecting order to invoice")
+	}
+
+	lines := []line{}
+	const items = selectLines + ` WHERE s.order_id = $1 ORDER BY s.line, s.sale_id`
+	if err := tx.SelectContext(ctx, &lines, items, id); err != nil {
+		return nil, nil, errors.Wrap(err, "selecting order sales to invoice")
+	}
+
+	return lines, owner, nil
+}
+
+// snapshot fixes what an Invoice for lines says.
+func snapshot(seller Seller, lines []line) (Snapshot, error) {
+	s := Snapshot{Seller: seller, Lines: make([]Line, len(lines))}
+
+	paid := make([]money.Money, len(lines))
+	for i, l := range lines {
+		unit, err := money.Parse(l.UnitPrice)
+		if err != nil {
+			return Snapshot{}, errors.Wrapf(err, "reading unit price of sale %s", l.SaleID)
+		}
+		subtotal := money.Money{Amount: unit.Amount * l.Quantity, Currency: unit.Currency}
+
+		s.Lines[i] = Line{
+			SaleID:      l.SaleID,
+			ProductID:   l.ProductID,
+			Description: l.Name,
+			Quantity:    l.Quantity,
+			UnitPrice:   &unit,
+			Subtotal:    &subtotal,
+			Amount:      l.Paid,
+		}
+		if l.SKU != nil {
+			s.Lines[i].Description += " (" + *l.SKU + ")"
+		}
+		if l.Discount > 0 {
+			s.Lines[i].Discount = &money.Money{Amount: l.Discount, Currency: l.Paid.Currency}
+		}
+		paid[i] = l.Paid
+	}
+	s.Totals = money.Sum(paid)
+
+	return s, nil
+}
+
+// Get finds the Invoice identified by a given ID. Only admins may see the
+// Invoices of other users.
+func Get(ctx context.Context, db *sqlx.DB, user auth.Claims, id string) (*Invoice, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.invoice.get")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var inv Invoice
+
+	const q = `SELECT invoice_id, number, sale_id, order_id, user_id, snapshot, date_created
+		FROM invoices WHERE invoice_id = $1`
+
+	if err := db.GetContext(ctx, &inv, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single invoice")
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && (inv.UserID == nil || *inv.UserID != user.Subject) {
+		return nil, ErrForbidden
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,107 @@
+package invoice_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestInvoices(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	ctx := context.Background()
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	admin := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+	user := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+	seller := invoice.Seller{Name: "Garage Sale"}
+
+	const (
+		comics     = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		toys       = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+		comicsSale = "98b6d4b8-f04b-4c79-8c2e-a0aef46854b7"
+		toysSale   = "a235be9e-ab5d-44e6-a987-fa1c749264c7"
+	)
+	sale := func(id string) invoice.NewInvoice { return invoice.NewInvoice{SaleID: &id} }
+
+	first, err := invoice.Create(ctx, db, admin, sale(comicsSale), seller, now)
+	if err != nil {
+		t.Fatalf("invoicing sale: %s", err)
+	}
+	want := invoice.Snapshot{
+		Seller: seller,
+		Lines: []invoice.Line{
+			{SaleID: comicsSale, ProductID: comics, Description: "Comic Books", Quantity: 2, UnitPrice: &money.Money{Amount: 50, Currency: "INR"}, Subtotal: &money.Money{Amount: 100, Currency: "INR"}, Amount: money.Money{Amount: 100, Currency: "INR"}},
+		},
+		Totals: money.Totals{{Amount: 100, Currency: "INR"}},
+	}
+	if diff := cmp.Diff(want, first.Snapshot); diff != "" {
+		t.Fatalf("invoice snapshot did not match:\n%s", diff)
+	}
+
+	if _, err := invoice.Create(ctx, db, admin, sale(comicsSale), seller, now); err != invoice.ErrAlreadyInvoiced {
+		t.Fatalf("invoicing twice: expected %v, got %v", invoice.ErrAlreadyInvoiced, err)
+	}
+	if _, err := invoice.Create(ctx, db, user, sale(toysSale), seller, now); err != invoice.ErrForbidden {
+		t.Fatalf("invoicing another user's sale: expected %v, got %v", invoice.ErrForbidden, err)
+	}
+	if _, err := invoice.Create(ctx, db, admin, invoice.NewInvoice{}, seller, now); err != invoice.ErrInvalidSource {
+		t.Fatalf("invoicing nothing: expected %v, got %v", invoice.ErrInvalidSource, err)
+	}
+
+	// Failed attempts must not use up numbers.
+	second, err := invoice.Create(ctx, db, admin, sale(toysSale), seller, now)
+	if err != nil {
+		t.Fatalf("invoicing sale: %s", err)
+	}
+	if exp, got := first.Number+1, second.Number; exp != got {
+		t.Fatalf("expected invoice number %v, got %v", exp, got)
+	}
+
+	no := product.NewOrder{Items: []product.NewOrderItem{
+		{ProductID: comics, Quantity: 1, Paid: money.Money{Amount: 50, Currency: "INR"}},
+		{ProductID: toys, Quantity: 1, Paid: money.Money{Amount: 75, Currency: "INR"}},
+	}}
+	order, err := product.NewPostgres(db, nil).CreateOrder(ctx, admin, no, now)
+	if err != nil {
+		t.Fatalf("creating order: %s", err)
+	}
+
+	if _, err := invoice.Create(ctx, db, admin, sale(order.Items[0].ID), seller, now); err != invoice.ErrPartOfOrder {
+		t.Fatalf("invoicing a line of an order: expected %v, got %v", invoice.ErrPartOfOrder, err)
+	}
+
+	third, err := invoice.Create(ctx, db, admin, invoice.NewInvoice{OrderID: &order.ID}, seller, now)
+	if err != nil {
+		t.Fatalf("invoicing order: %s", err)
+	}
+	if exp, got := 2, len(third.Snapshot.Lines); exp != got {
+		t.Fatalf("expected %v invoice lines, got %v", exp, got)
+	}
+	if diff := cmp.Diff(money.Totals{{Amount: 125, Currency: "INR"}}, third.Snapshot.Totals); diff != "" {
+		t.Fatalf("invoice totals did not match:\n%s", diff)
+	}
+
+	got, err := invoice.Get(ctx, db, admin, third.ID)
+	if err != nil {
+		t.Fatalf("getting invoice: %s", err)
+	}
+	if diff := cmp.Diff(third, got); diff != "" {
+		t.Fatalf("fetched != created:\n%s", diff)
+	}
+	if _, err := invoice.Get(ctx, db, user, third.ID); err != invoice.ErrForbidden {
+		t.Fatalf("getting another user's invoice: expected %v, got %v", invoice.ErrForbidden, err)
+	}
+
+	// Issued invoices cannot be changed, even directly.
+	if _, err := db.ExecContext(ctx, `UPDATE invoices SET number = 99 WHERE invoice_id = $1`, third.ID); err == nil {
+		t.Fatal("expected updating an invoice to fail")
+	}
+}
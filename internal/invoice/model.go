@@ -0,0 +1,83 @@
+package invoice
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/money"
+)
+
+// Invoice is the receipt issued for a Sale or an Order, exactly one of which
+// is set. Numbers are sequential without gaps. UserID is the user the Sale or
+// Order belongs to; only they and admins may see the Invoice.
+type Invoice struct {
+	ID          string    `db:"invoice_id" json:"id"`
+	Number      int64     `db:"number" json:"number"`
+	SaleID      *string   `db:"sale_id" json:"sale_id,omitempty"`
+	OrderID     *string   `db:"order_id" json:"order_id,omitempty"`
+	UserID      *string   `db:"user_id" json:"user_id"`
+	Snapshot    Snapshot  `db:"snapshot" json:"snapshot"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// Snapshot is what an Invoice says, fixed when it is issued so later changes
+// to products or to the seller do not alter it. Totals holds what was paid
+// for all the Lines, per currency.
+type Snapshot struct {
+	Seller Seller       `json:"seller"`
+	Lines  []Line       `json:"lines"`
+	Totals money.Totals `json:"totals"`
+}
+
+// Scan implements the sql.Scanner interface.
+func (s *Snapshot) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into invoice snapshot", src)
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(b, &snapshot); err != nil {
+		return errors.Wrap(err, "decoding invoice snapshot")
+	}
+	*s = snapshot
+	return nil
+}
+
+// Seller is the business issuing Invoices, as printed on them.
+type Seller struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	TaxID   string `json:"tax_id,omitempty"`
+}
+
+// Line is one Sale on an Invoice. Description names the Product, and the SKU
+// of the Variant when one was sold. UnitPrice is the list price of one unit
+// when it was sold and Subtotal that times Quantity. Amount is what was paid
+// for the line and Discount what a promotion took off the Subtotal, in the
+// same currency. Invoices issued before prices were recorded have no
+// UnitPrice or Subtotal.
+type Line struct {
+	SaleID      string       `json:"sale_id"`
+	ProductID   string       `json:"product_id"`
+	Description string       `json:"description"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   *money.Money `json:"unit_price,omitempty"`
+	Subtotal    *money.Money `json:"subtotal,omitempty"`
+	Discount    *money.Money `json:"discount,omitempty"`
+	Amount      money.Money  `json:"amount"`
+}
+
+// NewInvoice is what we require from clients to issue an Invoice: the Sale or
+// the Order it is for, but not both.
+type NewInvoice struct {
+	SaleID  *string `json:"sale_id" validate:"omitempty,uuid"`
+	OrderID *string `json:"order_id" validate:"omitempty,uuid"`
+}
@@ -0,0 +1,93 @@
+package invoice
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// funcs are the helpers both templates format an Invoice with.
+var funcs = map[string]interface{}{
+	"number": func(n int64) string { return fmt.Sprintf("%08d", n) },
+	"date":   func(t time.Time) string { return t.Format("2 January 2006") },
+}
+
+// htmlTemplate lays an Invoice out as a standalone web page. html/template
+// escapes everything taken from the Invoice.
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("invoice.html").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{number .Number}}</title>
+</head>
+<body>
+<h1>Invoice {{number .Number}}</h1>
+<p>
+{{- with .Snapshot.Seller}}
+<strong>{{.Name}}</strong>
+{{- with .Address}}<br>{{.}}{{end}}
+{{- with .TaxID}}<br>Tax ID {{.}}{{end}}
+{{- end}}
+</p>
+<p>Issued {{date .DateCreated}}</p>
+<table>
+<thead>
+<tr><th>Item</th><th>Quantity</th><th>Unit price</th><th>Subtotal</th><th>Discount</th><th>Amount</th></tr>
+</thead>
+<tbody>
+{{- range .Snapshot.Lines}}
+<tr><td>{{.Description}}</td><td>{{.Quantity}}</td><td>{{with .UnitPrice}}{{.}}{{end}}</td><td>{{with .Subtotal}}{{.}}{{end}}</td><td>{{with .Discount}}{{.}}{{end}}</td><td>{{.Amount}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+{{- range .Snapshot.Totals}}
+<tr><th colspan="5">Total</th><td>{{.}}</td></tr>
+{{- end}}
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// textTemplate lays an Invoice out as plain text. Columns are separated by
+// tabs for a tabwriter to align.
+var textTemplate = template.Must(template.New("invoice.txt").Funcs(funcs).Parse(`INVOICE {{number .Number}}
+{{with .Snapshot.Seller}}
+{{.Name}}
+{{- with .Address}}
+{{.}}{{end}}
+{{- with .TaxID}}
+Tax ID {{.}}{{end}}
+{{end}}
+Issued {{date .DateCreated}}
+
+Item	Quantity	Unit price	Subtotal	Discount	Amount
+{{- range .Snapshot.Lines}}
+{{.Description}}	{{.Quantity}}	{{with .UnitPrice}}{{.}}{{end}}	{{with .Subtotal}}{{.}}{{end}}	{{with .Discount}}{{.}}{{end}}	{{.Amount}}
+{{- end}}
+{{- range .Snapshot.Totals}}
+Total					{{.}}
+{{- end}}
+`))
+
+// RenderHTML writes inv to w as an HTML page.
+func RenderHTML(w io.Writer, inv *Invoice) error {
+	if err := htmlTemplate.Execute(w, inv); err != nil {
+		return errors.Wrap(err, "rendering invoice as html")
+	}
+	return nil
+}
+
+// RenderText writes inv to w as plain text.
+func RenderText(w io.Writer, inv *Invoice) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if err := textTemplate.Execute(tw, inv); err != nil {
+		return errors.Wrap(err, "rendering invoice as text")
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,72 @@
+package invoice_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/invoice"
+	"github.com/rakshans1/service/internal/platform/money"
+)
+
+// sample is an Invoice for two lines, one of them discounted.
+func sample() *invoice.Invoice {
+	saleID := "98b6d4b8-f04b-4c79-8c2e-a0aef46854b7"
+	return &invoice.Invoice{
+		ID:     "5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a",
+		Number: 42,
+		SaleID: &saleID,
+		Snapshot: invoice.Snapshot{
+			Seller: invoice.Seller{Name: "Garage <Sale>", Address: "1 Main St"},
+			Lines: []invoice.Line{
+				{Description: "Comic Books", Quantity: 2, UnitPrice: &money.Money{Amount: 50, Currency: "INR"}, Subtotal: &money.Money{Amount: 100, Currency: "INR"}, Amount: money.Money{Amount: 100, Currency: "INR"}},
+				{Description: "McDonalds Toys (TOY-1)", Quantity: 3, UnitPrice: &money.Money{Amount: 75, Currency: "INR"}, Subtotal: &money.Money{Amount: 225, Currency: "INR"}, Discount: &money.Money{Amount: 25, Currency: "INR"}, Amount: money.Money{Amount: 200, Currency: "INR"}},
+			},
+			Totals: money.Totals{{Amount: 300, Currency: "INR"}},
+		},
+		DateCreated: time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := invoice.RenderHTML(&buf, sample()); err != nil {
+		t.Fatalf("rendering: %s", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>Invoice 00000042</title>",
+		"<strong>Garage &lt;Sale&gt;</strong>",
+		"<td>McDonalds Toys (TOY-1)</td><td>3</td><td>75 INR</td><td>225 INR</td><td>25 INR</td><td>200 INR</td>",
+		`<th colspan="5">Total</th><td>300 INR</td>`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected html to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	var buf bytes.Buffer
+	if err := invoice.RenderText(&buf, sample()); err != nil {
+		t.Fatalf("rendering: %s", err)
+	}
+
+	want := `INVOICE 00000042
+
+Garage <Sale>
+1 Main St
+
+Issued 1 January 2019
+
+Item                    Quantity  Unit price  Subtotal  Discount  Amount
+Comic Books             2         50 INR      100 INR             100 INR
+McDonalds Toys (TOY-1)  3         75 INR      225 INR   25 INR    200 INR
+Total                                                             300 INR
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("text did not match, got:\n%s", got)
+	}
+}
@@ -0,0 +1,173 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/idempotency"
+	"github.com/rakshans1/service/internal/platform/web"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// IdempotencyKeyHeader carries the key a client picks for a request it may
+// retry. Replayed responses are marked with IdempotentReplayedHeader.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKey is the length of the longest key accepted.
+const maxIdempotencyKey = 255
+
+// MaxIdempotentBody is the size of the largest request body that can be sent
+// with a key to most routes. Bodies are read into memory to be hashed.
+const MaxIdempotentBody = 1 << 20
+
+// These errors are returned for requests whose key cannot be honored.
+var (
+	errIdempotencyKeyTooLong = web.NewRequestError(
+		errors.New("idempotency key is too long"),
+		http.StatusBadRequest,
+	)
+	errIdempotentBodyTooLarge = web.NewRequestError(
+		errors.New("request body is too large to be sent with an idempotency key"),
+		http.StatusRequestEntityTooLarge,
+	)
+)
+
+// Idempotency makes requests sent with an Idempotency-Key header safe to
+// retry. The first request with a key is handled and its response stored; a
+// repeat of it gets the stored response back without being handled again. A
+// key sent with a different request is refused with 422, and one whose first
+// request is still being handled with 409. Keys are kept per user so it must
+// come after Authenticate. Requests that fail are not stored so they can be
+// retried. Requests without the header are handled as usual. Bodies sent with a
+// key may be up to maxBody bytes; larger ones are refused with 413.
+func Idempotency(log *log.Logger, store idempotency.Store, maxBody int64) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	f := func(after web.Handler) web.Handler {
+
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := global.Tracer("service").Start(ctx, "internal.mid.idempotency")
+			defer span.End()
+
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return after(ctx, w, r)
+			}
+			if len(key) > maxIdempotencyKey {
+				return errIdempotencyKeyTooLong
+			}
+
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			// Keys of different users must not see each other's responses.
+			claims, ok := ctx.Value(auth.Key).(auth.Claims)
+			if !ok {
+				return errors.New("claims missing from context: Idempotency called without/before Authenticate")
+			}
+			key = claims.Subject + ":" + key
+
+			body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+			if err != nil {
+				return err
+			}
+			if int64(len(body)) > maxBody {
+				return errIdempotentBodyTooLarge
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			// The token tells this request's reservation apart from one taken
+			// over by a retry of it after it timed out.
+			hash := requestHash(r, body)
+			token := uuid.New().String()
+			stored, err := store.Begin(ctx, key, hash, token, time.Now())
+			switch err {
+			case nil:
+			case idempotency.ErrKeyReused:
+				return web.NewRequestError(err, http.StatusUnprocessableEntity)
+			case idempotency.ErrInProgress:
+				return web.NewRequestError(err, http.StatusConflict)
+			default:
+				return err
+			}
+
+			if stored != nil {
+				v.StatusCode = stored.Status
+				if stored.ContentType != "" {
+					w.Header().Set("Content-Type", stored.ContentType)
+				}
+				w.Header().Set(IdempotentReplayedHeader, "true")
+				w.WriteHeader(stored.Status)
+				_, err := w.Write(stored.Body)
+				return err
+			}
+
+			rec := responseRecorder{ResponseWriter: w}
+			if err := after(ctx, &rec, r); err != nil {
+				if rerr := store.Release(ctx, key, token); rerr != nil {
+					log.Printf("%s : ERROR : %+v", v.TraceID, rerr)
+				}
+				return err
+			}
+
+			// The response has already gone out so a failure to store it
+			// can only be logged. The key stays reserved until it times out,
+			// unless it already did and was taken over by another request.
+			resp := idempotency.Response{
+				Status:      v.StatusCode,
+				ContentType: w.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+			}
+			switch err := store.Complete(ctx, key, token, resp, time.Now()); err {
+			case nil:
+			case idempotency.ErrNotReserved:
+				log.Printf("%s : ERROR : storing idempotent response for key %q : %v", v.TraceID, r.Header.Get(IdempotencyKeyHeader), err)
+			default:
+				log.Printf("%s : ERROR : %+v", v.TraceID, err)
+			}
+
+			return nil
+		}
+
+		return h
+	}
+
+	return f
+}
+
+// requestHash identifies a request by its method, target and body so a key
+// sent again with a different request can be told apart from a retry.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the body written to a response so it can be
+// stored.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements the io.Writer interface.
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -12,7 +12,8 @@ import (
 )
 
 // Panics recovers from panics and converts the panic to an error so it is
-// reported in Metrics and handled in Errors.
+// reported in Metrics and handled in Errors. http.ErrAbortHandler is passed on
+// so the server drops the connection.
 func Panics(log *log.Logger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
@@ -33,6 +34,13 @@ func Panics(log *log.Logger) web.Middleware {
 			// variable after the fact.
 			defer func() {
 				if r := recover(); r != nil {
+
+					// A handler aborting a response it already started
+					// wants the connection dropped, not an error written.
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+
 					err = errors.Errorf("panic: %v", r)
 
 					// Log the Go stack trace for this panic'd goroutine.
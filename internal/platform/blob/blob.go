@@ -0,0 +1,117 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when there is no blob with the requested key.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrInvalidKey is used when a key is empty or would escape the store.
+	ErrInvalidKey = errors.New("blob key is not valid")
+)
+
+// Store keeps blobs under keys. Keys are slash separated paths like
+// "products/<id>/<name>".
+type Store interface {
+
+	// Put stores the contents of r under key, replacing any blob already
+	// there.
+	Put(ctx context.Context, key string, r io.Reader) error
+
+	// Get opens the blob stored under key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob stored under key. Deleting a key that does not
+	// exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Local is a Store keeping blobs as files under a directory.
+type Local struct {
+	dir string
+}
+
+// NewLocal constructs a Store keeping blobs under dir.
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+// path maps key to a file under the store's directory.
+func (l *Local) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, "..") || clean != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put implements the Store interface. The blob is written to a temporary file
+// first so readers never see a partly written one.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "creating blob directory")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return errors.Wrap(err, "creating blob file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "writing blob")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "closing blob")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "storing blob")
+}
+
+// Get implements the Store interface.
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "opening blob")
+	}
+
+	return f, nil
+}
+
+// Delete implements the Store interface.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "deleting blob")
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package blob_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rakshans1/service/internal/platform/blob"
+)
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	s := blob.NewLocal(dir)
+
+	const key = "products/1/manual.pdf"
+	if err := s.Put(ctx, key, strings.NewReader("first")); err != nil {
+		t.Fatalf("putting blob: %s", err)
+	}
+	if err := s.Put(ctx, key, strings.NewReader("second")); err != nil {
+		t.Fatalf("replacing blob: %s", err)
+	}
+
+	rc, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("getting blob: %s", err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading blob: %s", err)
+	}
+	if exp, got := "second", string(b); exp != got {
+		t.Fatalf("expected blob %q, got %q", exp, got)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting blob: %s", err)
+	}
+	if _, err := s.Get(ctx, key); err != blob.ErrNotFound {
+		t.Fatalf("getting deleted blob: expected %v, got %v", blob.ErrNotFound, err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("deleting missing blob: %s", err)
+	}
+
+	for _, bad := range []string{"", "/", "../outside", "products/../../outside", "/products/1", "products//1"} {
+		if err := s.Put(ctx, bad, strings.NewReader("x")); err != blob.ErrInvalidKey {
+			t.Fatalf("putting key %q: expected %v, got %v", bad, blob.ErrInvalidKey, err)
+		}
+	}
+}
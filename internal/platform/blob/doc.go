@@ -0,0 +1,4 @@
+// Package blob stores files, such as uploaded images, outside the database. A
+// Store hides where they are kept so the local filesystem used in development
+// can be swapped for an object store like S3.
+package blob
@@ -0,0 +1,4 @@
+// Package idempotency remembers the responses to requests sent with an
+// idempotency key so a client retrying one gets the original response instead
+// of repeating its effect. A Store hides where the responses are kept.
+package idempotency
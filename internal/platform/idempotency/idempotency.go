@@ -0,0 +1,186 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrKeyReused is used when a key arrives again with a different request
+	// than the one it was first used for.
+	ErrKeyReused = errors.New("idempotency key was already used for a different request")
+
+	// ErrInProgress is used when a key arrives again while the request it was
+	// first used for is still being handled.
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+
+	// ErrNotReserved is used when a response is stored for a key that is no
+	// longer reserved for the request, such as when the reservation timed out
+	// and the key was taken over.
+	ErrNotReserved = errors.New("idempotency key is no longer reserved for this request")
+)
+
+// PendingTimeout is how long a key stays reserved for a request that has not
+// finished. A key left behind by a request that never finished, such as when
+// the service stopped, can be used again after it. It is well beyond the
+// slowest request sent with a key, a bulk import, so a request that is still
+// running does not lose its reservation.
+const PendingTimeout = 10 * time.Minute
+
+// Response is what was sent back for a request, to be replayed for repeats.
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the responses to requests by their idempotency key for a
+// window after they were sent.
+type Store interface {
+
+	// Begin reserves key for a request whose contents hash to hash, tagging
+	// the reservation with token, which must be unique to the request. It
+	// returns a nil Response if the request should be handled, or the stored
+	// Response if the same request was already handled with key.
+	Begin(ctx context.Context, key, hash, token string, now time.Time) (*Response, error)
+
+	// Complete stores the Response to the request key was reserved for, which
+	// must still be the reservation tagged with token. Otherwise nothing is
+	// stored and ErrNotReserved is returned.
+	Complete(ctx context.Context, key, token string, r Response, now time.Time) error
+
+	// Release gives up the reservation of key tagged with token for a request
+	// that failed so it can be retried. A reservation that was taken over by
+	// another request is left alone.
+	Release(ctx context.Context, key, token string) error
+}
+
+// Postgres is a Store keeping responses in the idempotency_keys table.
+type Postgres struct {
+	db     *sqlx.DB
+	window time.Duration
+}
+
+// NewPostgres constructs a Store keeping responses in db for window.
+func NewPostgres(db *sqlx.DB, window time.Duration) *Postgres {
+	return &Postgres{db: db, window: window}
+}
+
+// Begin implements the Store interface. A key whose reservation or response
+// has expired is taken over as if it were new.
+func (pg *Postgres) Begin(ctx context.Context, key, hash, token string, now time.Time) (*Response, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.platform.idempotency.begin")
+	defer span.End()
+
+	const reserve = `INSERT INTO idempotency_keys (key, request_hash, reservation, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			reservation = EXCLUDED.reservation,
+			status = NULL,
+			content_type = NULL,
+			body = NULL,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= $5`
+
+	res, err := pg.db.ExecContext(ctx, reserve, key, hash, token, now.Add(PendingTimeout).UTC(), now.UTC())
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving idempotency key")
+	}
+	reserved, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "reserving idempotency key")
+	}
+	if reserved == 1 {
+		return nil, nil
+	}
+
+	var row struct {
+		Hash        string         `db:"request_hash"`
+		Status      sql.NullInt64  `db:"status"`
+		ContentType sql.NullString `db:"content_type"`
+		Body        []byte         `db:"body"`
+	}
+
+	const q = `SELECT request_hash, status, content_type, body
+		FROM idempotency_keys WHERE key = $1`
+
+	if err := pg.db.GetContext(ctx, &row, q, key); err != nil {
+		if err == sql.ErrNoRows {
+			// The key was released between the two statements.
+			return nil, ErrInProgress
+		}
+		return nil, errors.Wrap(err, "selecting idempotency key")
+	}
+
+	switch {
+	case row.Hash != hash:
+		return nil, ErrKeyReused
+	case !row.Status.Valid:
+		return nil, ErrInProgress
+	}
+
+	return &Response{
+		Status:      int(row.Status.Int64),
+		ContentType: row.ContentType.String,
+		Body:        row.Body,
+	}, nil
+}
+
+// Complete implements the Store interface.
+func (pg *Postgres) Complete(ctx context.Context, key, token string, r Response, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.platform.idempotency.complete")
+	defer span.End()
+
+	const q = `UPDATE idempotency_keys SET
+		status = $3, content_type = $4, body = $5, expires_at = $6
+		WHERE key = $1 AND reservation = $2 AND status IS NULL`
+
+	res, err := pg.db.ExecContext(ctx, q, key, token, r.Status, r.ContentType, r.Body, now.Add(pg.window).UTC())
+	if err != nil {
+		return errors.Wrap(err, "storing idempotent response")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "storing idempotent response")
+	}
+	if n == 0 {
+		return ErrNotReserved
+	}
+	return nil
+}
+
+// Release implements the Store interface.
+func (pg *Postgres) Release(ctx context.Context, key, token string) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.platform.idempotency.release")
+	defer span.End()
+
+	const q = `DELETE FROM idempotency_keys
+		WHERE key = $1 AND reservation = $2 AND status IS NULL`
+
+	if _, err := pg.db.ExecContext(ctx, q, key, token); err != nil {
+		return errors.Wrap(err, "releasing idempotency key")
+	}
+	return nil
+}
+
+// Prune deletes the keys that expired by now and reports how many there were.
+// Expired keys are never replayed, this only reclaims their space.
+func (pg *Postgres) Prune(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.platform.idempotency.prune")
+	defer span.End()
+
+	const q = `DELETE FROM idempotency_keys WHERE expires_at <= $1`
+
+	res, err := pg.db.ExecContext(ctx, q, now.UTC())
+	if err != nil {
+		return 0, errors.Wrap(err, "pruning idempotency keys")
+	}
+	return res.RowsAffected()
+}
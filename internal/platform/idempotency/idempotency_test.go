@@ -0,0 +1,99 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/platform/idempotency"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestStore(t *testing.T) {
+	t.Run("Postgres", func(t *testing.T) {
+		db, teardown := tests.NewUnit(t)
+		defer teardown()
+
+		testStore(t, idempotency.NewPostgres(db, time.Hour))
+	})
+	t.Run("Memory", func(t *testing.T) {
+		testStore(t, idempotency.NewMemory(time.Hour))
+	})
+}
+
+func testStore(t *testing.T, store idempotency.Store) {
+	ctx := context.Background()
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	begin := func(key, hash, token string, at time.Time) (*idempotency.Response, error) {
+		t.Helper()
+		return store.Begin(ctx, key, hash, token, at)
+	}
+
+	if r, err := begin("a", "hash", "1", now); r != nil || err != nil {
+		t.Fatalf("beginning a new key: expected nothing, got %+v, %v", r, err)
+	}
+	if _, err := begin("a", "hash", "2", now); err != idempotency.ErrInProgress {
+		t.Fatalf("repeating an unfinished request: expected %v, got %v", idempotency.ErrInProgress, err)
+	}
+	if _, err := begin("a", "other", "3", now); err != idempotency.ErrKeyReused {
+		t.Fatalf("reusing a key: expected %v, got %v", idempotency.ErrKeyReused, err)
+	}
+
+	want := idempotency.Response{Status: 201, ContentType: "application/json", Body: []byte(`{"id":"1"}`)}
+	if err := store.Complete(ctx, "a", "2", want, now); err != idempotency.ErrNotReserved {
+		t.Fatalf("completing for another request: expected %v, got %v", idempotency.ErrNotReserved, err)
+	}
+	if err := store.Complete(ctx, "a", "1", want, now); err != nil {
+		t.Fatalf("completing: %s", err)
+	}
+	if err := store.Complete(ctx, "a", "1", want, now); err != idempotency.ErrNotReserved {
+		t.Fatalf("completing twice: expected %v, got %v", idempotency.ErrNotReserved, err)
+	}
+
+	got, err := begin("a", "hash", "4", now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("repeating a finished request: %s", err)
+	}
+	if diff := cmp.Diff(want, *got); diff != "" {
+		t.Fatalf("stored response did not match:\n%s", diff)
+	}
+	if _, err := begin("a", "other", "5", now.Add(time.Minute)); err != idempotency.ErrKeyReused {
+		t.Fatalf("reusing a finished key: expected %v, got %v", idempotency.ErrKeyReused, err)
+	}
+
+	// Once the window has passed the key is new again.
+	if r, err := begin("a", "other", "6", now.Add(time.Hour)); r != nil || err != nil {
+		t.Fatalf("beginning an expired key: expected nothing, got %+v, %v", r, err)
+	}
+
+	// A released key can be used again right away.
+	if err := store.Release(ctx, "a", "6"); err != nil {
+		t.Fatalf("releasing: %s", err)
+	}
+	if r, err := begin("a", "hash", "7", now.Add(time.Hour)); r != nil || err != nil {
+		t.Fatalf("beginning a released key: expected nothing, got %+v, %v", r, err)
+	}
+
+	// A reservation left behind by a request that never finished times out.
+	later := now.Add(time.Hour + idempotency.PendingTimeout)
+	if r, err := begin("a", "hash", "8", later); r != nil || err != nil {
+		t.Fatalf("beginning an abandoned key: expected nothing, got %+v, %v", r, err)
+	}
+
+	// The request that lost it can neither release nor complete the
+	// reservation that took it over.
+	if err := store.Release(ctx, "a", "7"); err != nil {
+		t.Fatalf("releasing a lost reservation: %s", err)
+	}
+	if _, err := begin("a", "hash", "9", later); err != idempotency.ErrInProgress {
+		t.Fatalf("repeating after a stale release: expected %v, got %v", idempotency.ErrInProgress, err)
+	}
+	if err := store.Complete(ctx, "a", "7", want, later); err != idempotency.ErrNotReserved {
+		t.Fatalf("completing a lost reservation: expected %v, got %v", idempotency.ErrNotReserved, err)
+	}
+	if err := store.Complete(ctx, "a", "8", want, later); err != nil {
+		t.Fatalf("completing the reservation that took over: %s", err)
+	}
+}
@@ -0,0 +1,85 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// entry is a key kept by Memory. A nil response means the request it was
+// reserved for has not finished.
+type entry struct {
+	hash     string
+	token    string
+	response *Response
+	expires  time.Time
+}
+
+// Memory is a Store keeping responses in memory, for tests and for running the
+// service without a database.
+type Memory struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	keys map[string]entry
+}
+
+// NewMemory constructs a Store keeping responses in memory for window.
+func NewMemory(window time.Duration) *Memory {
+	return &Memory{window: window, keys: make(map[string]entry)}
+}
+
+// Begin implements the Store interface. Expired keys are dropped as it goes
+// since there is nothing else to prune them.
+func (m *Memory) Begin(ctx context.Context, key, hash, token string, now time.Time) (*Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, e := range m.keys {
+		if !e.expires.After(now) {
+			delete(m.keys, k)
+		}
+	}
+
+	e, ok := m.keys[key]
+	switch {
+	case !ok:
+		m.keys[key] = entry{hash: hash, token: token, expires: now.Add(PendingTimeout)}
+		return nil, nil
+	case e.hash != hash:
+		return nil, ErrKeyReused
+	case e.response == nil:
+		return nil, ErrInProgress
+	}
+
+	r := *e.response
+	r.Body = append([]byte(nil), r.Body...)
+	return &r, nil
+}
+
+// Complete implements the Store interface.
+func (m *Memory) Complete(ctx context.Context, key, token string, r Response, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.keys[key]
+	if !ok || e.token != token || e.response != nil {
+		return ErrNotReserved
+	}
+	r.Body = append([]byte(nil), r.Body...)
+	e.response = &r
+	e.expires = now.Add(m.window)
+	m.keys[key] = e
+	return nil
+}
+
+// Release implements the Store interface.
+func (m *Memory) Release(ctx context.Context, key, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.keys[key]; ok && e.token == token && e.response == nil {
+		delete(m.keys, key)
+	}
+	return nil
+}
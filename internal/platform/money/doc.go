@@ -0,0 +1,2 @@
+// Package money provides amounts of money tagged with their currency.
+package money
@@ -0,0 +1,106 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Money is an amount in the minor unit of its currency, such as paise for INR
+// or cents for USD, along with the ISO 4217 code of the currency. Amounts in
+// different currencies must never be added together.
+type Money struct {
+	Amount   int    `db:"amount" json:"amount" validate:"gte=0"`
+	Currency string `db:"currency" json:"currency" validate:"required,iso4217"`
+}
+
+// String formats m as the amount in minor units followed by the currency
+// code, such as "1999 USD".
+func (m Money) String() string {
+	return strconv.Itoa(m.Amount) + " " + m.Currency
+}
+
+// Parse reads Money in the form produced by String.
+func Parse(s string) (Money, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return Money{}, errors.Errorf("money %q must be an amount and a currency", s)
+	}
+	n, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Money{}, errors.Errorf("money %q must have an integer amount", s)
+	}
+	if !IsCurrency(parts[1]) {
+		return Money{}, errors.Errorf("money %q has an unknown currency", s)
+	}
+	return Money{Amount: n, Currency: parts[1]}, nil
+}
+
+// Totals holds one sum per currency for aggregates of Money, such as the
+// revenue of a product sold in several currencies. It is read from the JSON
+// array the database builds for the aggregate.
+type Totals []Money
+
+// Scan implements the sql.Scanner interface.
+func (t *Totals) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*t = Totals{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into money totals", src)
+	}
+
+	totals := Totals{}
+	if err := json.Unmarshal(b, &totals); err != nil {
+		return errors.Wrap(err, "decoding money totals")
+	}
+	*t = totals
+	return nil
+}
+
+// Sum adds up amounts per currency. The totals are ordered by currency code,
+// as they are when the database builds them.
+func Sum(ms []Money) Totals {
+	totals := Totals{}
+	for _, m := range ms {
+		i := sort.Search(len(totals), func(i int) bool { return totals[i].Currency >= m.Currency })
+		if i < len(totals) && totals[i].Currency == m.Currency {
+			totals[i].Amount += m.Amount
+			continue
+		}
+		totals = append(totals, Money{})
+		copy(totals[i+1:], totals[i:])
+		totals[i] = m
+	}
+	return totals
+}
+
+// In gives the total in the currency with the given code, which is zero when
+// there is none.
+func (t Totals) In(currency string) int {
+	for _, m := range t {
+		if m.Currency == currency {
+			return m.Amount
+		}
+	}
+	return 0
+}
+
+// String formats the totals as their String forms separated by semicolons.
+func (t Totals) String() string {
+	s := make([]string, len(t))
+	for i, m := range t {
+		s[i] = m.String()
+	}
+	return strings.Join(s, ";")
+}
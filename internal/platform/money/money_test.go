@@ -0,0 +1,64 @@
+package money_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/platform/money"
+)
+
+func TestParse(t *testing.T) {
+	m := money.Money{Amount: 1999, Currency: "USD"}
+
+	got, err := money.Parse(m.String())
+	if err != nil {
+		t.Fatalf("parsing %q: %s", m, err)
+	}
+	if got != m {
+		t.Fatalf("expected %v, got %v", m, got)
+	}
+
+	for _, s := range []string{"", "1999", "19.99 USD", "1999 XYZ", "1999 usd"} {
+		if _, err := money.Parse(s); err == nil {
+			t.Fatalf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestTotals(t *testing.T) {
+	var totals money.Totals
+	if err := totals.Scan([]byte(`[{"amount":350,"currency":"INR"},{"amount":20,"currency":"USD"}]`)); err != nil {
+		t.Fatalf("scanning totals: %s", err)
+	}
+
+	want := money.Totals{{Amount: 350, Currency: "INR"}, {Amount: 20, Currency: "USD"}}
+	if diff := cmp.Diff(want, totals); diff != "" {
+		t.Fatalf("scanned totals did not match:\n%s", diff)
+	}
+	if exp, got := 20, totals.In("USD"); exp != got {
+		t.Fatalf("expected %v USD, got %v", exp, got)
+	}
+	if exp, got := 0, totals.In("EUR"); exp != got {
+		t.Fatalf("expected %v EUR, got %v", exp, got)
+	}
+	if exp, got := "350 INR;20 USD", totals.String(); exp != got {
+		t.Fatalf("expected %q, got %q", exp, got)
+	}
+}
+
+func TestSum(t *testing.T) {
+	ms := []money.Money{
+		{Amount: 20, Currency: "USD"},
+		{Amount: 100, Currency: "INR"},
+		{Amount: 5, Currency: "USD"},
+		{Amount: 7, Currency: "EUR"},
+	}
+
+	want := money.Totals{{Amount: 7, Currency: "EUR"}, {Amount: 100, Currency: "INR"}, {Amount: 25, Currency: "USD"}}
+	if diff := cmp.Diff(want, money.Sum(ms)); diff != "" {
+		t.Fatalf("summed totals did not match:\n%s", diff)
+	}
+	if diff := cmp.Diff(money.Totals{}, money.Sum(nil)); diff != "" {
+		t.Fatalf("expected empty totals for no amounts:\n%s", diff)
+	}
+}
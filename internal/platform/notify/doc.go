@@ -0,0 +1,4 @@
+// Package notify delivers notifications about events in the system to people
+// or other services. A Notifier hides where they end up, such as a log, a
+// webhook or a file.
+package notify
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Notification is one event to deliver. Kind names the type of event and Data
+// holds its details, which must encode to JSON.
+type Notification struct {
+	ID   string      `json:"id"`
+	Kind string      `json:"kind"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Notifier delivers Notifications. A Notification that could not be delivered
+// is reported with an error so it can be tried again later, which means it may
+// be delivered more than once; receivers can use its ID to tell.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Log is a Notifier that writes Notifications to a logger.
+type Log struct {
+	log *log.Logger
+}
+
+// NewLog constructs a Notifier writing to log.
+func NewLog(log *log.Logger) *Log {
+	return &Log{log: log}
+}
+
+// Notify implements the Notifier interface.
+func (l *Log) Notify(ctx context.Context, n Notification) error {
+	b, err := json.Marshal(n.Data)
+	if err != nil {
+		return errors.Wrap(err, "encoding notification")
+	}
+	l.log.Printf("notify : %s : %s : %s", n.Kind, n.ID, b)
+	return nil
+}
+
+// Webhook is a Notifier that POSTs each Notification as JSON to a URL. Any
+// response other than a 2xx status is a failed delivery.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook constructs a Notifier posting to url with client.
+func NewWebhook(url string, client *http.Client) *Webhook {
+	return &Webhook{url: url, client: client}
+}
+
+// Notify implements the Notifier interface.
+func (w *Webhook) Notify(ctx context.Context, n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return errors.Wrap(err, "encoding notification")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "creating webhook request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "calling webhook")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Outbox is a Notifier that appends each Notification as a line of JSON to a
+// file. It is meant for tests and local development, where the file can be
+// read back to see what would have been sent.
+type Outbox struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewOutbox constructs a Notifier appending to the file at path, which is
+// created if it does not exist.
+func NewOutbox(path string) *Outbox {
+	return &Outbox{path: path}
+}
+
+// Notify implements the Notifier interface.
+func (o *Outbox) Notify(ctx context.Context, n Notification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return errors.Wrap(err, "encoding notification")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "opening outbox")
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return errors.Wrap(err, "writing to outbox")
+	}
+
+	return errors.Wrap(f.Close(), "closing outbox")
+}
+
+// ReadOutbox reads back the Notifications written to the file at path by an
+// Outbox, with their Data decoded as generic JSON values.
+func ReadOutbox(path string) ([]Notification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "opening outbox")
+	}
+	defer f.Close()
+
+	var ns []Notification
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var n Notification
+		if err := dec.Decode(&n); err != nil {
+			return nil, errors.Wrap(err, "decoding outbox")
+		}
+		ns = append(ns, n)
+	}
+
+	return ns, nil
+}
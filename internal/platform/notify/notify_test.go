@@ -0,0 +1,73 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/notify"
+)
+
+func TestOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatalf("creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "outbox.ndjson")
+	o := notify.NewOutbox(path)
+
+	at := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"1", "2"} {
+		n := notify.Notification{ID: id, Kind: "test", Time: at, Data: map[string]int{"quantity": 3}}
+		if err := o.Notify(context.Background(), n); err != nil {
+			t.Fatalf("notifying: %s", err)
+		}
+	}
+
+	ns, err := notify.ReadOutbox(path)
+	if err != nil {
+		t.Fatalf("reading outbox: %s", err)
+	}
+	if exp, got := 2, len(ns); exp != got {
+		t.Fatalf("expected %v notifications, got %v", exp, got)
+	}
+	if n := ns[1]; n.ID != "2" || n.Kind != "test" || !n.Time.Equal(at) {
+		t.Fatalf("unexpected notification read back: %+v", n)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got notify.Notification
+	status := http.StatusNoContent
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding webhook body: %s", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	wh := notify.NewWebhook(srv.URL, srv.Client())
+
+	n := notify.Notification{ID: "1", Kind: "test", Time: time.Now().UTC()}
+	if err := wh.Notify(context.Background(), n); err != nil {
+		t.Fatalf("notifying: %s", err)
+	}
+	if got.ID != n.ID || got.Kind != n.Kind {
+		t.Fatalf("expected %+v to be posted, got %+v", n, got)
+	}
+
+	status = http.StatusInternalServerError
+	if err := wh.Notify(context.Background(), n); err == nil {
+		t.Fatal("expected a failed delivery to be reported")
+	}
+}
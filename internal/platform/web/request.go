@@ -11,7 +11,9 @@ import (
 	ut "github.com/go-playground/universal-translator"
 	validator "github.com/go-playground/validator/v10"
 	en_translations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/money"
 )
 
 // validate holds the settings and caches for validating request struct values.
@@ -32,6 +34,40 @@ func init() {
 	lang, _ := translator.GetTranslator("en")
 	en_translations.RegisterDefaultTranslations(validate, lang)
 
+	// Check currency codes against ISO 4217 with a message to match.
+	validate.RegisterValidation("iso4217", func(fl validator.FieldLevel) bool {
+		return money.IsCurrency(fl.Field().String())
+	})
+	validate.RegisterTranslation("iso4217", lang,
+		func(ut ut.Translator) error {
+			return ut.Add("iso4217", "{0} must be an ISO 4217 currency code", true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("iso4217", fe.Field())
+			return t
+		},
+	)
+
+	// Accept a UUID or an empty string, for optional references that are
+	// cleared by sending them blank.
+	validate.RegisterValidation("uuid_or_empty", func(fl validator.FieldLevel) bool {
+		s := fl.Field().String()
+		if s == "" {
+			return true
+		}
+		_, err := uuid.Parse(s)
+		return err == nil
+	})
+	validate.RegisterTranslation("uuid_or_empty", lang,
+		func(ut ut.Translator) error {
+			return ut.Add("uuid_or_empty", "{0} must be a valid UUID or empty", true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("uuid_or_empty", fe.Field())
+			return t
+		},
+	)
+
 	// Use JSON tag names for errors instead of Go struct names.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
@@ -58,6 +94,12 @@ func Decode(r *http.Request, val interface{}) error {
 		return NewRequestError(err, http.StatusBadRequest)
 	}
 
+	return Validate(val)
+}
+
+// Validate checks the provided struct value against its validation tags. A
+// failure is returned as an *Error listing the problem with each field.
+func Validate(val interface{}) error {
 	if err := validate.Struct(val); err != nil {
 		// Use a type assertion to get the real error value.
 		verrors, ok := err.(validator.ValidationErrors)
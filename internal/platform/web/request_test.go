@@ -23,3 +23,44 @@ func TestDecode(t *testing.T) {
 
 	t.Log(err)
 }
+
+func TestValidateCurrency(t *testing.T) {
+	type price struct {
+		Currency string `json:"currency" validate:"iso4217"`
+	}
+
+	if err := Validate(&price{Currency: "EUR"}); err != nil {
+		t.Fatalf("expected EUR to be valid, got %v", err)
+	}
+
+	err := Validate(&price{Currency: "XYZ"})
+	verr, ok := err.(*Error)
+	if !ok || len(verr.Fields) != 1 {
+		t.Fatalf("expected one field error for XYZ, got %v", err)
+	}
+	if exp, got := "currency must be an ISO 4217 currency code", verr.Fields[0].Error; exp != got {
+		t.Fatalf("expected error %q, got %q", exp, got)
+	}
+}
+
+func TestValidateUUIDOrEmpty(t *testing.T) {
+	type update struct {
+		ParentID *string `json:"parent_id" validate:"omitempty,uuid_or_empty"`
+	}
+
+	for _, id := range []string{"", "a224a8d6-3f9e-4b11-9900-e81a25d80702"} {
+		if err := Validate(&update{ParentID: &id}); err != nil {
+			t.Fatalf("expected %q to be valid, got %v", id, err)
+		}
+	}
+
+	bad := "not-a-uuid"
+	err := Validate(&update{ParentID: &bad})
+	verr, ok := err.(*Error)
+	if !ok || len(verr.Fields) != 1 {
+		t.Fatalf("expected one field error for %q, got %v", bad, err)
+	}
+	if exp, got := "parent_id must be a valid UUID or empty", verr.Fields[0].Error; exp != got {
+		t.Fatalf("expected error %q, got %q", exp, got)
+	}
+}
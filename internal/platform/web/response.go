@@ -40,6 +40,25 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	return nil
 }
 
+// RespondStream starts a response whose body the caller writes directly to w,
+// for payloads too large to marshal in one go. It records the status code and
+// sends the headers; after it returns errors can no longer change the status.
+func RespondStream(ctx context.Context, w http.ResponseWriter, contentType string, statusCode int) error {
+
+	// Set the status code for the request logger middleware.
+	// If the context is missing this value, request the service
+	// to be shutdown gracefully.
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = statusCode
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	return nil
+}
+
 // RespondError sends an error response back to the client.
 func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
 
@@ -0,0 +1,336 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/blob"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors for attachments.
+var (
+	// ErrAttachmentNotFound is used when a specific Attachment, or its
+	// thumbnail, is requested but does not exist for the given Product.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+
+	// ErrFileTooLarge is used when an uploaded file is over the size allowed
+	// for its kind of Attachment.
+	ErrFileTooLarge = errors.New("file is too large")
+
+	// ErrUnsupportedType is used when an uploaded file is not of a type allowed
+	// for its kind of Attachment.
+	ErrUnsupportedType = errors.New("file type is not allowed for this attachment")
+
+	// ErrInvalidImage is used when an uploaded image cannot be decoded.
+	ErrInvalidImage = errors.New("image could not be read")
+)
+
+// MaxAttachmentSize is the size of the largest file any kind of Attachment
+// allows.
+const MaxAttachmentSize = 20 << 20
+
+// attachmentRule limits what can be uploaded as one kind of Attachment.
+type attachmentRule struct {
+	maxSize int64
+	types   map[string]bool
+}
+
+// attachmentRules holds the limits for each kind of Attachment. The type of a
+// file is detected from its contents, not taken from the client.
+var attachmentRules = map[string]attachmentRule{
+	AttachmentImage: {
+		maxSize: 5 << 20,
+		types:   map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true},
+	},
+	AttachmentDocument: {
+		maxSize: MaxAttachmentSize,
+		types:   map[string]bool{"application/pdf": true, "text/plain": true},
+	},
+}
+
+// attachmentColumns are the columns read for an Attachment from the
+// attachments table aliased as a. Download URLs are built from the ids.
+const attachmentColumns = `
+	a.attachment_id, a.product_id, a.kind, a.filename, a.content_type, a.size,
+	'/v1/products/' || a.product_id || '/attachments/' || a.attachment_id AS url,
+	CASE WHEN a.has_thumbnail
+		THEN '/v1/products/' || a.product_id || '/attachments/' || a.attachment_id || '/thumbnail'
+	END AS thumbnail_url,
+	a.user_id, a.date_created`
+
+// Scan implements the sql.Scanner interface.
+func (a *Attachments) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*a = Attachments{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into attachments", src)
+	}
+
+	attachments := Attachments{}
+	if err := json.Unmarshal(b, &attachments); err != nil {
+		return errors.Wrap(err, "decoding attachments")
+	}
+	*a = attachments
+	return nil
+}
+
+// blobKey is where the file of an Attachment is kept in the blob store.
+func blobKey(productID, id string) string {
+	return "products/" + productID + "/" + id
+}
+
+// thumbnailKey is where the thumbnail of an image Attachment is kept.
+func thumbnailKey(productID, id string) string {
+	return blobKey(productID, id) + "-thumbnail"
+}
+
+// AddAttachment uploads a file read from r and attaches it to a Product as the
+// given kind of Attachment. The file is checked against the size and types
+// allowed for the kind; images get a thumbnail as well.
+func (pg *Postgres) AddAttachment(ctx context.Context, user auth.Claims, productID, kind, filename string, r io.Reader, now time.Time) (*Attachment, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.addattachment")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	rule, ok := attachmentRules[kind]
+	if !ok {
+		return nil, errors.Errorf("unknown attachment kind %q", kind)
+	}
+
+	const exists = `SELECT EXISTS (
+		SELECT 1 FROM products WHERE product_id = $1 AND deleted_at IS NULL
+	)`
+
+	var found bool
+	if err := pg.db.GetContext(ctx, &found, exists, productID); err != nil {
+		return nil, errors.Wrap(err, "checking product")
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	data, contentType, thumb, err := readUpload(r, kind, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	if err := storeUpload(ctx, pg.blobs, productID, id, data, thumb); err != nil {
+		return nil, err
+	}
+
+	const q = `INSERT INTO attachments
+		(attachment_id, product_id, kind, filename, content_type, size, has_thumbnail, user_id, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = pg.db.ExecContext(ctx, q,
+		id, productID, kind, cleanFilename(filename), contentType, len(data), thumb != nil,
+		user.Subject, now.UTC(),
+	)
+	if err != nil {
+		pg.blobs.Delete(ctx, blobKey(productID, id))
+		pg.blobs.Delete(ctx, thumbnailKey(productID, id))
+		return nil, errors.Wrap(err, "inserting attachment")
+	}
+
+	return pg.GetAttachment(ctx, productID, id)
+}
+
+// readUpload reads a file uploaded as the given kind of Attachment and checks
+// it against rule. Images are given a thumbnail.
+func readUpload(r io.Reader, kind string, rule attachmentRule) ([]byte, string, []byte, error) {
+	// Read one byte past the limit to tell a file at the limit from one over.
+	data, err := ioutil.ReadAll(io.LimitReader(r, rule.maxSize+1))
+	if err != nil {
+		return nil, "", nil, errors.Wrap(err, "reading upload")
+	}
+	if int64(len(data)) > rule.maxSize {
+		return nil, "", nil, ErrFileTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if mt, _, err := mime.ParseMediaType(contentType); err != nil || !rule.types[mt] {
+		return nil, "", nil, ErrUnsupportedType
+	}
+
+	var thumb []byte
+	if kind == AttachmentImage {
+		if thumb, err = thumbnail(data); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	return data, contentType, thumb, nil
+}
+
+// storeUpload puts the file of a new Attachment, and its thumbnail if it has
+// one, in the blob store.
+func storeUpload(ctx context.Context, store blob.Store, productID, id string, data, thumb []byte) error {
+	key := blobKey(productID, id)
+	if err := store.Put(ctx, key, bytes.NewReader(data)); err != nil {
+		return errors.Wrap(err, "storing attachment")
+	}
+	if thumb != nil {
+		if err := store.Put(ctx, thumbnailKey(productID, id), bytes.NewReader(thumb)); err != nil {
+			store.Delete(ctx, key)
+			return errors.Wrap(err, "storing thumbnail")
+		}
+	}
+	return nil
+}
+
+// attachmentURL is where an Attachment is downloaded from, the same URL
+// attachmentColumns builds in SQL.
+func attachmentURL(productID, id string) string {
+	return "/v1/products/" + productID + "/attachments/" + id
+}
+
+// cleanFilename keeps only the last element of a client supplied file name so
+// it is safe to send back in a Content-Disposition header.
+func cleanFilename(name string) string {
+	name = path.Base(strings.Replace(name, `\`, "/", -1))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == '"' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" || name == "" {
+		return "file"
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+// GetAttachment finds an Attachment of a Product.
+func (pg *Postgres) GetAttachment(ctx context.Context, productID, id string) (*Attachment, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.getattachment")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var a Attachment
+
+	const q = `SELECT` + attachmentColumns + `
+		FROM attachments AS a
+		WHERE a.attachment_id = $1 AND a.product_id = $2`
+
+	if err := pg.db.GetContext(ctx, &a, q, id, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, errors.Wrap(err, "selecting attachment")
+	}
+
+	return &a, nil
+}
+
+// OpenAttachment finds an Attachment of a Product and opens its file, or its
+// thumbnail when thumb is set. Thumbnails are always PNG images. The caller
+// must close the file.
+func (pg *Postgres) OpenAttachment(ctx context.Context, productID, id string, thumb bool) (*Attachment, io.ReadCloser, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.openattachment")
+	defer span.End()
+
+	a, err := pg.GetAttachment(ctx, productID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err := openFile(ctx, pg.blobs, a, thumb)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, rc, nil
+}
+
+// openFile opens the file of an Attachment, or its thumbnail when thumb is
+// set.
+func openFile(ctx context.Context, store blob.Store, a *Attachment, thumb bool) (io.ReadCloser, error) {
+	key := blobKey(a.ProductID, a.ID)
+	if thumb {
+		if a.ThumbnailURL == nil {
+			return nil, ErrAttachmentNotFound
+		}
+		key = thumbnailKey(a.ProductID, a.ID)
+	}
+
+	rc, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening attachment %s", a.ID)
+	}
+	return rc, nil
+}
+
+// DeleteAttachment removes an Attachment from a Product along with its files.
+func (pg *Postgres) DeleteAttachment(ctx context.Context, productID, id string) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.deleteattachment")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `DELETE FROM attachments
+		WHERE attachment_id = $1 AND product_id = $2
+		RETURNING has_thumbnail`
+
+	var hasThumbnail bool
+	if err := pg.db.GetContext(ctx, &hasThumbnail, q, id, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAttachmentNotFound
+		}
+		return errors.Wrapf(err, "deleting attachment %s", id)
+	}
+
+	// The row is gone so a failure here only leaves an unreachable file.
+	return deleteFiles(ctx, pg.blobs, productID, id, hasThumbnail)
+}
+
+// deleteFiles removes the file of an Attachment from the blob store along
+// with its thumbnail if it has one.
+func deleteFiles(ctx context.Context, store blob.Store, productID, id string, hasThumbnail bool) error {
+	if err := store.Delete(ctx, blobKey(productID, id)); err != nil {
+		return errors.Wrapf(err, "deleting file of attachment %s", id)
+	}
+	if hasThumbnail {
+		if err := store.Delete(ctx, thumbnailKey(productID, id)); err != nil {
+			return errors.Wrapf(err, "deleting thumbnail of attachment %s", id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package product_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/blob"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestAttachments(t *testing.T) {
+	eachStore(t, testAttachments)
+}
+
+func testAttachments(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	np := product.NewProduct{Name: "Lamp", Cost: money.Money{Amount: 900, Currency: "INR"}, Quantity: 4}
+	lamp, err := store.Create(ctx, claims, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 100, 1000))); err != nil {
+		t.Fatalf("encoding image: %s", err)
+	}
+
+	img, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentImage, `C:\photos\lamp.png`, &photo, now)
+	if err != nil {
+		t.Fatalf("adding image: %s", err)
+	}
+	if img.Filename != "lamp.png" || img.ContentType != "image/png" || img.ThumbnailURL == nil {
+		t.Fatalf("expected a png named lamp.png with a thumbnail, got %+v", img)
+	}
+
+	doc, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentDocument, "care.txt", strings.NewReader("Dust weekly."), now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("adding document: %s", err)
+	}
+
+	{ // Rejected uploads
+
+		if _, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentImage, "care.txt", strings.NewReader("Dust weekly."), now); err != product.ErrUnsupportedType {
+			t.Fatalf("text as an image: expected %v, got %v", product.ErrUnsupportedType, err)
+		}
+		big := strings.NewReader(strings.Repeat("a", product.MaxAttachmentSize+1))
+		if _, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentDocument, "big.txt", big, now); err != product.ErrFileTooLarge {
+			t.Fatalf("oversized document: expected %v, got %v", product.ErrFileTooLarge, err)
+		}
+		if _, err := store.AddAttachment(ctx, claims, "00000000-0000-0000-0000-00000000beef", product.AttachmentDocument, "care.txt", strings.NewReader("Dust weekly."), now); err != product.ErrNotFound {
+			t.Fatalf("unknown product: expected %v, got %v", product.ErrNotFound, err)
+		}
+	}
+
+	{ // Thumbnail
+
+		_, rc, err := store.OpenAttachment(ctx, lamp.ID, img.ID, true)
+		if err != nil {
+			t.Fatalf("opening thumbnail: %s", err)
+		}
+		defer rc.Close()
+
+		thumb, err := png.Decode(rc)
+		if err != nil {
+			t.Fatalf("decoding thumbnail: %s", err)
+		}
+		if exp, got := image.Rect(0, 0, 25, product.ThumbnailSize), thumb.Bounds(); exp != got {
+			t.Fatalf("expected thumbnail bounds %v, got %v", exp, got)
+		}
+
+		if _, _, err := store.OpenAttachment(ctx, lamp.ID, doc.ID, true); err != product.ErrAttachmentNotFound {
+			t.Fatalf("thumbnail of a document: expected %v, got %v", product.ErrAttachmentNotFound, err)
+		}
+	}
+
+	{ // Listed on the product
+
+		saved, err := store.Get(ctx, lamp.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if len(saved.Attachments) != 2 || saved.Attachments[0].ID != img.ID || saved.Attachments[1].ID != doc.ID {
+			t.Fatalf("expected the image and document on the product, got %+v", saved.Attachments)
+		}
+	}
+
+	{ // Delete
+
+		if err := store.DeleteAttachment(ctx, lamp.ID, img.ID); err != nil {
+			t.Fatalf("deleting image: %s", err)
+		}
+		if _, _, err := store.OpenAttachment(ctx, lamp.ID, img.ID, false); err != product.ErrAttachmentNotFound {
+			t.Fatalf("opening deleted image: expected %v, got %v", product.ErrAttachmentNotFound, err)
+		}
+		if err := store.DeleteAttachment(ctx, lamp.ID, img.ID); err != product.ErrAttachmentNotFound {
+			t.Fatalf("deleting twice: expected %v, got %v", product.ErrAttachmentNotFound, err)
+		}
+	}
+}
+
+// TestPurgeAttachments checks purging a product takes the files of its
+// attachments out of the blob store.
+func TestPurgeAttachments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("creating blob dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	blobs := blob.NewLocal(dir)
+
+	t.Run("Postgres", func(t *testing.T) {
+		db, teardown := tests.NewUnit(t)
+		defer teardown()
+
+		testPurgeAttachments(t, product.NewPostgres(db, blobs), dir)
+	})
+	t.Run("Memory", func(t *testing.T) {
+		testPurgeAttachments(t, tests.NewMemoryProducts(blobs), dir)
+	})
+}
+
+func testPurgeAttachments(t *testing.T, store product.Store, dir string) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	np := product.NewProduct{Name: "Lamp", Cost: money.Money{Amount: 900, Currency: "INR"}, Quantity: 4}
+	lamp, err := store.Create(ctx, claims, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 100, 100))); err != nil {
+		t.Fatalf("encoding image: %s", err)
+	}
+	if _, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentImage, "lamp.png", &photo, now); err != nil {
+		t.Fatalf("adding image: %s", err)
+	}
+	if _, err := store.AddAttachment(ctx, claims, lamp.ID, product.AttachmentDocument, "care.txt", strings.NewReader("Dust weekly."), now); err != nil {
+		t.Fatalf("adding document: %s", err)
+	}
+
+	if err := store.Delete(ctx, claims, lamp.ID, now); err != nil {
+		t.Fatalf("deleting product: %s", err)
+	}
+	if err := store.Purge(ctx, lamp.ID); err != nil {
+		t.Fatalf("purging product: %s", err)
+	}
+
+	// The image, its thumbnail and the document were all kept under the
+	// product's directory.
+	files, err := ioutil.ReadDir(filepath.Join(dir, "products", lamp.ID))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("reading product blob dir: %s", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no files left after purging, got %d", len(files))
+	}
+}
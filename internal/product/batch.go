@@ -0,0 +1,156 @@
+package product
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// MaxBatchSize is the most items a single batch may contain.
+const MaxBatchSize = 500
+
+// These are the ways a batch can be applied. An atomic batch is applied in
+// full or not at all; a best effort batch applies every item it can.
+const (
+	BatchAtomic     = "atomic"
+	BatchBestEffort = "best_effort"
+)
+
+// Predefined errors for batches.
+var (
+	// ErrBatchAborted is reported for the items of an atomic batch that would
+	// have been applied had another item not failed.
+	ErrBatchAborted = errors.New("not applied because another item of the batch failed")
+)
+
+// BatchUpdateItem is one change of a BatchUpdate. Version is optional and,
+// when given, must match the current Version of the Product like the If-Match
+// header of a single update.
+type BatchUpdateItem struct {
+	ID      string `json:"id" validate:"required"`
+	Version int    `json:"version" validate:"gte=0"`
+	UpdateProduct
+}
+
+// BatchUpdate is what we require from clients for changing many Products at
+// once. Mode is one of the Batch* modes and defaults to BatchAtomic.
+type BatchUpdate struct {
+	Items []BatchUpdateItem `json:"items" validate:"required,min=1,max=500,dive"`
+	Mode  string            `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+}
+
+// BatchDelete is what we require from clients for moving many Products to the
+// trash at once. Mode is one of the Batch* modes and defaults to BatchAtomic.
+type BatchDelete struct {
+	IDs  []string `json:"ids" validate:"required,min=1,max=500"`
+	Mode string   `json:"mode" validate:"omitempty,oneof=atomic best_effort"`
+}
+
+// BatchResult is the outcome of one item of a batch, in the order the items
+// were given. Err is nil for an item that was applied.
+type BatchResult struct {
+	ID  string
+	Err error
+}
+
+// UpdateBatch applies each change of a BatchUpdate as Update would, in a
+// single transaction. Items that fail with one of the errors Update reports
+// for a bad request are given that error in their BatchResult; any other
+// failure ends the whole batch with an error.
+func (pg *Postgres) UpdateBatch(ctx context.Context, user auth.Claims, bu BatchUpdate, now time.Time) ([]BatchResult, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.updatebatch")
+	defer span.End()
+
+	ids := make([]string, len(bu.Items))
+	for i, item := range bu.Items {
+		ids[i] = item.ID
+	}
+
+	return pg.runBatch(ctx, bu.Mode, ids, func(tx *sqlx.Tx, i int) error {
+		item := bu.Items[i]
+		return applyUpdate(ctx, tx, user, item.ID, item.UpdateProduct, item.Version, now)
+	})
+}
+
+// DeleteBatch moves each Product of a BatchDelete to the trash in a single
+// transaction. Unlike Delete, a Product that is not live is reported as
+// ErrNotFound.
+func (pg *Postgres) DeleteBatch(ctx context.Context, user auth.Claims, bd BatchDelete, now time.Time) ([]BatchResult, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.deletebatch")
+	defer span.End()
+
+	return pg.runBatch(ctx, bd.Mode, bd.IDs, func(tx *sqlx.Tx, i int) error {
+		return trash(ctx, tx, user, bd.IDs[i], now)
+	})
+}
+
+// runBatch calls apply for each of the ids in one transaction. Every item runs
+// under its own savepoint so a failed item is undone on its own. In atomic
+// mode the transaction is rolled back if any item failed and the items that
+// succeeded are reported as ErrBatchAborted.
+func (pg *Postgres) runBatch(ctx context.Context, mode string, ids []string, apply func(tx *sqlx.Tx, i int) error) ([]BatchResult, error) {
+	if len(ids) > MaxBatchSize {
+		return nil, errors.Errorf("batch has %d items, the most allowed is %d", len(ids), MaxBatchSize)
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting batch transaction")
+	}
+	defer tx.Rollback()
+
+	results := make([]BatchResult, len(ids))
+	var failed bool
+	for i, id := range ids {
+		results[i].ID = id
+
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+			return nil, errors.Wrap(err, "starting batch item")
+		}
+
+		if err := apply(tx, i); err != nil {
+			if !isItemError(err) {
+				return nil, errors.Wrapf(err, "applying batch item %d", i)
+			}
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT batch_item"); err != nil {
+				return nil, errors.Wrap(err, "undoing batch item")
+			}
+			results[i].Err = err
+			failed = true
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT batch_item"); err != nil {
+			return nil, errors.Wrap(err, "finishing batch item")
+		}
+	}
+
+	if failed && mode != BatchBestEffort {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing batch")
+	}
+
+	return results, nil
+}
+
+// isItemError reports whether err is one of the errors a single item of a
+// batch can fail with while the rest of the batch carries on.
+func isItemError(err error) bool {
+	switch err {
+	case ErrNotFound, ErrInvalidID, ErrForbidden, ErrVersionConflict, ErrCategoryNotFound, ErrHasVariants:
+		return true
+	}
+	return false
+}
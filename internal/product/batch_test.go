@@ -0,0 +1,100 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestBatch(t *testing.T) {
+	eachStore(t, testBatch)
+}
+
+func testBatch(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	var ids []string
+	for _, name := range []string{"Pens", "Pencils", "Erasers"} {
+		np := product.NewProduct{Name: name, Cost: money.Money{Amount: 10, Currency: "INR"}, Quantity: 10}
+		p, err := store.Create(ctx, claims, np, now)
+		if err != nil {
+			t.Fatalf("creating product: %s", err)
+		}
+		ids = append(ids, p.ID)
+	}
+
+	const missing = "00000000-0000-0000-0000-00000000beef"
+	reprice := func(mode string, stale int) []product.BatchResult {
+		t.Helper()
+
+		cost := money.Money{Amount: 20, Currency: "INR"}
+		bu := product.BatchUpdate{Mode: mode}
+		for _, id := range ids {
+			bu.Items = append(bu.Items, product.BatchUpdateItem{ID: id, UpdateProduct: product.UpdateProduct{Cost: &cost}})
+		}
+		bu.Items[stale].Version = 99
+
+		results, err := store.UpdateBatch(ctx, claims, bu, now)
+		if err != nil {
+			t.Fatalf("updating batch: %s", err)
+		}
+		return results
+	}
+
+	cost := func(id string) int {
+		t.Helper()
+		p, err := store.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		return p.Cost.Amount
+	}
+
+	{ // An atomic batch with a stale version changes nothing
+
+		results := reprice(product.BatchAtomic, 1)
+		if results[1].Err != product.ErrVersionConflict || results[0].Err != product.ErrBatchAborted || results[2].Err != product.ErrBatchAborted {
+			t.Fatalf("expected a conflict that aborts the batch, got %+v", results)
+		}
+		if exp, got := 10, cost(ids[0]); exp != got {
+			t.Fatalf("expected cost %v after an aborted batch, got %v", exp, got)
+		}
+	}
+
+	{ // A best effort batch applies the rest
+
+		results := reprice(product.BatchBestEffort, 1)
+		if results[0].Err != nil || results[1].Err != product.ErrVersionConflict || results[2].Err != nil {
+			t.Fatalf("expected only the stale item to fail, got %+v", results)
+		}
+		if exp, got := 20, cost(ids[0]); exp != got {
+			t.Fatalf("expected cost %v after a best effort batch, got %v", exp, got)
+		}
+		if exp, got := 10, cost(ids[1]); exp != got {
+			t.Fatalf("expected the stale product to keep cost %v, got %v", exp, got)
+		}
+	}
+
+	{ // Deleting
+
+		bd := product.BatchDelete{IDs: []string{ids[0], missing, "bogus"}, Mode: product.BatchBestEffort}
+		results, err := store.DeleteBatch(ctx, claims, bd, now)
+		if err != nil {
+			t.Fatalf("deleting batch: %s", err)
+		}
+		if results[0].Err != nil || results[1].Err != product.ErrNotFound || results[2].Err != product.ErrInvalidID {
+			t.Fatalf("expected the missing and malformed ids to fail, got %+v", results)
+		}
+		if _, err := store.Get(ctx, ids[0]); err != product.ErrNotFound {
+			t.Fatalf("getting a deleted product: expected %v, got %v", product.ErrNotFound, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package product
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// cursor marks the position of the last row of a page in keyset pagination.
+// It is handed to clients as an opaque string.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// encodeCursor converts c into the opaque form given to clients.
+func encodeCursor(c cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor parses a string produced by encodeCursor. The cursor must have
+// been created for the same ordering it is being used with.
+func decodeCursor(s, sort string) (cursor, error) {
+	var c cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.ID == "" {
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// pageLimit gives the number of rows a page holds when limit are asked for.
+func pageLimit(limit int) int {
+	switch {
+	case limit <= 0:
+		return DefaultLimit
+	case limit > MaxLimit:
+		return MaxLimit
+	}
+	return limit
+}
+
+// salesCursor marks cursors issued by ListSales so they cannot be mixed up
+// with those for product listings.
+const salesCursor = "sales"
+
+// decodeSalesCursor parses a cursor issued by ListSales into the date and id
+// of the last Sale of the previous page.
+func decodeSalesCursor(s string) (time.Time, string, error) {
+	c, err := decodeCursor(s, salesCursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t.UTC(), c.ID, nil
+}
+
+// trimSales cuts page down to limit Sales. The one extra Sale asked for tells
+// there is another page, which starts after the last one kept.
+func trimSales(page *SalePage, limit int) {
+	if len(page.Items) <= limit {
+		return
+	}
+	page.Items = page.Items[:limit]
+	last := page.Items[limit-1]
+	page.NextCursor = encodeCursor(cursor{
+		Sort:  salesCursor,
+		Value: last.DateCreated.Format(time.RFC3339Nano),
+		ID:    last.ID,
+	})
+}
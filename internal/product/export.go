@@ -0,0 +1,79 @@
+package product
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// ExportProducts calls fn with every Product, oldest first. Rows are read from
+// the database one at a time as fn consumes them so memory use does not grow
+// with the size of the catalog. An error from fn stops the export and is
+// returned.
+func (pg *Postgres) ExportProducts(ctx context.Context, fn func(Product) error) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.exportproducts")
+	defer span.End()
+
+	const q = selectProducts + `
+		WHERE p.deleted_at IS NULL
+		ORDER BY p.date_created, p.product_id`
+
+	rows, err := pg.db.QueryxContext(ctx, q)
+	if err != nil {
+		return errors.Wrap(err, "selecting products")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Product
+		if err := rows.StructScan(&p); err != nil {
+			return errors.Wrap(err, "scanning product")
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "reading products")
+}
+
+// ExportSales calls fn with every Sale made from (inclusive) to (exclusive),
+// oldest first. A zero from or to leaves that end of the range open. Like
+// ExportProducts the rows are streamed from the database.
+func (pg *Postgres) ExportSales(ctx context.Context, from, to time.Time, fn func(Sale) error) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.exportsales")
+	defer span.End()
+
+	const q = selectSales + `
+		WHERE ($1::timestamp IS NULL OR date_created >= $1)
+		AND ($2::timestamp IS NULL OR date_created < $2)
+		ORDER BY date_created, sale_id`
+
+	rows, err := pg.db.QueryxContext(ctx, q, nullTime(from), nullTime(to))
+	if err != nil {
+		return errors.Wrap(err, "selecting sales")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s Sale
+		if err := rows.StructScan(&s); err != nil {
+			return errors.Wrap(err, "scanning sale")
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(rows.Err(), "reading sales")
+}
+
+// nullTime converts a zero time to a SQL NULL and any other time to UTC.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
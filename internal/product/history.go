@@ -0,0 +1,189 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// ErrNotCreated is used when asking about a Product at a time before it was
+// created.
+var ErrNotCreated = errors.New("product did not exist at that time")
+
+// History gives the recorded Changes to a Product, oldest first. When field
+// is not empty only changes to that field are returned.
+func (pg *Postgres) History(ctx context.Context, id, field string) ([]Change, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.history")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const exists = `SELECT EXISTS (
+		SELECT 1 FROM products WHERE product_id = $1 AND deleted_at IS NULL
+	)`
+
+	var found bool
+	if err := pg.db.GetContext(ctx, &found, exists, id); err != nil {
+		return nil, errors.Wrap(err, "checking product")
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	changes := []Change{}
+
+	const q = `SELECT * FROM product_history
+		WHERE product_id = $1 AND ($2 = '' OR field = $2)
+		ORDER BY date_changed, field`
+
+	if err := pg.db.SelectContext(ctx, &changes, q, id, field); err != nil {
+		return nil, errors.Wrap(err, "selecting product history")
+	}
+
+	return changes, nil
+}
+
+// CostAt gives the cost a Product had at the given time. It is the value set
+// by the last cost change at or before then or, failing that, the value
+// replaced by the first change after it. A Product whose cost never changed
+// has its current cost.
+func (pg *Postgres) CostAt(ctx context.Context, id string, at time.Time) (money.Money, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.costat")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return money.Money{}, ErrInvalidID
+	}
+
+	const q = `SELECT p.date_created, COALESCE(
+			(SELECT h.new_value FROM product_history AS h
+			WHERE h.product_id = p.product_id AND h.field = 'cost' AND h.date_changed <= $2
+			ORDER BY h.date_changed DESC LIMIT 1),
+			(SELECT h.old_value FROM product_history AS h
+			WHERE h.product_id = p.product_id AND h.field = 'cost' AND h.date_changed > $2
+			ORDER BY h.date_changed LIMIT 1),
+			p.cost || ' ' || p.currency
+		) AS cost
+		FROM products AS p
+		WHERE p.product_id = $1 AND p.deleted_at IS NULL`
+
+	var row struct {
+		DateCreated time.Time `db:"date_created"`
+		Cost        string    `db:"cost"`
+	}
+	if err := pg.db.GetContext(ctx, &row, q, id, at.UTC()); err != nil {
+		if err == sql.ErrNoRows {
+			return money.Money{}, ErrNotFound
+		}
+		return money.Money{}, errors.Wrapf(err, "selecting cost of product %s", id)
+	}
+	if at.Before(row.DateCreated) {
+		return money.Money{}, ErrNotCreated
+	}
+
+	cost, err := money.Parse(row.Cost)
+	if err != nil {
+		return money.Money{}, errors.Wrapf(err, "reading cost of product %s", id)
+	}
+
+	return cost, nil
+}
+
+// diffProducts lists the Changes user made to turn before into after.
+func diffProducts(user auth.Claims, before, after Product, now time.Time) []Change {
+	var changes []Change
+	add := func(field string, old, new *string) {
+		if old == nil && new == nil || old != nil && new != nil && *old == *new {
+			return
+		}
+		changes = append(changes, Change{
+			ID:          uuid.New().String(),
+			ProductID:   after.ID,
+			Field:       field,
+			OldValue:    old,
+			NewValue:    new,
+			ChangedBy:   user.Subject,
+			DateChanged: now.UTC(),
+		})
+	}
+
+	add(FieldName, &before.Name, &after.Name)
+	add(FieldDescription, &before.Description, &after.Description)
+	add(FieldCost, moneyText(before.Cost), moneyText(after.Cost))
+	add(FieldQuantity, itoa(before.Quantity), itoa(after.Quantity))
+	add(FieldThreshold, itoa(before.Threshold), itoa(after.Threshold))
+	add(FieldCategoryID, before.CategoryID, after.CategoryID)
+	add(FieldTags, tagsText(before.Tags), tagsText(after.Tags))
+
+	return changes
+}
+
+// quantityChange is the Change user made by taking the quantity of a Product
+// from old to new other than through an update, such as by selling it.
+func quantityChange(user auth.Claims, productID string, old, new int, now time.Time) Change {
+	return Change{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		Field:       FieldQuantity,
+		OldValue:    itoa(old),
+		NewValue:    itoa(new),
+		ChangedBy:   user.Subject,
+		DateChanged: now.UTC(),
+	}
+}
+
+// recordQuantity records a quantityChange as part of the transaction that
+// made it. Nothing is recorded when the quantity stayed the same.
+func recordQuantity(ctx context.Context, tx *sqlx.Tx, user auth.Claims, productID string, old, new int, now time.Time) error {
+	if old == new {
+		return nil
+	}
+	return insertChanges(ctx, tx, []Change{quantityChange(user, productID, old, new, now)})
+}
+
+// insertChanges records Changes as part of the transaction that made them.
+func insertChanges(ctx context.Context, tx *sqlx.Tx, changes []Change) error {
+	const q = `INSERT INTO product_history
+		(change_id, product_id, field, old_value, new_value, changed_by, date_changed)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	for _, c := range changes {
+		_, err := tx.ExecContext(ctx, q, c.ID, c.ProductID, c.Field, c.OldValue, c.NewValue, c.ChangedBy, c.DateChanged)
+		if err != nil {
+			return errors.Wrapf(err, "recording change to %s", c.Field)
+		}
+	}
+
+	return nil
+}
+
+// itoa formats an integer field for the history.
+func itoa(n int) *string {
+	s := strconv.Itoa(n)
+	return &s
+}
+
+// moneyText formats a money field for the history so a change of currency is
+// recorded along with the amount.
+func moneyText(m money.Money) *string {
+	s := m.String()
+	return &s
+}
+
+// tagsText formats tags for the history as a Postgres array literal so tags
+// containing commas stay unambiguous.
+func tagsText(tags []string) *string {
+	v, _ := normalizeTags(tags).Value()
+	s, _ := v.(string)
+	return &s
+}
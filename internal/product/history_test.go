@@ -0,0 +1,128 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestHistory(t *testing.T) {
+	eachStore(t, testHistory)
+}
+
+func testHistory(t *testing.T, store product.Store) {
+	created := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, created, time.Hour)
+
+	kites, err := store.Create(ctx, claims, product.NewProduct{Name: "Kites", Cost: money.Money{Amount: 10, Currency: "INR"}, Quantity: 5}, created)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	firstChange := created.Add(24 * time.Hour)
+	if err := store.Update(ctx, claims, kites.ID, product.UpdateProduct{Cost: &money.Money{Amount: 20, Currency: "INR"}}, 0, firstChange); err != nil {
+		t.Fatalf("updating cost: %s", err)
+	}
+
+	secondChange := created.Add(48 * time.Hour)
+	update := product.UpdateProduct{Name: tests.StringPointer("Box Kites"), Cost: &money.Money{Amount: 30, Currency: "USD"}, Quantity: tests.IntPointer(5)}
+	if err := store.Update(ctx, claims, kites.ID, update, 0, secondChange); err != nil {
+		t.Fatalf("updating name and currency: %s", err)
+	}
+
+	changes, err := store.History(ctx, kites.ID, "")
+	if err != nil {
+		t.Fatalf("getting history: %s", err)
+	}
+	if exp, got := 3, len(changes); exp != got {
+		t.Fatalf("expected %v changes with unchanged fields left out, got %v: %+v", exp, got, changes)
+	}
+	if c := changes[0]; c.Field != product.FieldCost || *c.OldValue != "10 INR" || *c.NewValue != "20 INR" || c.ChangedBy != tests.AdminID {
+		t.Fatalf("expected the first change to be the cost from 10 to 20, got %+v", c)
+	}
+
+	changes, err = store.History(ctx, kites.ID, product.FieldName)
+	if err != nil {
+		t.Fatalf("getting name history: %s", err)
+	}
+	if len(changes) != 1 || *changes[0].NewValue != "Box Kites" {
+		t.Fatalf("expected only the name change, got %+v", changes)
+	}
+
+	{ // Stock movements
+
+		seller := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, created, time.Hour)
+		sold := created.Add(72 * time.Hour)
+
+		ns := product.NewSale{Quantity: 2, Paid: money.Money{Amount: 60, Currency: "USD"}}
+		s, err := store.AddSale(ctx, seller, ns, kites.ID, sold)
+		if err != nil {
+			t.Fatalf("adding sale: %s", err)
+		}
+		if _, err := store.AddRefund(ctx, claims, product.NewRefund{Quantity: 1, Amount: 30, Reason: "torn"}, kites.ID, s.ID, sold.Add(time.Hour)); err != nil {
+			t.Fatalf("adding refund: %s", err)
+		}
+		no := product.NewOrder{Items: []product.NewOrderItem{{ProductID: kites.ID, Quantity: 1, Paid: money.Money{Amount: 30, Currency: "USD"}}}}
+		if _, err := store.CreateOrder(ctx, seller, no, sold.Add(2*time.Hour)); err != nil {
+			t.Fatalf("creating order: %s", err)
+		}
+		nv := product.NewVariant{SKU: "kite-red", Cost: money.Money{Amount: 30, Currency: "USD"}, Quantity: 7}
+		if _, err := store.AddVariant(ctx, claims, kites.ID, nv, sold.Add(3*time.Hour)); err != nil {
+			t.Fatalf("adding variant: %s", err)
+		}
+
+		changes, err := store.History(ctx, kites.ID, product.FieldQuantity)
+		if err != nil {
+			t.Fatalf("getting quantity history: %s", err)
+		}
+
+		want := []struct {
+			old, new string
+			by       string
+		}{
+			{"5", "3", tests.UserID},
+			{"3", "4", tests.AdminID},
+			{"4", "3", tests.UserID},
+			{"3", "7", tests.AdminID},
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("expected %v quantity changes, got %+v", len(want), changes)
+		}
+		for i, w := range want {
+			if c := changes[i]; *c.OldValue != w.old || *c.NewValue != w.new || c.ChangedBy != w.by {
+				t.Fatalf("expected change %d to take quantity from %s to %s by %s, got %+v", i, w.old, w.new, w.by, c)
+			}
+		}
+	}
+
+	tt := []struct {
+		at   time.Time
+		cost money.Money
+	}{
+		{created, money.Money{Amount: 10, Currency: "INR"}},
+		{firstChange.Add(-time.Second), money.Money{Amount: 10, Currency: "INR"}},
+		{firstChange, money.Money{Amount: 20, Currency: "INR"}},
+		{secondChange.Add(-time.Second), money.Money{Amount: 20, Currency: "INR"}},
+		{secondChange.Add(time.Hour), money.Money{Amount: 30, Currency: "USD"}},
+	}
+	for _, tc := range tt {
+		cost, err := store.CostAt(ctx, kites.ID, tc.at)
+		if err != nil {
+			t.Fatalf("getting cost at %v: %s", tc.at, err)
+		}
+		if cost != tc.cost {
+			t.Fatalf("expected cost %v at %v, got %v", tc.cost, tc.at, cost)
+		}
+	}
+
+	if _, err := store.CostAt(ctx, kites.ID, created.Add(-time.Second)); err != product.ErrNotCreated {
+		t.Fatalf("getting cost before creation: expected %v, got %v", product.ErrNotCreated, err)
+	}
+}
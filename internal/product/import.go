@@ -0,0 +1,256 @@
+package product
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/web"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// MaxImportRows is the most rows a single import may contain.
+const MaxImportRows = 10000
+
+// Predefined errors for imports.
+var (
+	// ErrImportTooLarge is used when an import has more than MaxImportRows rows.
+	ErrImportTooLarge = errors.New("import has too many rows")
+)
+
+// ImportRow is one record read from a bulk import. Row counts data records
+// from 1. Errors holds any problems found reading or validating the record.
+type ImportRow struct {
+	Row     int
+	Product NewProduct
+	Errors  []web.FieldError
+}
+
+// ImportResult reports what happened to one row of an import. ID is set for
+// rows that were created.
+type ImportResult struct {
+	Row    int              `json:"row"`
+	ID     string           `json:"id,omitempty"`
+	Errors []web.FieldError `json:"errors,omitempty"`
+}
+
+// ImportReport summarizes a bulk import. In a dry run rows are only validated
+// and Created is always zero.
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Total   int            `json:"total"`
+	Valid   int            `json:"valid"`
+	Created int            `json:"created"`
+	Rows    []ImportResult `json:"rows"`
+}
+
+// csvColumns maps each column a CSV import may have to the NewProduct field it
+// fills. Columns are identified by the header row using the JSON field names.
+// Tags are separated by semicolons within their column.
+var csvColumns = map[string]func(np *NewProduct, v string) error{
+	"name": func(np *NewProduct, v string) error {
+		np.Name = v
+		return nil
+	},
+	"description": func(np *NewProduct, v string) error {
+		np.Description = v
+		return nil
+	},
+	"cost": func(np *NewProduct, v string) error {
+		return atoi(&np.Cost.Amount, v)
+	},
+	"currency": func(np *NewProduct, v string) error {
+		np.Cost.Currency = v
+		return nil
+	},
+	"quantity": func(np *NewProduct, v string) error {
+		return atoi(&np.Quantity, v)
+	},
+	"category_id": func(np *NewProduct, v string) error {
+		if v != "" {
+			np.CategoryID = &v
+		}
+		return nil
+	},
+	"tags": func(np *NewProduct, v string) error {
+		if v != "" {
+			np.Tags = strings.Split(v, ";")
+		}
+		return nil
+	},
+}
+
+// atoi parses an optional integer CSV field into dst.
+func atoi(dst *int, v string) error {
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return errors.New("must be an integer")
+	}
+	*dst = n
+	return nil
+}
+
+// ReadCSV reads import rows from CSV. The first record must be a header naming
+// the columns. Problems with individual fields are recorded on their row; an
+// error is only returned when the document as a whole cannot be read.
+func ReadCSV(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading csv header")
+	}
+	for i, col := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(col))
+		if _, ok := csvColumns[header[i]]; !ok {
+			return nil, errors.Errorf("unknown csv column %q", col)
+		}
+	}
+
+	var rows []ImportRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "reading csv")
+		}
+		if len(rows) == MaxImportRows {
+			return nil, ErrImportTooLarge
+		}
+
+		row := ImportRow{Row: len(rows) + 1}
+		if len(record) != len(header) {
+			row.Errors = []web.FieldError{{Field: "row", Error: "has the wrong number of fields"}}
+			rows = append(rows, row)
+			continue
+		}
+		for i, v := range record {
+			if err := csvColumns[header[i]](&row.Product, strings.TrimSpace(v)); err != nil {
+				row.Errors = append(row.Errors, web.FieldError{Field: header[i], Error: err.Error()})
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// ReadJSON reads import rows from a JSON array of NewProduct documents.
+// Elements that cannot be decoded are recorded as errors on their row; an
+// error is only returned when the document as a whole cannot be read.
+func ReadJSON(r io.Reader) ([]ImportRow, error) {
+	var docs []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&docs); err != nil {
+		return nil, errors.Wrap(err, "reading json array")
+	}
+	if len(docs) > MaxImportRows {
+		return nil, ErrImportTooLarge
+	}
+
+	rows := make([]ImportRow, len(docs))
+	for i, doc := range docs {
+		rows[i].Row = i + 1
+
+		dec := json.NewDecoder(bytes.NewReader(doc))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rows[i].Product); err != nil {
+			rows[i].Errors = []web.FieldError{{Field: "row", Error: err.Error()}}
+		}
+	}
+
+	return rows, nil
+}
+
+// Import validates each row with the same rules applied to a single
+// NewProduct and creates the valid ones in one transaction, owned by user.
+// Invalid rows are skipped and reported. When dryRun is set nothing is
+// written. A row naming a category that does not exist fails the whole import
+// with ErrCategoryNotFound.
+func (pg *Postgres) Import(ctx context.Context, user auth.Claims, rows []ImportRow, dryRun bool, now time.Time) (*ImportReport, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.import")
+	defer span.End()
+
+	report, valid, err := checkImport(user, rows, dryRun, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting import transaction")
+	}
+	defer tx.Rollback()
+
+	for _, p := range valid {
+		if err := insertProduct(ctx, tx, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing import")
+	}
+	report.Created = len(valid)
+
+	return report, nil
+}
+
+// checkImport validates each row and builds the Products to create from the
+// valid ones. The report is filled in except for the number created.
+func checkImport(user auth.Claims, rows []ImportRow, dryRun bool, now time.Time) (*ImportReport, []Product, error) {
+	if len(rows) > MaxImportRows {
+		return nil, nil, ErrImportTooLarge
+	}
+
+	report := ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Rows:   make([]ImportResult, len(rows)),
+	}
+
+	var valid []Product
+	for i, row := range rows {
+		res := ImportResult{Row: row.Row, Errors: row.Errors}
+
+		if len(res.Errors) == 0 {
+			if err := web.Validate(&row.Product); err != nil {
+				verr, ok := err.(*web.Error)
+				if !ok {
+					return nil, nil, errors.Wrapf(err, "validating row %d", row.Row)
+				}
+				res.Errors = verr.Fields
+			}
+		}
+
+		if len(res.Errors) == 0 {
+			p := newProduct(user, row.Product, now)
+			valid = append(valid, p)
+			if !dryRun {
+				res.ID = p.ID
+			}
+		}
+
+		report.Rows[i] = res
+	}
+	report.Valid = len(valid)
+
+	return &report, valid, nil
+}
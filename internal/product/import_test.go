@@ -0,0 +1,109 @@
+package product_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+)
+
+func TestReadImport(t *testing.T) {
+	{ // CSV
+		const doc = "name,cost,currency,quantity,tags\n" +
+			"Kites,25,INR,10,outdoor;Toys\n" +
+			"Yo-yos,cheap,INR,5,\n" +
+			"Marbles,5\n"
+
+		rows, err := product.ReadCSV(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("reading csv: %s", err)
+		}
+		if exp, got := 3, len(rows); exp != got {
+			t.Fatalf("expected %v rows, got %v", exp, got)
+		}
+		want := product.NewProduct{Name: "Kites", Cost: money.Money{Amount: 25, Currency: "INR"}, Quantity: 10, Tags: []string{"outdoor", "Toys"}}
+		if diff := cmp.Diff(want, rows[0].Product); diff != "" {
+			t.Fatalf("first row did not match:\n%s", diff)
+		}
+		if len(rows[1].Errors) != 1 || rows[1].Errors[0].Field != "cost" {
+			t.Fatalf("expected a cost error on the second row, got %+v", rows[1].Errors)
+		}
+		if len(rows[2].Errors) != 1 {
+			t.Fatalf("expected an error on the short third row, got %+v", rows[2].Errors)
+		}
+
+		if _, err := product.ReadCSV(strings.NewReader("name,colour\nKites,red\n")); err == nil {
+			t.Fatal("expected an unknown column to be rejected")
+		}
+	}
+
+	{ // JSON
+		const doc = `[{"name":"Kites","cost":{"amount":25,"currency":"INR"},"quantity":10},{"name":"Yo-yos","colour":"red"}]`
+
+		rows, err := product.ReadJSON(strings.NewReader(doc))
+		if err != nil {
+			t.Fatalf("reading json: %s", err)
+		}
+		if exp, got := 2, len(rows); exp != got {
+			t.Fatalf("expected %v rows, got %v", exp, got)
+		}
+		if len(rows[0].Errors) != 0 {
+			t.Fatalf("expected no errors on the first row, got %+v", rows[0].Errors)
+		}
+		if len(rows[1].Errors) != 1 {
+			t.Fatalf("expected an unknown field error on the second row, got %+v", rows[1].Errors)
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	eachStore(t, testImport)
+}
+
+func testImport(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(
+		"718ffbea-f4a1-4667-8ae3-b349da52675e", // This is just some random UUID.
+		[]string{auth.RoleAdmin, auth.RoleUser},
+		now, time.Hour,
+	)
+
+	rows := []product.ImportRow{
+		{Row: 1, Product: product.NewProduct{Name: "Kites", Cost: money.Money{Amount: 25, Currency: "INR"}, Quantity: 10}},
+		{Row: 2, Product: product.NewProduct{Name: "", Cost: money.Money{Amount: 5, Currency: "INR"}, Quantity: 0}},
+	}
+
+	report, err := store.Import(ctx, claims, rows, true, now)
+	if err != nil {
+		t.Fatalf("dry run import: %s", err)
+	}
+	if report.Valid != 1 || report.Created != 0 {
+		t.Fatalf("expected dry run with 1 valid and 0 created rows, got %+v", report)
+	}
+	if exp, got := 2, len(report.Rows[1].Errors); exp != got {
+		t.Fatalf("expected %v field errors on the second row, got %v", exp, got)
+	}
+
+	report, err = store.Import(ctx, claims, rows, false, now)
+	if err != nil {
+		t.Fatalf("importing: %s", err)
+	}
+	if exp, got := 1, report.Created; exp != got {
+		t.Fatalf("expected %v created rows, got %v", exp, got)
+	}
+
+	p, err := store.Get(ctx, report.Rows[0].ID)
+	if err != nil {
+		t.Fatalf("getting imported product: %s", err)
+	}
+	if exp, got := "Kites", p.Name; exp != got {
+		t.Fatalf("expected imported product %q, got %q", exp, got)
+	}
+}
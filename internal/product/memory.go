@@ -0,0 +1,890 @@
+package product
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/blob"
+	"github.com/rakshans1/service/internal/platform/money"
+)
+
+// Memory is a Store keeping Products in memory, for tests that need no
+// database. It shares its checks with Postgres and behaves like it except
+// that it keeps no categories or promotions: placing a Product in a category,
+// filtering by one or redeeming a promotion code gives ErrNeedsDatabase.
+// Search matches word prefixes without the stemming of full text search and
+// ranks a match in a name above one in a description. The files of
+// Attachments are kept in a blob store.
+type Memory struct {
+	blobs blob.Store
+
+	mu sync.Mutex
+	*memoryTables
+}
+
+// memoryTables holds one field for each table of the database. The derived
+// fields of a Product, like Sold and Variants, are worked out when it is read.
+type memoryTables struct {
+	products    map[string]*memoryProduct
+	variants    map[string]Variant
+	attachments map[string]Attachment
+	orders      map[string]Order
+	sales       []Sale
+	refunds     []Refund
+	changes     []Change
+	alerts      []memoryAlert
+}
+
+// memoryProduct is a stored Product. Alerted remembers which side of its
+// reorder threshold it was on last time, like low_stock_alerted.
+type memoryProduct struct {
+	Product
+	alerted bool
+}
+
+// memoryAlert is a stored StockAlert. Sending marks one DeliverAlerts is
+// working on so a concurrent call skips it.
+type memoryAlert struct {
+	StockAlert
+	delivered bool
+	sending   bool
+}
+
+// NewMemory constructs an empty Store keeping attachment files in blobs.
+func NewMemory(blobs blob.Store) *Memory {
+	return &Memory{
+		blobs: blobs,
+		memoryTables: &memoryTables{
+			products:    make(map[string]*memoryProduct),
+			variants:    make(map[string]Variant),
+			attachments: make(map[string]Attachment),
+			orders:      make(map[string]Order),
+		},
+	}
+}
+
+// Seed adds Products and Sales exactly as they are given, keeping their ids
+// and dates, such as the fixtures of a test. The derived fields of the
+// Products are ignored.
+func (m *Memory) Seed(products []Product, sales []Sale) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range products {
+		m.products[p.ID] = &memoryProduct{Product: p}
+	}
+	m.sales = append(m.sales, sales...)
+}
+
+// clone copies the tables so changes to the copy leave t as it was.
+func (t *memoryTables) clone() *memoryTables {
+	c := memoryTables{
+		products:    make(map[string]*memoryProduct, len(t.products)),
+		variants:    make(map[string]Variant, len(t.variants)),
+		attachments: make(map[string]Attachment, len(t.attachments)),
+		orders:      make(map[string]Order, len(t.orders)),
+		sales:       append([]Sale(nil), t.sales...),
+		refunds:     append([]Refund(nil), t.refunds...),
+		changes:     append([]Change(nil), t.changes...),
+		alerts:      append([]memoryAlert(nil), t.alerts...),
+	}
+	for id, p := range t.products {
+		cp := *p
+		c.products[id] = &cp
+	}
+	for id, v := range t.variants {
+		c.variants[id] = v
+	}
+	for id, a := range t.attachments {
+		c.attachments[id] = a
+	}
+	for id, o := range t.orders {
+		c.orders[id] = o
+	}
+	return &c
+}
+
+// live finds the Product identified by id unless it is missing or in the
+// trash.
+func (m *Memory) live(id string) (*memoryProduct, bool) {
+	p, ok := m.products[id]
+	if !ok || p.DeletedAt != nil {
+		return nil, false
+	}
+	return p, true
+}
+
+// view gives a copy of a stored Product with its derived fields filled in the
+// way selectProducts reads them.
+func (m *Memory) view(mp *memoryProduct) Product {
+	p := mp.Product
+	p.Tags = append(normalizeTags(nil), p.Tags...)
+
+	var paid []money.Money
+	for _, s := range m.sales {
+		if s.ProductID == p.ID {
+			p.Sold += s.Quantity
+			paid = append(paid, s.Paid)
+		}
+	}
+	for _, r := range m.refunds {
+		if r.ProductID == p.ID {
+			p.Sold -= r.Quantity
+			paid = append(paid, money.Money{Amount: -r.Amount.Amount, Currency: r.Amount.Currency})
+		}
+	}
+	p.Revenue = money.Sum(paid)
+
+	p.Attachments = Attachments{}
+	for _, a := range m.attachments {
+		if a.ProductID == p.ID {
+			p.Attachments = append(p.Attachments, a)
+		}
+	}
+	sort.Slice(p.Attachments, func(i, j int) bool {
+		a, b := p.Attachments[i], p.Attachments[j]
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.Before(b.DateCreated)
+		}
+		return a.ID < b.ID
+	})
+
+	p.Variants = Variants{}
+	for _, v := range m.variants {
+		if v.ProductID == p.ID {
+			p.Variants = append(p.Variants, copyVariant(v))
+		}
+	}
+	sort.Slice(p.Variants, func(i, j int) bool { return p.Variants[i].SKU < p.Variants[j].SKU })
+
+	return p
+}
+
+// hasVariants reports whether the Product identified by id has any Variants.
+func (m *Memory) hasVariants(id string) bool {
+	for _, v := range m.variants {
+		if v.ProductID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// List gets a page of Products matching the filter.
+func (m *Memory) List(ctx context.Context, f ListFilter) (*ProductPage, error) {
+	key, err := checkListFilter(&f)
+	if err != nil {
+		return nil, err
+	}
+	if f.CategoryID != "" {
+		return nil, ErrNeedsDatabase
+	}
+
+	sort := listSort(f)
+	var after *sortedProduct
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		v, err := sortValue(key.cast, c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		after = &sortedProduct{value: v, Product: Product{ID: c.ID}}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := strings.ToLower(f.Name)
+	tags := normalizeTags(f.Tags)
+	sku := normalizeSKU(f.SKU)
+
+	page := ProductPage{
+		Items: []Product{},
+	}
+
+	var matched []sortedProduct
+	for _, mp := range m.products {
+		switch {
+		case (mp.DeletedAt != nil) != f.Deleted,
+			name != "" && !strings.Contains(strings.ToLower(mp.Name), name),
+			f.MinCost != nil && mp.Cost.Amount < *f.MinCost,
+			f.MaxCost != nil && mp.Cost.Amount > *f.MaxCost,
+			f.Currency != "" && mp.Cost.Currency != f.Currency,
+			f.UserID != "" && mp.UserID != f.UserID,
+			f.InStock && mp.Quantity <= 0,
+			!hasTags(mp.Tags, tags),
+			sku != "" && !m.hasSKUPrefix(mp.ID, sku):
+			continue
+		}
+
+		p := m.view(mp)
+		v, _ := sortValue(key.cast, key.value(p))
+		matched = append(matched, sortedProduct{Product: p, value: v})
+	}
+	page.Total = len(matched)
+
+	// less orders the products the way List sorts them ascending.
+	less := func(a, b sortedProduct) bool {
+		if c := compareValues(a.value, b.value); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	}
+	sortProducts(matched, less, f.Desc)
+
+	for _, sp := range matched {
+		if after != nil && (f.Desc && !less(sp, *after) || !f.Desc && !less(*after, sp)) {
+			continue
+		}
+		page.Items = append(page.Items, sp.Product)
+		if len(page.Items) > f.Limit {
+			break
+		}
+	}
+
+	trimProducts(&page, f.Limit, sort, key)
+
+	return &page, nil
+}
+
+// sortedProduct is a Product along with the value it is sorted on.
+type sortedProduct struct {
+	Product
+	value interface{}
+}
+
+// sortProducts sorts ps by less, or in reverse when desc is set.
+func sortProducts(ps []sortedProduct, less func(a, b sortedProduct) bool, desc bool) {
+	sort.Slice(ps, func(i, j int) bool {
+		if desc {
+			return less(ps[j], ps[i])
+		}
+		return less(ps[i], ps[j])
+	})
+}
+
+// sortValue converts the value of a sort key to something compareValues can
+// order, the way a cursor value is cast in SQL.
+func sortValue(cast, s string) (interface{}, error) {
+	switch cast {
+	case "int", "bigint":
+		return strconv.ParseInt(s, 10, 64)
+	case "real":
+		return strconv.ParseFloat(s, 32)
+	case "timestamp":
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return s, nil
+}
+
+// compareValues orders two values given by sortValue for the same cast.
+func compareValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case float64:
+		b := b.(float64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case time.Time:
+		b := b.(time.Time)
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// hasTags reports whether have includes every one of want.
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSKUPrefix reports whether a Variant of the Product identified by id has
+// a SKU starting with prefix.
+func (m *Memory) hasSKUPrefix(id, prefix string) bool {
+	for _, v := range m.variants {
+		if v.ProductID == id && strings.HasPrefix(v.SKU, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search gets a page of the live Products matching every word of the query
+// as a prefix of a word of their name or description, best matches first.
+func (m *Memory) Search(ctx context.Context, sq SearchQuery) (*ProductPage, error) {
+	query := prefixQuery(sq.Text)
+	if query == "" {
+		return nil, ErrEmptySearch
+	}
+	sq.Limit = pageLimit(sq.Limit)
+
+	sort := "rank:" + query
+	var after *sortedProduct
+	if sq.Cursor != "" {
+		c, err := decodeCursor(sq.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		v, err := sortValue("real", c.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		after = &sortedProduct{value: v, Product: Product{ID: c.ID}}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	words := searchWords(sq.Text)
+	var matched []sortedProduct
+	for _, mp := range m.products {
+		if mp.DeletedAt != nil {
+			continue
+		}
+		if rank, ok := searchRank(words, mp.Name, mp.Description); ok {
+			matched = append(matched, sortedProduct{Product: m.view(mp), value: float64(rank)})
+		}
+	}
+
+	page := ProductPage{
+		Items: []Product{},
+		Total: len(matched),
+	}
+
+	less := func(a, b sortedProduct) bool {
+		if c := compareValues(a.value, b.value); c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	}
+	sortProducts(matched, less, true)
+
+	var last sortedProduct
+	for _, sp := range matched {
+		if after != nil && !less(sp, *after) {
+			continue
+		}
+		if len(page.Items) == sq.Limit {
+			value := strconv.FormatFloat(last.value.(float64), 'g', -1, 32)
+			page.NextCursor = encodeCursor(cursor{Sort: sort, Value: value, ID: last.ID})
+			break
+		}
+		page.Items = append(page.Items, sp.Product)
+		last = sp
+	}
+
+	return &page, nil
+}
+
+// searchRank scores how well a Product with the given name and description
+// matches the words of a search. Every word must be the prefix of a word of
+// either; one found in the name counts for more.
+func searchRank(words []string, name, description string) (float32, bool) {
+	nameWords := searchWords(name)
+	descWords := searchWords(description)
+
+	hasPrefix := func(ws []string, prefix string) bool {
+		for _, w := range ws {
+			if strings.HasPrefix(w, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var rank float32
+	for _, w := range words {
+		switch {
+		case hasPrefix(nameWords, w):
+			rank += 1
+		case hasPrefix(descWords, w):
+			rank += 0.4
+		default:
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// Create adds a Product. It returns the created Product with fields like ID
+// and DateCreated populated.
+func (m *Memory) Create(ctx context.Context, user auth.Claims, np NewProduct, now time.Time) (*Product, error) {
+	p := newProduct(user, np, now)
+	if p.CategoryID != nil {
+		return nil, ErrNeedsDatabase
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp := memoryProduct{Product: p}
+	m.products[p.ID] = &mp
+
+	p = m.view(&mp)
+	return &p, nil
+}
+
+// Get finds the live Product identified by id.
+func (m *Memory) Get(ctx context.Context, id string) (*Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, ok := m.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	p := m.view(mp)
+	return &p, nil
+}
+
+// Update changes a Product the same way Postgres does.
+func (m *Memory) Update(ctx context.Context, user auth.Claims, id string, update UpdateProduct, version int, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.update(user, id, update, version, now)
+}
+
+// update implements Update with the lock held.
+func (m *Memory) update(user auth.Claims, id string, update UpdateProduct, version int, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	mp, ok := m.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if !user.HasRole(auth.RoleAdmin) && mp.UserID != user.Subject {
+		return ErrForbidden
+	}
+	if version != 0 && version != mp.Version {
+		return ErrVersionConflict
+	}
+	if update.Quantity != nil && m.hasVariants(id) {
+		return ErrHasVariants
+	}
+	if update.CategoryID != nil && *update.CategoryID != "" {
+		return ErrNeedsDatabase
+	}
+
+	before := mp.Product
+	patchProduct(&mp.Product, update)
+	mp.DateUpdated = now.UTC()
+	mp.Version++
+
+	m.changes = append(m.changes, diffProducts(user, before, mp.Product, now)...)
+	m.checkStock([]string{id}, now)
+
+	return nil
+}
+
+// Delete moves a Product to the trash. Deleting a Product that is already
+// gone is not an error.
+func (m *Memory) Delete(ctx context.Context, user auth.Claims, id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.trash(user, id, now); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// trash implements Delete with the lock held. It returns ErrNotFound if there
+// is no live product to delete.
+func (m *Memory) trash(user auth.Claims, id string, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	mp, ok := m.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	deletedAt, deletedBy := now.UTC(), user.Subject
+	mp.DeletedAt = &deletedAt
+	mp.DeletedBy = &deletedBy
+	mp.Version++
+
+	return nil
+}
+
+// Restore takes a Product back out of the trash.
+func (m *Memory) Restore(ctx context.Context, id string, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, ok := m.products[id]
+	if !ok || mp.DeletedAt == nil {
+		return ErrNotFound
+	}
+
+	mp.DeletedAt = nil
+	mp.DeletedBy = nil
+	mp.DateUpdated = now.UTC()
+	mp.Version++
+
+	return nil
+}
+
+// Purge removes a Product in the trash for good, along with everything that
+// refers to it. The files of its Attachments are removed from the blob store
+// afterwards.
+func (m *Memory) Purge(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	files, err := m.purge(id)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range files {
+		if err := deleteFiles(ctx, m.blobs, id, a.ID, a.ThumbnailURL != nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purge removes the Product and what refers to it from the tables and gives
+// back its Attachments.
+func (m *Memory) purge(id string) ([]Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, ok := m.products[id]
+	if !ok || mp.DeletedAt == nil {
+		return nil, ErrNotFound
+	}
+	delete(m.products, id)
+
+	sales := m.sales[:0]
+	for _, s := range m.sales {
+		if s.ProductID != id {
+			sales = append(sales, s)
+		}
+	}
+	m.sales = sales
+
+	refunds := m.refunds[:0]
+	for _, r := range m.refunds {
+		if r.ProductID != id {
+			refunds = append(refunds, r)
+		}
+	}
+	m.refunds = refunds
+
+	changes := m.changes[:0]
+	for _, c := range m.changes {
+		if c.ProductID != id {
+			changes = append(changes, c)
+		}
+	}
+	m.changes = changes
+
+	alerts := m.alerts[:0]
+	for _, a := range m.alerts {
+		if a.ProductID != id {
+			alerts = append(alerts, a)
+		}
+	}
+	m.alerts = alerts
+
+	for vid, v := range m.variants {
+		if v.ProductID == id {
+			delete(m.variants, vid)
+		}
+	}
+	var files []Attachment
+	for aid, a := range m.attachments {
+		if a.ProductID == id {
+			files = append(files, a)
+			delete(m.attachments, aid)
+		}
+	}
+
+	return files, nil
+}
+
+// UpdateBatch applies each change of a BatchUpdate as Update would. A batch
+// placing any Product in a category is refused as a whole with
+// ErrNeedsDatabase.
+func (m *Memory) UpdateBatch(ctx context.Context, user auth.Claims, bu BatchUpdate, now time.Time) ([]BatchResult, error) {
+	ids := make([]string, len(bu.Items))
+	for i, item := range bu.Items {
+		if item.CategoryID != nil && *item.CategoryID != "" {
+			return nil, ErrNeedsDatabase
+		}
+		ids[i] = item.ID
+	}
+
+	return m.runBatch(bu.Mode, ids, func(i int) error {
+		item := bu.Items[i]
+		return m.update(user, item.ID, item.UpdateProduct, item.Version, now)
+	})
+}
+
+// DeleteBatch moves each Product of a BatchDelete to the trash. Unlike
+// Delete, a Product that is not live is reported as ErrNotFound.
+func (m *Memory) DeleteBatch(ctx context.Context, user auth.Claims, bd BatchDelete, now time.Time) ([]BatchResult, error) {
+	return m.runBatch(bd.Mode, bd.IDs, func(i int) error {
+		return m.trash(user, bd.IDs[i], now)
+	})
+}
+
+// runBatch calls apply for each of the ids with the lock held. An item fails
+// before it changes anything, so only an atomic batch needs undoing, which is
+// done by putting back a copy of the tables taken at the start.
+func (m *Memory) runBatch(mode string, ids []string, apply func(i int) error) ([]BatchResult, error) {
+	if len(ids) > MaxBatchSize {
+		return nil, errors.Errorf("batch has %d items, the most allowed is %d", len(ids), MaxBatchSize)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := m.memoryTables.clone()
+
+	results := make([]BatchResult, len(ids))
+	var failed bool
+	for i, id := range ids {
+		results[i].ID = id
+
+		if err := apply(i); err != nil {
+			if !isItemError(err) {
+				m.memoryTables = saved
+				return nil, errors.Wrapf(err, "applying batch item %d", i)
+			}
+			results[i].Err = err
+			failed = true
+		}
+	}
+
+	if failed && mode != BatchBestEffort {
+		m.memoryTables = saved
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = ErrBatchAborted
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// Import validates each row and creates the valid ones, all or none. A row
+// naming a category fails the whole import with ErrNeedsDatabase.
+func (m *Memory) Import(ctx context.Context, user auth.Claims, rows []ImportRow, dryRun bool, now time.Time) (*ImportReport, error) {
+	report, valid, err := checkImport(user, rows, dryRun, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun || len(valid) == 0 {
+		return report, nil
+	}
+
+	for _, p := range valid {
+		if p.CategoryID != nil {
+			return nil, ErrNeedsDatabase
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range valid {
+		m.products[p.ID] = &memoryProduct{Product: p}
+	}
+	report.Created = len(valid)
+
+	return report, nil
+}
+
+// ExportProducts calls fn with every live Product, oldest first. An error
+// from fn stops the export and is returned.
+func (m *Memory) ExportProducts(ctx context.Context, fn func(Product) error) error {
+	m.mu.Lock()
+	var products []Product
+	for _, mp := range m.products {
+		if mp.DeletedAt == nil {
+			products = append(products, m.view(mp))
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.Before(b.DateCreated)
+		}
+		return a.ID < b.ID
+	})
+
+	for _, p := range products {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportSales calls fn with every Sale made from (inclusive) to (exclusive),
+// oldest first. A zero from or to leaves that end of the range open.
+func (m *Memory) ExportSales(ctx context.Context, from, to time.Time, fn func(Sale) error) error {
+	m.mu.Lock()
+	var sales []Sale
+	for _, s := range m.sales {
+		if inRange(s.DateCreated, from, to) {
+			sales = append(sales, s)
+		}
+	}
+	m.mu.Unlock()
+
+	sortSales(sales)
+
+	for _, s := range sales {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inRange reports whether t falls in [from, to), where a zero from or to
+// leaves that end open.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// History gives the recorded Changes to a live Product, oldest first. When
+// field is not empty only changes to that field are returned.
+func (m *Memory) History(ctx context.Context, id, field string) ([]Change, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(id); !ok {
+		return nil, ErrNotFound
+	}
+
+	changes := []Change{}
+	for _, c := range m.changes {
+		if c.ProductID == id && (field == "" || c.Field == field) {
+			changes = append(changes, c)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if !a.DateChanged.Equal(b.DateChanged) {
+			return a.DateChanged.Before(b.DateChanged)
+		}
+		return a.Field < b.Field
+	})
+
+	return changes, nil
+}
+
+// CostAt gives the cost a Product had at the given time, worked out from its
+// history the same way Postgres does.
+func (m *Memory) CostAt(ctx context.Context, id string, at time.Time) (money.Money, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return money.Money{}, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, ok := m.live(id)
+	if !ok {
+		return money.Money{}, ErrNotFound
+	}
+	if at.Before(mp.DateCreated) {
+		return money.Money{}, ErrNotCreated
+	}
+
+	var before, after *Change
+	for i := range m.changes {
+		c := &m.changes[i]
+		if c.ProductID != id || c.Field != FieldCost {
+			continue
+		}
+		if !c.DateChanged.After(at) {
+			if before == nil || !c.DateChanged.Before(before.DateChanged) {
+				before = c
+			}
+		} else if after == nil || c.DateChanged.Before(after.DateChanged) {
+			after = c
+		}
+	}
+
+	text := mp.Cost.String()
+	switch {
+	case before != nil && before.NewValue != nil:
+		text = *before.NewValue
+	case after != nil && after.OldValue != nil:
+		text = *after.OldValue
+	}
+
+	cost, err := money.Parse(text)
+	if err != nil {
+		return money.Money{}, errors.Wrapf(err, "reading cost of product %s", id)
+	}
+	return cost, nil
+}
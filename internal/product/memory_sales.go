@@ -0,0 +1,774 @@
+package product
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/platform/notify"
+)
+
+// AddSale records a Sale of a Product and takes the sold units out of its
+// stock, and that of the Variant sold, the same way Postgres does.
+func (m *Memory) AddSale(ctx context.Context, user auth.Claims, ns NewSale, productID string, now time.Time) (*Sale, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if ns.VariantID != nil {
+		if _, err := uuid.Parse(*ns.VariantID); err != nil {
+			return nil, ErrInvalidID
+		}
+	}
+
+	s := Sale{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		VariantID:   ns.VariantID,
+		Quantity:    ns.Quantity,
+		Paid:        ns.Paid,
+		UserID:      &user.Subject,
+		DateCreated: now.UTC(),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mp, ok := m.live(productID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var ids []string
+	if s.VariantID != nil {
+		ids = []string{*s.VariantID}
+	}
+	variants, err := m.lockedVariants(ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkSale(s, m.lockedProduct(mp), variants); err != nil {
+		return nil, err
+	}
+
+	if ns.Code != "" {
+		return nil, ErrNeedsDatabase
+	}
+
+	m.changes = append(m.changes, quantityChange(user, productID, mp.Quantity, mp.Quantity-s.Quantity, now))
+	mp.Quantity -= s.Quantity
+	mp.Version++
+	if s.VariantID != nil {
+		v := m.variants[*s.VariantID]
+		v.Quantity -= s.Quantity
+		m.variants[v.ID] = v
+	}
+	m.checkStock([]string{productID}, now)
+	m.sales = append(m.sales, s)
+
+	return &s, nil
+}
+
+// ListSales gives a page of the Sales for a Product in the order they were
+// made.
+func (m *Memory) ListSales(ctx context.Context, productID string, f SalesFilter) (*SalePage, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	f.Limit = pageLimit(f.Limit)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(productID); !ok {
+		return nil, ErrNotFound
+	}
+
+	var after *Sale
+	if f.Cursor != "" {
+		t, id, err := decodeSalesCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &Sale{ID: id, DateCreated: t}
+	}
+
+	page := SalePage{
+		Items: []Sale{},
+	}
+	for _, s := range m.sales {
+		if s.ProductID == productID && inRange(s.DateCreated, f.From, f.To) && (after == nil || saleBefore(*after, s)) {
+			page.Items = append(page.Items, s)
+		}
+	}
+	sortSales(page.Items)
+	trimSales(&page, f.Limit)
+
+	return &page, nil
+}
+
+// saleBefore reports whether a was made before b, using the ids to break ties.
+func saleBefore(a, b Sale) bool {
+	if !a.DateCreated.Equal(b.DateCreated) {
+		return a.DateCreated.Before(b.DateCreated)
+	}
+	return a.ID < b.ID
+}
+
+// sortSales puts sales in the order they were made.
+func sortSales(sales []Sale) {
+	sort.Slice(sales, func(i, j int) bool { return saleBefore(sales[i], sales[j]) })
+}
+
+// ListSalesByUser gives all Sales made by a user, newest first. Users may
+// list their own sales; listing anyone else's requires the admin role.
+func (m *Memory) ListSalesByUser(ctx context.Context, user auth.Claims, userID string) ([]Sale, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && userID != user.Subject {
+		return nil, ErrForbidden
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sales := []Sale{}
+	for _, s := range m.sales {
+		if s.UserID != nil && *s.UserID == userID {
+			sales = append(sales, s)
+		}
+	}
+	sort.Slice(sales, func(i, j int) bool {
+		a, b := sales[i], sales[j]
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.After(b.DateCreated)
+		}
+		return a.ID < b.ID
+	})
+
+	return sales, nil
+}
+
+// CreateOrder records an Order and one Sale for each of its lines, so either
+// every line is sold or none is. Stock is checked in the same order Postgres
+// locks it so the same error is reported.
+func (m *Memory) CreateOrder(ctx context.Context, user auth.Claims, no NewOrder, now time.Time) (*Order, error) {
+	o, requested, requestedVariants, err := newOrder(user, no, now)
+	if err != nil {
+		return nil, err
+	}
+	ids := sortedKeys(requested)
+	variantIDs := sortedKeys(requestedVariants)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	products := make(map[string]lockedProduct, len(ids))
+	for _, id := range ids {
+		mp, ok := m.live(id)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		products[id] = m.lockedProduct(mp)
+	}
+	if err := checkProducts(ids, products, requested); err != nil {
+		return nil, err
+	}
+
+	variants, err := m.lockedVariants(variantIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVariants(o.Items, products, variants, variantIDs, requestedVariants); err != nil {
+		return nil, err
+	}
+
+	if no.Code != "" {
+		return nil, ErrNeedsDatabase
+	}
+
+	m.orders[o.ID] = Order{ID: o.ID, UserID: o.UserID, DateCreated: o.DateCreated}
+	for _, id := range ids {
+		p := m.products[id]
+		m.changes = append(m.changes, quantityChange(user, id, p.Quantity, p.Quantity-requested[id], now))
+		p.Quantity -= requested[id]
+		p.Version++
+	}
+	for _, id := range variantIDs {
+		v := m.variants[id]
+		v.Quantity -= requestedVariants[id]
+		m.variants[id] = v
+	}
+	m.checkStock(ids, now)
+	m.sales = append(m.sales, o.Items...)
+
+	return o, nil
+}
+
+// lockedProduct gives what a sale needs to know about a stored Product, as
+// Postgres reads it from the row it locks.
+func (m *Memory) lockedProduct(mp *memoryProduct) lockedProduct {
+	return lockedProduct{
+		ProductID:   mp.ID,
+		Quantity:    mp.Quantity,
+		Cost:        mp.Cost.Amount,
+		Currency:    mp.Cost.Currency,
+		HasVariants: m.hasVariants(mp.ID),
+	}
+}
+
+// lockedVariants gives what a sale needs to know about the Variants identified
+// by ids. It returns ErrVariantNotFound if a Variant does not exist.
+func (m *Memory) lockedVariants(ids []string) (map[string]lockedVariant, error) {
+	variants := make(map[string]lockedVariant, len(ids))
+	for _, id := range ids {
+		v, ok := m.variants[id]
+		if !ok {
+			return nil, ErrVariantNotFound
+		}
+		variants[id] = lockedVariant{
+			VariantID: v.ID,
+			ProductID: v.ProductID,
+			Quantity:  v.Quantity,
+			Cost:      v.Cost.Amount,
+			Currency:  v.Cost.Currency,
+		}
+	}
+	return variants, nil
+}
+
+// GetOrder finds the Order identified by a given ID along with its Sales.
+// Only admins may see the orders of other users.
+func (m *Memory) GetOrder(ctx context.Context, user auth.Claims, id string) (*Order, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o, ok := m.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && o.UserID != user.Subject {
+		return nil, ErrForbidden
+	}
+
+	o.Items = []Sale{}
+	var paid []money.Money
+	for _, s := range m.sales {
+		if s.OrderID != nil && *s.OrderID == id {
+			o.Items = append(o.Items, s)
+			paid = append(paid, s.Paid)
+		}
+	}
+	sort.Slice(o.Items, func(i, j int) bool {
+		a, b := o.Items[i], o.Items[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.ID < b.ID
+	})
+	o.Totals = money.Sum(paid)
+
+	return &o, nil
+}
+
+// AddRefund records a refund against a Sale of a Product and puts the
+// refunded units back into stock.
+func (m *Memory) AddRefund(ctx context.Context, user auth.Claims, nr NewRefund, productID, saleID string, now time.Time) (*Refund, error) {
+	return m.refund(user, nr, false, productID, saleID, now)
+}
+
+// VoidSale refunds everything that remains of a Sale of a Product and marks
+// the refund as a void.
+func (m *Memory) VoidSale(ctx context.Context, user auth.Claims, nv NewVoid, productID, saleID string, now time.Time) (*Refund, error) {
+	return m.refund(user, NewRefund{Reason: nv.Reason}, true, productID, saleID, now)
+}
+
+// refund implements AddRefund and VoidSale.
+func (m *Memory) refund(user auth.Claims, nr NewRefund, void bool, productID, saleID string, now time.Time) (*Refund, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sale, ok := m.sale(productID, saleID)
+	if !ok {
+		return nil, ErrSaleNotFound
+	}
+
+	var priorQty, priorAmt int
+	for _, r := range m.refunds {
+		if r.SaleID == saleID {
+			priorQty += r.Quantity
+			priorAmt += r.Amount.Amount
+		}
+	}
+	if err := checkRefund(&nr, void, sale.Quantity-priorQty, sale.Paid.Amount-priorAmt); err != nil {
+		return nil, err
+	}
+
+	r := Refund{
+		ID:          uuid.New().String(),
+		SaleID:      saleID,
+		ProductID:   productID,
+		Quantity:    nr.Quantity,
+		Amount:      money.Money{Amount: nr.Amount, Currency: sale.Paid.Currency},
+		Reason:      nr.Reason,
+		Void:        void,
+		UserID:      user.Subject,
+		DateCreated: now.UTC(),
+	}
+
+	if r.Quantity > 0 {
+		p := m.products[productID]
+		m.changes = append(m.changes, quantityChange(user, productID, p.Quantity, p.Quantity+r.Quantity, now))
+		p.Quantity += r.Quantity
+		p.Version++
+
+		if sale.VariantID != nil {
+			if v, ok := m.variants[*sale.VariantID]; ok {
+				v.Quantity += r.Quantity
+				m.variants[v.ID] = v
+			}
+		}
+
+		m.checkStock([]string{productID}, now)
+	}
+	m.refunds = append(m.refunds, r)
+
+	return &r, nil
+}
+
+// sale finds a Sale of a live Product.
+func (m *Memory) sale(productID, saleID string) (Sale, bool) {
+	if _, ok := m.live(productID); !ok {
+		return Sale{}, false
+	}
+	for _, s := range m.sales {
+		if s.ID == saleID && s.ProductID == productID {
+			return s, true
+		}
+	}
+	return Sale{}, false
+}
+
+// ListRefunds gives all Refunds of a Sale of a Product, oldest first.
+func (m *Memory) ListRefunds(ctx context.Context, productID, saleID string) ([]Refund, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sale(productID, saleID); !ok {
+		return nil, ErrSaleNotFound
+	}
+
+	refunds := []Refund{}
+	for _, r := range m.refunds {
+		if r.SaleID == saleID {
+			refunds = append(refunds, r)
+		}
+	}
+	sort.SliceStable(refunds, func(i, j int) bool {
+		return refunds[i].DateCreated.Before(refunds[j].DateCreated)
+	})
+
+	return refunds, nil
+}
+
+// LowStock gets the live Products whose quantity is below their reorder
+// threshold, lowest quantity first.
+func (m *Memory) LowStock(ctx context.Context) ([]Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	products := []Product{}
+	for _, mp := range m.products {
+		if mp.DeletedAt == nil && mp.Quantity < mp.Threshold {
+			products = append(products, m.view(mp))
+		}
+	}
+	sort.Slice(products, func(i, j int) bool {
+		a, b := products[i], products[j]
+		if a.Quantity != b.Quantity {
+			return a.Quantity < b.Quantity
+		}
+		return a.ID < b.ID
+	})
+
+	return products, nil
+}
+
+// checkStock raises a StockAlert for each of the Products that has just
+// fallen below its reorder threshold and clears those that were replenished,
+// like checkStock does in a transaction.
+func (m *Memory) checkStock(productIDs []string, now time.Time) {
+	for _, id := range productIDs {
+		mp, ok := m.products[id]
+		if !ok {
+			continue
+		}
+
+		low := mp.Quantity < mp.Threshold
+		if low == mp.alerted {
+			continue
+		}
+		mp.alerted = low
+
+		if low {
+			m.alerts = append(m.alerts, memoryAlert{StockAlert: StockAlert{
+				ID:          uuid.New().String(),
+				ProductID:   id,
+				Quantity:    mp.Quantity,
+				Threshold:   mp.Threshold,
+				DateCreated: now.UTC(),
+			}})
+		}
+	}
+}
+
+// DeliverAlerts sends the StockAlerts that have not been delivered yet through
+// n, oldest first, and returns how many were sent. It stops at the first one
+// n fails to deliver. The lock is not held while sending; concurrent calls
+// skip the alerts another call is sending.
+func (m *Memory) DeliverAlerts(ctx context.Context, n notify.Notifier, now time.Time) (int, error) {
+	m.mu.Lock()
+	var alerts []StockAlert
+	for i := range m.alerts {
+		a := &m.alerts[i]
+		if a.delivered || a.sending {
+			continue
+		}
+		a.sending = true
+
+		sa := a.StockAlert
+		sa.Name = m.products[sa.ProductID].Name
+		alerts = append(alerts, sa)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(alerts, func(i, j int) bool {
+		a, b := alerts[i], alerts[j]
+		if !a.DateCreated.Equal(b.DateCreated) {
+			return a.DateCreated.Before(b.DateCreated)
+		}
+		return a.ID < b.ID
+	})
+
+	var sendErr error
+	sent := make(map[string]bool)
+	for _, a := range alerts {
+		if err := n.Notify(ctx, alertNotification(a)); err != nil {
+			sendErr = errors.Wrapf(err, "delivering stock alert %s", a.ID)
+			break
+		}
+		sent[a.ID] = true
+	}
+
+	m.mu.Lock()
+	for i := range m.alerts {
+		a := &m.alerts[i]
+		if a.sending {
+			a.sending = false
+			a.delivered = a.delivered || sent[a.ID]
+		}
+	}
+	m.mu.Unlock()
+
+	return len(sent), sendErr
+}
+
+// copyVariant copies v so its Attributes are not shared with the store.
+func copyVariant(v Variant) Variant {
+	attrs := make(Attributes, len(v.Attributes))
+	for k, val := range v.Attributes {
+		attrs[k] = val
+	}
+	v.Attributes = attrs
+	return v
+}
+
+// skuTaken reports whether a Variant other than the one identified by id
+// already has sku.
+func (m *Memory) skuTaken(sku, id string) bool {
+	for _, v := range m.variants {
+		if v.SKU == sku && v.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// syncQuantity sets the quantity of a Product to the total of its Variants,
+// recording the change as made by user.
+func (m *Memory) syncQuantity(user auth.Claims, productID string, now time.Time) {
+	p := m.products[productID]
+
+	var total int
+	for _, v := range m.variants {
+		if v.ProductID == productID {
+			total += v.Quantity
+		}
+	}
+	if total != p.Quantity {
+		m.changes = append(m.changes, quantityChange(user, productID, p.Quantity, total, now))
+	}
+	p.Quantity = total
+	p.DateUpdated = now.UTC()
+	p.Version++
+
+	m.checkStock([]string{productID}, now)
+}
+
+// AddVariant adds a Variant to a Product. The Product's quantity becomes the
+// total of its Variants.
+func (m *Memory) AddVariant(ctx context.Context, user auth.Claims, productID string, nv NewVariant, now time.Time) (*Variant, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	v, err := newVariant(productID, nv, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(productID); !ok {
+		return nil, ErrNotFound
+	}
+	if m.skuTaken(v.SKU, v.ID) {
+		return nil, ErrSKUTaken
+	}
+
+	m.variants[v.ID] = copyVariant(v)
+	m.syncQuantity(user, productID, now)
+
+	return &v, nil
+}
+
+// GetVariant finds a Variant of a live Product.
+func (m *Memory) GetVariant(ctx context.Context, productID, id string) (*Variant, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	v, ok := m.variants[id]
+	if _, live := m.live(productID); !ok || !live || v.ProductID != productID {
+		return nil, ErrVariantNotFound
+	}
+
+	v = copyVariant(v)
+	return &v, nil
+}
+
+// EditVariant modifies a Variant of a Product. A change of quantity is
+// carried over to the Product's total.
+func (m *Memory) EditVariant(ctx context.Context, user auth.Claims, productID, id string, uv UpdateVariant, now time.Time) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(productID); !ok {
+		return ErrNotFound
+	}
+	v, ok := m.variants[id]
+	if !ok || v.ProductID != productID {
+		return ErrVariantNotFound
+	}
+
+	if err := patchVariant(&v, uv, now); err != nil {
+		return err
+	}
+	if m.skuTaken(v.SKU, id) {
+		return ErrSKUTaken
+	}
+
+	m.variants[id] = copyVariant(v)
+	if uv.Quantity != nil {
+		m.syncQuantity(user, productID, now)
+	}
+
+	return nil
+}
+
+// DeleteVariant removes a Variant from a Product along with its stock. A
+// Variant that has been sold is kept and reported as ErrVariantInUse.
+func (m *Memory) DeleteVariant(ctx context.Context, user auth.Claims, productID, id string, now time.Time) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(productID); !ok {
+		return ErrNotFound
+	}
+	if v, ok := m.variants[id]; !ok || v.ProductID != productID {
+		return ErrVariantNotFound
+	}
+	for _, s := range m.sales {
+		if s.VariantID != nil && *s.VariantID == id {
+			return ErrVariantInUse
+		}
+	}
+
+	delete(m.variants, id)
+	m.syncQuantity(user, productID, now)
+
+	return nil
+}
+
+// AddAttachment uploads a file read from r and attaches it to a Product as the
+// given kind of Attachment, checked the same way Postgres checks it. The lock
+// is not held while the file is read and stored.
+func (m *Memory) AddAttachment(ctx context.Context, user auth.Claims, productID, kind, filename string, r io.Reader, now time.Time) (*Attachment, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	rule, ok := attachmentRules[kind]
+	if !ok {
+		return nil, errors.Errorf("unknown attachment kind %q", kind)
+	}
+
+	m.mu.Lock()
+	_, ok = m.live(productID)
+	m.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	data, contentType, thumb, err := readUpload(r, kind, rule)
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	if err := storeUpload(ctx, m.blobs, productID, id, data, thumb); err != nil {
+		return nil, err
+	}
+
+	a := Attachment{
+		ID:          id,
+		ProductID:   productID,
+		Kind:        kind,
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		URL:         attachmentURL(productID, id),
+		UserID:      user.Subject,
+		DateCreated: now.UTC(),
+	}
+	if thumb != nil {
+		u := a.URL + "/thumbnail"
+		a.ThumbnailURL = &u
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The Product may have been purged while the file was being stored.
+	if _, ok := m.products[productID]; !ok {
+		deleteFiles(ctx, m.blobs, productID, id, thumb != nil)
+		return nil, ErrNotFound
+	}
+	m.attachments[id] = a
+
+	return &a, nil
+}
+
+// GetAttachment finds an Attachment of a Product.
+func (m *Memory) GetAttachment(ctx context.Context, productID, id string) (*Attachment, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attachments[id]
+	if !ok || a.ProductID != productID {
+		return nil, ErrAttachmentNotFound
+	}
+
+	return &a, nil
+}
+
+// OpenAttachment finds an Attachment of a Product and opens its file, or its
+// thumbnail when thumb is set. The caller must close the file.
+func (m *Memory) OpenAttachment(ctx context.Context, productID, id string, thumb bool) (*Attachment, io.ReadCloser, error) {
+	a, err := m.GetAttachment(ctx, productID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rc, err := openFile(ctx, m.blobs, a, thumb)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return a, rc, nil
+}
+
+// DeleteAttachment removes an Attachment from a Product along with its files.
+func (m *Memory) DeleteAttachment(ctx context.Context, productID, id string) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	m.mu.Lock()
+	a, ok := m.attachments[id]
+	if ok && a.ProductID == productID {
+		delete(m.attachments, id)
+	}
+	m.mu.Unlock()
+
+	if !ok || a.ProductID != productID {
+		return ErrAttachmentNotFound
+	}
+
+	return deleteFiles(ctx, m.blobs, productID, id, a.ThumbnailURL != nil)
+}
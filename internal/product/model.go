@@ -2,26 +2,52 @@ package product
 
 import (
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/rakshans1/service/internal/platform/money"
 )
 
-// Product is an item we sell.
+// Product is an item we sell. Sold and Revenue are net of refunds. A Product
+// may be sold in several currencies so Revenue has a total for each of them.
+// Version starts at 1 and is incremented on every change so concurrent writers
+// can detect that their copy is stale. A deleted Product stays in the trash,
+// with DeletedAt and DeletedBy set, until it is restored or purged. Threshold
+// is the reorder threshold: once Quantity falls below it the Product is low on
+// stock. A zero Threshold turns this off.
+//
+// A Product may come in Variants, such as the sizes of a shirt, each with its
+// own SKU, cost and stock. The Quantity of such a Product is the total of its
+// Variants and is changed through them.
 type Product struct {
-	ID          string    `db:"product_id" json:"id"`
-	Name        string    `db:"name" json:"name"`
-	Cost        int       `db:"cost" json:"cost"`
-	Quantity    int       `db:"quantity" json:"quantity"`
-	Sold        int       `db:"sold" json:"sold"`
-	Revenue     int       `db:"revenue" json:"revenue"`
-	UserID      string    `db:"user_id" json:"user_id"`
-	DateCreated time.Time `db:"date_created" json:"date_created"`
-	DateUpdated time.Time `db:"date_updated" json:"date_updated"`
+	ID          string         `db:"product_id" json:"id"`
+	Name        string         `db:"name" json:"name"`
+	Description string         `db:"description" json:"description,omitempty"`
+	Cost        money.Money    `db:"cost" json:"cost"`
+	Quantity    int            `db:"quantity" json:"quantity"`
+	Threshold   int            `db:"reorder_threshold" json:"reorder_threshold,omitempty"`
+	Sold        int            `db:"sold" json:"sold"`
+	Revenue     money.Totals   `db:"revenue" json:"revenue"`
+	UserID      string         `db:"user_id" json:"user_id"`
+	CategoryID  *string        `db:"category_id" json:"category_id,omitempty"`
+	Tags        pq.StringArray `db:"tags" json:"tags,omitempty"`
+	Version     int            `db:"version" json:"version"`
+	DateCreated time.Time      `db:"date_created" json:"date_created"`
+	DateUpdated time.Time      `db:"date_updated" json:"date_updated"`
+	DeletedAt   *time.Time     `db:"deleted_at" json:"deleted_at,omitempty"`
+	DeletedBy   *string        `db:"deleted_by" json:"deleted_by,omitempty"`
+	Attachments Attachments    `db:"attachments" json:"attachments,omitempty"`
+	Variants    Variants       `db:"variants" json:"variants,omitempty"`
 }
 
 // NewProduct is what we require from clients when adding a Product.
 type NewProduct struct {
-	Name     string `json:"name" validate:"required"`
-	Cost     int    `json:"cost" validate:"gte=0"`
-	Quantity int    `json:"quantity" validate:"gte=1"`
+	Name        string      `json:"name" validate:"required"`
+	Description string      `json:"description"`
+	Cost        money.Money `json:"cost"`
+	Quantity    int         `json:"quantity" validate:"gte=1"`
+	Threshold   int         `json:"reorder_threshold" validate:"gte=0"`
+	CategoryID  *string     `json:"category_id" validate:"omitempty,uuid"`
+	Tags        []string    `json:"tags" validate:"omitempty,dive,required,max=64"`
 }
 
 // UpdateProduct defines what information may be provided to modify an
@@ -29,27 +55,282 @@ type NewProduct struct {
 // fields they want changed. It uses pointer fields so we can differentiate
 // between a field that was not provided and a field that was provided as
 // explicitly blank. Normally we do not want to use pointers to basic types but
-// we make exceptions around marshalling/unmarshalling.
+// we make exceptions around marshalling/unmarshalling. An empty CategoryID
+// removes the Product from its category and a non-nil Tags replaces all of
+// its tags.
 type UpdateProduct struct {
-	Name     *string `json:"name"`
-	Cost     *int    `json:"cost" validate:"omitempty,gte=0"`
-	Quantity *int    `json:"quantity" validate:"omitempty,gte=1"`
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Cost        *money.Money `json:"cost"`
+	Quantity    *int         `json:"quantity" validate:"omitempty,gte=1"`
+	Threshold   *int         `json:"reorder_threshold" validate:"omitempty,gte=0"`
+	CategoryID  *string      `json:"category_id" validate:"omitempty,uuid_or_empty"`
+	Tags        []string     `json:"tags" validate:"omitempty,dive,required,max=64"`
+}
+
+// These are the keys List accepts for ordering Products. Costs are ordered by
+// amount whatever their currency and revenue by the total in the currency of
+// the cost, so filter by currency to compare like with like.
+const (
+	SortName        = "name"
+	SortCost        = "cost"
+	SortSold        = "sold"
+	SortRevenue     = "revenue"
+	SortDateCreated = "date_created"
+)
+
+// ListFilter holds the optional criteria used to narrow, order and page
+// through the Products returned by List. The zero value lists the first page
+// of all products ordered by creation date.
+type ListFilter struct {
+	Name     string // Case-insensitive substring of the product name.
+	MinCost  *int   // Bounds on the cost amount, whatever its currency.
+	MaxCost  *int
+	Currency string // Only products costed in this currency.
+	UserID   string // Only products owned by this user.
+	InStock  bool   // Only products with a quantity above zero.
+	Deleted  bool   // List the trash instead of live products.
+
+	CategoryID string   // Only products in this category or its descendants.
+	Tags       []string // Only products with all of these tags.
+	SKU        string   // Only products with a variant whose SKU starts with this.
+
+	Sort   string // One of the Sort* keys. Defaults to SortDateCreated.
+	Desc   bool
+	Limit  int
+	Cursor string // The NextCursor of a previous page.
+}
+
+// SearchQuery describes a full-text search of Products. Every word of Text
+// must match the name or description, as a prefix so results appear while a
+// user is still typing.
+type SearchQuery struct {
+	Text   string
+	Limit  int
+	Cursor string // NextCursor of the previous page.
+}
+
+// ProductPage is one page of Products along with what a client needs to
+// fetch the next one. NextCursor is empty on the last page.
+type ProductPage struct {
+	Items      []Product `json:"items"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
 }
 
 // Sale represents one item of a transaction where some amount of a product was
 // sold. Quantity is the number of units sold and Paid is the total price paid.
 // Note that due to haggling the Paid value might not equal Quantity sold *
-// Product cost.
+// Product cost, and it may be paid in a different currency. UserID is the
+// seller, which is unknown for sales recorded before sellers were tracked.
+// OrderID is set for sales made as a line of an Order and Line numbers them
+// from 1 in the order they were placed. VariantID is set when a particular
+// Variant of the Product was sold.
+//
+// A sale made with a promotion code records the Promotion, the Discount it
+// gave off the list price and the Expected amount to be paid after it, both
+// in the currency of Paid.
 type Sale struct {
-	ID          string    `db:"sale_id" json:"id"`
+	ID          string      `db:"sale_id" json:"id"`
+	ProductID   string      `db:"product_id" json:"product_id"`
+	VariantID   *string     `db:"variant_id" json:"variant_id,omitempty"`
+	Quantity    int         `db:"quantity" json:"quantity"`
+	Paid        money.Money `db:"paid" json:"paid"`
+	UserID      *string     `db:"user_id" json:"user_id"`
+	OrderID     *string     `db:"order_id" json:"order_id,omitempty"`
+	Line        int         `db:"line" json:"line,omitempty"`
+	PromotionID *string     `db:"promotion_id" json:"promotion_id,omitempty"`
+	Discount    int         `db:"discount" json:"discount,omitempty"`
+	Expected    *int        `db:"expected" json:"expected,omitempty"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+}
+
+// SalesFilter narrows and pages through the Sales of a Product. Sales are
+// included when From <= date created < To; a zero From or To leaves that end
+// of the range open.
+type SalesFilter struct {
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Cursor string // The NextCursor of a previous page.
+}
+
+// SalePage is one page of Sales, oldest first. NextCursor is empty on the last
+// page.
+type SalePage struct {
+	Items      []Sale `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// NewSale is what we require from clients for recording new transactions.
+// Code is an optional promotion code; a sale using one must be paid exactly
+// its discounted price in the currency of the Product. VariantID is required
+// for a Product with Variants.
+type NewSale struct {
+	VariantID *string     `json:"variant_id" validate:"omitempty,uuid"`
+	Quantity  int         `json:"quantity" validate:"gte=1"`
+	Paid      money.Money `json:"paid"`
+	Code      string      `json:"code,omitempty"`
+}
+
+// Order is a checkout of several Products at once. Each line is recorded as a
+// Sale and Totals holds what was paid for all of them, per currency.
+type Order struct {
+	ID          string       `db:"order_id" json:"id"`
+	UserID      string       `db:"user_id" json:"user_id"`
+	Items       []Sale       `db:"-" json:"items"`
+	Totals      money.Totals `db:"-" json:"totals"`
+	DateCreated time.Time    `db:"date_created" json:"date_created"`
+}
+
+// NewOrder is what we require from clients for placing an Order. Code is an
+// optional promotion code. It is redeemed once for the whole Order and
+// discounts every line it covers, which must be paid exactly their discounted
+// price in the currency of their Product.
+type NewOrder struct {
+	Items []NewOrderItem `json:"items" validate:"required,min=1,dive"`
+	Code  string         `json:"code,omitempty"`
+}
+
+// NewOrderItem is one line of a NewOrder. A Product may appear on more than one
+// line; the stock check covers all of them together.
+type NewOrderItem struct {
+	ProductID string      `json:"product_id" validate:"required,uuid"`
+	VariantID *string     `json:"variant_id" validate:"omitempty,uuid"`
+	Quantity  int         `json:"quantity" validate:"gte=1"`
+	Paid      money.Money `json:"paid"`
+}
+
+// Refund reverses all or part of a Sale. Quantity units are put back into
+// stock and Amount is returned to the customer. A void is a Refund of
+// everything that remained of a Sale recorded in error. Amount is always in
+// the currency of the Sale.
+type Refund struct {
+	ID          string      `db:"refund_id" json:"id"`
+	SaleID      string      `db:"sale_id" json:"sale_id"`
+	ProductID   string      `db:"product_id" json:"product_id"`
+	Quantity    int         `db:"quantity" json:"quantity"`
+	Amount      money.Money `db:"amount" json:"amount"`
+	Reason      string      `db:"reason" json:"reason"`
+	Void        bool        `db:"void" json:"void"`
+	UserID      string      `db:"user_id" json:"user_id"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+}
+
+// NewRefund is what we require from clients for refunding part of a Sale.
+// Amount is in the minor unit of the currency the Sale was paid in.
+type NewRefund struct {
+	Quantity int    `json:"quantity" validate:"gte=0"`
+	Amount   int    `json:"amount" validate:"gte=0"`
+	Reason   string `json:"reason" validate:"required"`
+}
+
+// NewVoid is what we require from clients for voiding a Sale.
+type NewVoid struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// These are the kinds of file that can be attached to a Product.
+const (
+	AttachmentImage    = "image"
+	AttachmentDocument = "document"
+)
+
+// Attachment is a file uploaded for a Product, such as a photo or a manual.
+// The file itself is kept in a blob store and downloaded from URL, which is
+// relative to the root of the API. Images also have a smaller thumbnail.
+type Attachment struct {
+	ID           string    `db:"attachment_id" json:"id"`
+	ProductID    string    `db:"product_id" json:"product_id"`
+	Kind         string    `db:"kind" json:"kind"`
+	Filename     string    `db:"filename" json:"filename"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	Size         int64     `db:"size" json:"size"`
+	URL          string    `db:"url" json:"url"`
+	ThumbnailURL *string   `db:"thumbnail_url" json:"thumbnail_url,omitempty"`
+	UserID       string    `db:"user_id" json:"user_id"`
+	DateCreated  time.Time `db:"date_created" json:"date_created"`
+}
+
+// Attachments are the files attached to a Product, oldest first. They are
+// read from the JSON array the database builds for each Product.
+type Attachments []Attachment
+
+// Variant is one version of a Product, such as a size and colour of a shirt.
+// SKU is the stock keeping unit that identifies it, unique across all
+// Variants. Attributes describe how it differs from the other Variants.
+type Variant struct {
+	ID          string      `db:"variant_id" json:"id"`
+	ProductID   string      `db:"product_id" json:"product_id"`
+	SKU         string      `db:"sku" json:"sku"`
+	Attributes  Attributes  `db:"attributes" json:"attributes"`
+	Cost        money.Money `db:"cost" json:"cost"`
+	Quantity    int         `db:"quantity" json:"quantity"`
+	DateCreated time.Time   `db:"date_created" json:"date_created"`
+	DateUpdated time.Time   `db:"date_updated" json:"date_updated"`
+}
+
+// Variants are the Variants of a Product ordered by SKU. They are read from
+// the JSON array the database builds for each Product.
+type Variants []Variant
+
+// Attributes name the properties of a Variant, such as "size": "XL".
+type Attributes map[string]string
+
+// NewVariant is what we require from clients when adding a Variant. SKUs are
+// stored trimmed and upper cased.
+type NewVariant struct {
+	SKU        string      `json:"sku" validate:"required,max=64"`
+	Attributes Attributes  `json:"attributes" validate:"omitempty,dive,keys,required,max=64,endkeys,max=256"`
+	Cost       money.Money `json:"cost"`
+	Quantity   int         `json:"quantity" validate:"gte=0"`
+}
+
+// UpdateVariant defines what information may be provided to modify an
+// existing Variant. A non-nil Attributes replaces all of them.
+type UpdateVariant struct {
+	SKU        *string      `json:"sku" validate:"omitempty,min=1,max=64"`
+	Attributes Attributes   `json:"attributes" validate:"omitempty,dive,keys,required,max=64,endkeys,max=256"`
+	Cost       *money.Money `json:"cost"`
+	Quantity   *int         `json:"quantity" validate:"omitempty,gte=0"`
+}
+
+// KindLowStock is the kind of notification sent for a StockAlert.
+const KindLowStock = "product.low_stock"
+
+// StockAlert records a Product falling below its reorder threshold. One is
+// raised each time the Product crosses below it; no more are raised until its
+// stock is replenished to at least the threshold.
+type StockAlert struct {
+	ID          string    `db:"alert_id" json:"id"`
 	ProductID   string    `db:"product_id" json:"product_id"`
+	Name        string    `db:"name" json:"name"`
 	Quantity    int       `db:"quantity" json:"quantity"`
-	Paid        int       `db:"paid" json:"paid"`
+	Threshold   int       `db:"threshold" json:"reorder_threshold"`
 	DateCreated time.Time `db:"date_created" json:"date_created"`
 }
 
-// NewSale is what we require from clients for recording new transactions.
-type NewSale struct {
-	Quantity int `json:"quantity" validate:"gte=0"`
-	Paid     int `json:"paid" validate:"gte=0"`
+// These are the Product fields whose changes are recorded in its history.
+const (
+	FieldName        = "name"
+	FieldDescription = "description"
+	FieldCost        = "cost"
+	FieldQuantity    = "quantity"
+	FieldThreshold   = "reorder_threshold"
+	FieldCategoryID  = "category_id"
+	FieldTags        = "tags"
+)
+
+// Change records one field of a Product being modified by an update, or its
+// quantity moving with a sale, refund or change to its Variants. Values are
+// kept as text, with costs in the form "1999 USD"; a nil value means the field
+// was empty, such as a Product with no category.
+type Change struct {
+	ID          string    `db:"change_id" json:"id"`
+	ProductID   string    `db:"product_id" json:"product_id"`
+	Field       string    `db:"field" json:"field"`
+	OldValue    *string   `db:"old_value" json:"old_value"`
+	NewValue    *string   `db:"new_value" json:"new_value"`
+	ChangedBy   string    `db:"changed_by" json:"changed_by"`
+	DateChanged time.Time `db:"date_changed" json:"date_changed"`
 }
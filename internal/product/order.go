@@ -0,0 +1,273 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors for orders.
+var (
+	// ErrOrderNotFound is used when a specific Order is requested but does not
+	// exist.
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+// CreateOrder records an Order and one Sale for each of its lines in a single
+// transaction, so either every line is sold or none is. It returns ErrNotFound
+// if a line names a Product that does not exist and an *InsufficientStockError
+// if a Product does not have enough units on hand for all the lines naming it.
+// The user making the call is recorded as the seller. A promotion code is
+// redeemed once for the whole order; see applyPromotion. Lines for a Product
+// with Variants must each name one of them.
+func (pg *Postgres) CreateOrder(ctx context.Context, user auth.Claims, no NewOrder, now time.Time) (*Order, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.createorder")
+	defer span.End()
+
+	o, requested, requestedVariants, err := newOrder(user, no, now)
+	if err != nil {
+		return nil, err
+	}
+	ids := sortedKeys(requested)
+	variantIDs := sortedKeys(requestedVariants)
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting order transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the product rows in id order. Concurrent orders sharing products
+	// then always take the locks in the same order and cannot deadlock.
+	const lock = `SELECT ` + lockedProductColumns + ` FROM products
+		WHERE product_id = ANY($1::uuid[]) AND deleted_at IS NULL
+		ORDER BY product_id
+		FOR UPDATE`
+
+	var locked []lockedProduct
+	if err := tx.SelectContext(ctx, &locked, lock, pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "locking products")
+	}
+	if len(locked) != len(ids) {
+		return nil, ErrNotFound
+	}
+
+	products := make(map[string]lockedProduct, len(locked))
+	for _, p := range locked {
+		products[p.ProductID] = p
+	}
+	if err := checkProducts(ids, products, requested); err != nil {
+		return nil, err
+	}
+
+	// Variants are locked after the Products that own them, as everywhere.
+	var variants map[string]lockedVariant
+	if len(variantIDs) > 0 {
+		if variants, err = lockVariants(ctx, tx, variantIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkVariants(o.Items, products, variants, variantIDs, requestedVariants); err != nil {
+		return nil, err
+	}
+
+	if no.Code != "" {
+		sales := make([]*Sale, len(o.Items))
+		for i := range o.Items {
+			sales[i] = &o.Items[i]
+		}
+		if err := applyPromotion(ctx, tx, no.Code, products, variants, sales, now); err != nil {
+			return nil, err
+		}
+	}
+
+	const order = `INSERT INTO orders
+		(order_id, user_id, date_created)
+		VALUES ($1, $2, $3)`
+
+	if _, err := tx.ExecContext(ctx, order, o.ID, o.UserID, o.DateCreated); err != nil {
+		return nil, errors.Wrap(err, "inserting order")
+	}
+
+	const decrement = `UPDATE products SET
+		"quantity" = quantity - $2,
+		"version" = version + 1
+		WHERE product_id = $1`
+
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, decrement, id, requested[id]); err != nil {
+			return nil, errors.Wrap(err, "decrementing product quantity")
+		}
+		old := products[id].Quantity
+		if err := recordQuantity(ctx, tx, user, id, old, old-requested[id], now); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range variantIDs {
+		if _, err := tx.ExecContext(ctx, decrementVariant, id, requestedVariants[id]); err != nil {
+			return nil, errors.Wrap(err, "decrementing variant quantity")
+		}
+	}
+
+	if err := checkStock(ctx, tx, ids, now); err != nil {
+		return nil, err
+	}
+
+	for _, s := range o.Items {
+		if err := insertSale(ctx, tx, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing order")
+	}
+
+	return o, nil
+}
+
+// newOrder builds the Order user places with no, with a Sale for each of its
+// lines. It also works out how many units of each Product and Variant the
+// order takes in total.
+func newOrder(user auth.Claims, no NewOrder, now time.Time) (*Order, map[string]int, map[string]int, error) {
+	o := Order{
+		ID:          uuid.New().String(),
+		UserID:      user.Subject,
+		Items:       make([]Sale, len(no.Items)),
+		DateCreated: now.UTC(),
+	}
+
+	requested := make(map[string]int)
+	requestedVariants := make(map[string]int)
+	paid := make([]money.Money, len(no.Items))
+	for i, item := range no.Items {
+		if _, err := uuid.Parse(item.ProductID); err != nil {
+			return nil, nil, nil, ErrInvalidID
+		}
+		if item.VariantID != nil {
+			if _, err := uuid.Parse(*item.VariantID); err != nil {
+				return nil, nil, nil, ErrInvalidID
+			}
+			requestedVariants[*item.VariantID] += item.Quantity
+		}
+		requested[item.ProductID] += item.Quantity
+		paid[i] = item.Paid
+
+		o.Items[i] = Sale{
+			ID:          uuid.New().String(),
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			Quantity:    item.Quantity,
+			Paid:        item.Paid,
+			UserID:      &o.UserID,
+			OrderID:     &o.ID,
+			Line:        i + 1,
+			DateCreated: o.DateCreated,
+		}
+	}
+	o.Totals = money.Sum(paid)
+
+	return &o, requested, requestedVariants, nil
+}
+
+// checkProducts checks that each of the locked Products identified by ids has
+// the units an order requests of it, taking them in the order they are
+// locked.
+func checkProducts(ids []string, products map[string]lockedProduct, requested map[string]int) error {
+	for _, id := range ids {
+		if p := products[id]; p.Quantity < requested[id] {
+			return &InsufficientStockError{
+				ProductID: id,
+				Available: p.Quantity,
+				Requested: requested[id],
+			}
+		}
+	}
+	return nil
+}
+
+// checkVariants checks that each line of an order for a Product with Variants
+// names one of them, and that each of the locked Variants identified by
+// variantIDs has the units the order requests of it.
+func checkVariants(items []Sale, products map[string]lockedProduct, variants map[string]lockedVariant, variantIDs []string, requested map[string]int) error {
+	for _, s := range items {
+		if s.VariantID == nil {
+			if products[s.ProductID].HasVariants {
+				return ErrVariantRequired
+			}
+			continue
+		}
+		if variants[*s.VariantID].ProductID != s.ProductID {
+			return ErrVariantNotFound
+		}
+	}
+	for _, id := range variantIDs {
+		if v := variants[id]; v.Quantity < requested[id] {
+			return &InsufficientStockError{
+				ProductID: v.ProductID,
+				VariantID: id,
+				Available: v.Quantity,
+				Requested: requested[id],
+			}
+		}
+	}
+	return nil
+}
+
+// sortedKeys gives the ids counted in m in order, which is the order their
+// rows are locked in.
+func sortedKeys(m map[string]int) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// GetOrder finds the Order identified by a given ID along with its Sales.
+// Only admins may see the orders of other users.
+func (pg *Postgres) GetOrder(ctx context.Context, user auth.Claims, id string) (*Order, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.getorder")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var o Order
+
+	const q = `SELECT order_id, user_id, date_created FROM orders WHERE order_id = $1`
+	if err := pg.db.GetContext(ctx, &o, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOrderNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single order")
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && o.UserID != user.Subject {
+		return nil, ErrForbidden
+	}
+
+	o.Items = []Sale{}
+	const items = selectSales + ` WHERE order_id = $1 ORDER BY line, sale_id`
+	if err := pg.db.SelectContext(ctx, &o.Items, items, id); err != nil {
+		return nil, errors.Wrap(err, "selecting order sales")
+	}
+
+	paid := make([]money.Money, len(o.Items))
+	for i, s := range o.Items {
+		paid[i] = s.Paid
+	}
+	o.Totals = money.Sum(paid)
+
+	return &o, nil
+}
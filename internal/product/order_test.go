@@ -0,0 +1,134 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestOrders(t *testing.T) {
+	eachStore(t, testOrders)
+}
+
+func testOrders(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	pens, err := store.Create(ctx, claims, product.NewProduct{Name: "Pens", Cost: money.Money{Amount: 5, Currency: "INR"}, Quantity: 10}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	paper, err := store.Create(ctx, claims, product.NewProduct{Name: "Paper", Cost: money.Money{Amount: 2, Currency: "INR"}, Quantity: 4}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	quantities := func() (int, int) {
+		t.Helper()
+		pe, err := store.Get(ctx, pens.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		pa, err := store.Get(ctx, paper.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		return pe.Quantity, pa.Quantity
+	}
+
+	{ // Place and get
+
+		no := product.NewOrder{Items: []product.NewOrderItem{
+			{ProductID: pens.ID, Quantity: 3, Paid: money.Money{Amount: 15, Currency: "INR"}},
+			{ProductID: paper.ID, Quantity: 2, Paid: money.Money{Amount: 4, Currency: "INR"}},
+			{ProductID: pens.ID, Quantity: 1, Paid: money.Money{Amount: 1, Currency: "USD"}},
+		}}
+
+		o, err := store.CreateOrder(ctx, claims, no, now)
+		if err != nil {
+			t.Fatalf("creating order: %s", err)
+		}
+
+		want := money.Totals{{Amount: 19, Currency: "INR"}, {Amount: 1, Currency: "USD"}}
+		if diff := cmp.Diff(want, o.Totals); diff != "" {
+			t.Fatalf("order totals did not match:\n%s", diff)
+		}
+
+		if pe, pa := quantities(); pe != 6 || pa != 2 {
+			t.Fatalf("expected 6 pens and 2 paper left, got %v and %v", pe, pa)
+		}
+
+		saved, err := store.GetOrder(ctx, claims, o.ID)
+		if err != nil {
+			t.Fatalf("getting order: %s", err)
+		}
+		if exp, got := 3, len(saved.Items); exp != got {
+			t.Fatalf("expected %v order sales, got %v", exp, got)
+		}
+		if diff := cmp.Diff(o.Totals, saved.Totals); diff != "" {
+			t.Fatalf("saved order totals did not match:\n%s", diff)
+		}
+
+		// The lines read back in the order they were placed.
+		for i, item := range no.Items {
+			got := saved.Items[i]
+			if got.Line != i+1 || got.ProductID != item.ProductID || got.Paid != item.Paid {
+				t.Fatalf("expected line %d to be %+v, got %+v", i+1, item, got)
+			}
+		}
+
+		page, err := store.ListSales(ctx, paper.ID, product.SalesFilter{})
+		if err != nil {
+			t.Fatalf("listing sales: %s", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].OrderID == nil || *page.Items[0].OrderID != o.ID {
+			t.Fatalf("expected the paper sale to belong to order %s, got %+v", o.ID, page.Items)
+		}
+
+		other := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+		if _, err := store.GetOrder(ctx, other, o.ID); err != product.ErrForbidden {
+			t.Fatalf("getting another user's order: expected %v, got %v", product.ErrForbidden, err)
+		}
+	}
+
+	{ // Nothing is sold when one line fails
+
+		// Each line fits on its own but together they want 7 of the 6 pens.
+		no := product.NewOrder{Items: []product.NewOrderItem{
+			{ProductID: paper.ID, Quantity: 1, Paid: money.Money{Amount: 2, Currency: "INR"}},
+			{ProductID: pens.ID, Quantity: 4, Paid: money.Money{Amount: 20, Currency: "INR"}},
+			{ProductID: pens.ID, Quantity: 3, Paid: money.Money{Amount: 15, Currency: "INR"}},
+		}}
+
+		_, err := store.CreateOrder(ctx, claims, no, now)
+		stockErr, ok := err.(*product.InsufficientStockError)
+		if !ok {
+			t.Fatalf("overselling: expected *InsufficientStockError, got %v", err)
+		}
+		if stockErr.ProductID != pens.ID || stockErr.Requested != 7 {
+			t.Fatalf("expected 7 pens to be requested, got %+v", stockErr)
+		}
+
+		missing := "6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11"
+		no.Items[1].ProductID = missing
+		if _, err := store.CreateOrder(ctx, claims, no, now); err != product.ErrNotFound {
+			t.Fatalf("ordering a missing product: expected %v, got %v", product.ErrNotFound, err)
+		}
+
+		if pe, pa := quantities(); pe != 6 || pa != 2 {
+			t.Fatalf("expected stock to be untouched at 6 pens and 2 paper, got %v and %v", pe, pa)
+		}
+	}
+
+	if _, err := store.GetOrder(ctx, claims, "6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11"); err != product.ErrOrderNotFound {
+		t.Fatalf("getting a missing order: expected %v, got %v", product.ErrOrderNotFound, err)
+	}
+}
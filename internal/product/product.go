@@ -3,12 +3,18 @@ package product
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/category"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
 	"go.opentelemetry.io/otel/api/global"
 )
 
@@ -23,81 +29,369 @@ var (
 	// ErrForbidden occurs when a user tries to do something that is forbidden to
 	// them according to our access control policies.
 	ErrForbidden = errors.New("Attempted action is not allowed")
+
+	// ErrVersionConflict is used when a Product is modified based on a version
+	// that is no longer current.
+	ErrVersionConflict = errors.New("product has been modified since it was read")
+
+	// ErrInvalidSort is used when a listing is requested in an unknown order.
+	ErrInvalidSort = errors.New("sort key is not recognized")
+
+	// ErrInvalidCursor is used when a pagination cursor is malformed or was
+	// issued for a different ordering.
+	ErrInvalidCursor = errors.New("cursor is not valid for this listing")
+
+	// ErrCategoryNotFound is used when a Product is placed in a category that
+	// does not exist.
+	ErrCategoryNotFound = errors.New("category not found")
+
+	// ErrNeedsDatabase is used by a Store without a database when asked for
+	// categories or promotions, which only a database keeps.
+	ErrNeedsDatabase = errors.New("categories and promotions need a database")
 )
 
-// List gets all Products from the database.
-func List(ctx context.Context, db *sqlx.DB) ([]Product, error) {
+// DefaultLimit and MaxLimit bound the number of Products returned per page.
+const (
+	DefaultLimit = 50
+	MaxLimit     = 500
+)
+
+// productColumns are the columns read for a Product, including its sales
+// aggregates. They refer to the tables joined by productsFrom.
+const productColumns = `
+		p.product_id, p.name, p.description,
+		p.cost AS "cost.amount", p.currency AS "cost.currency",
+		p.quantity, p.reorder_threshold, p.user_id, p.category_id, p.tags,
+		p.version, p.date_created, p.date_updated,
+		p.deleted_at, p.deleted_by,
+		s.quantity - r.quantity AS sold,
+		m.revenue, files.attachments, vars.variants`
+
+// productsFrom joins products to their sales aggregates. Sales and refunds
+// are summed per row so the planner can look them up by product instead of
+// aggregating the whole table. Money is never summed across currencies:
+// revenue is a JSON array with one total per currency. Attachments and
+// variants are gathered into JSON arrays the same way.
+const productsFrom = `
+	FROM products AS p
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(SUM(quantity), 0) AS quantity
+		FROM sales WHERE sales.product_id = p.product_id
+	) AS s
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(SUM(quantity), 0) AS quantity
+		FROM refunds WHERE refunds.product_id = p.product_id
+	) AS r
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(
+			json_agg(json_build_object('amount', t.amount, 'currency', t.currency) ORDER BY t.currency),
+			'[]'
+		) AS revenue
+		FROM (
+			SELECT e.currency, SUM(e.amount) AS amount
+			FROM (
+				SELECT currency, paid AS amount
+				FROM sales WHERE sales.product_id = p.product_id
+				UNION ALL
+				SELECT currency, -amount
+				FROM refunds WHERE refunds.product_id = p.product_id
+			) AS e
+			GROUP BY e.currency
+		) AS t
+	) AS m
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(
+			json_agg(json_build_object(
+				'id', f.attachment_id, 'product_id', f.product_id, 'kind', f.kind,
+				'filename', f.filename, 'content_type', f.content_type, 'size', f.size,
+				'url', f.url, 'thumbnail_url', f.thumbnail_url, 'user_id', f.user_id,
+				'date_created', f.date_created AT TIME ZONE 'UTC'
+			) ORDER BY f.date_created, f.attachment_id),
+			'[]'
+		) AS attachments
+		FROM (
+			SELECT` + attachmentColumns + `
+			FROM attachments AS a WHERE a.product_id = p.product_id
+		) AS f
+	) AS files
+	CROSS JOIN LATERAL (
+		SELECT COALESCE(
+			json_agg(json_build_object(
+				'id', v.variant_id, 'product_id', v.product_id, 'sku', v.sku,
+				'attributes', v.attributes,
+				'cost', json_build_object('amount', v.cost, 'currency', v.currency),
+				'quantity', v.quantity,
+				'date_created', v.date_created AT TIME ZONE 'UTC',
+				'date_updated', v.date_updated AT TIME ZONE 'UTC'
+			) ORDER BY v.sku),
+			'[]'
+		) AS variants
+		FROM variants AS v WHERE v.product_id = p.product_id
+	) AS vars`
+
+// selectProducts reads product rows along with their sales aggregates.
+const selectProducts = `SELECT` + productColumns + productsFrom
+
+// sortKey describes how an ordering is applied. The expression refers to the
+// aggregated product rows List pages through and cast is the type a cursor
+// value is converted to before comparing.
+type sortKey struct {
+	expr  string
+	cast  string
+	value func(Product) string
+}
+
+// sortKeys holds the sortKey of each supported ordering.
+var sortKeys = map[string]sortKey{
+	SortName: {"p.name", "text", func(p Product) string { return p.Name }},
+	SortCost: {`p."cost.amount"`, "int", func(p Product) string { return strconv.Itoa(p.Cost.Amount) }},
+	SortSold: {"p.sold", "bigint", func(p Product) string { return strconv.Itoa(p.Sold) }},
+	SortRevenue: {
+		`COALESCE((SELECT (x->>'amount')::bigint FROM json_array_elements(p.revenue) AS x
+			WHERE x->>'currency' = p."cost.currency"), 0)`,
+		"bigint",
+		func(p Product) string { return strconv.Itoa(p.Revenue.In(p.Cost.Currency)) },
+	},
+	SortDateCreated: {"p.date_created", "timestamp", func(p Product) string { return p.DateCreated.Format(time.RFC3339Nano) }},
+}
+
+// likeEscaper escapes the LIKE wildcards in user provided search text.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List gets a page of Products from the database matching the filter.
+func (pg *Postgres) List(ctx context.Context, f ListFilter) (*ProductPage, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "internal.product.list")
 	defer span.End()
 
-	products := []Product{}
+	key, err := checkListFilter(&f)
+	if err != nil {
+		return nil, err
+	}
 
-	const q = `SELECT 
-					p.*,
-					COALESCE(SUM(s.quantity),0) AS sold,
-					COALESCE(SUM(s.paid),0) AS revenue
-					FROM products AS p
-					LEFT JOIN sales AS s ON p.product_id = s.product_id
-					GROUP BY p.product_id
-					`
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
 
-	if err := db.SelectContext(ctx, &products, q); err != nil {
+	where := []string{"p.deleted_at IS NULL"}
+	if f.Deleted {
+		where[0] = "p.deleted_at IS NOT NULL"
+	}
+	if f.Name != "" {
+		where = append(where, "p.name ILIKE '%' || "+arg(likeEscaper.Replace(f.Name))+" || '%'")
+	}
+	if f.MinCost != nil {
+		where = append(where, "p.cost >= "+arg(*f.MinCost))
+	}
+	if f.MaxCost != nil {
+		where = append(where, "p.cost <= "+arg(*f.MaxCost))
+	}
+	if f.Currency != "" {
+		where = append(where, "p.currency = "+arg(f.Currency))
+	}
+	if f.UserID != "" {
+		where = append(where, "p.user_id = "+arg(f.UserID))
+	}
+	if f.InStock {
+		where = append(where, "p.quantity > 0")
+	}
+	if f.CategoryID != "" {
+		where = append(where, "p.category_id IN ("+category.SubtreeQuery(arg(f.CategoryID))+")")
+	}
+	if len(f.Tags) > 0 {
+		where = append(where, "p.tags @> "+arg(pq.Array(normalizeTags(f.Tags)))+"::text[]")
+	}
+	if sku := normalizeSKU(f.SKU); sku != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM variants AS v
+			WHERE v.product_id = p.product_id AND v.sku LIKE `+arg(likeEscaper.Replace(sku))+` || '%')`)
+	}
+	filter := "WHERE " + strings.Join(where, " AND ")
+
+	page := ProductPage{
+		Items: []Product{},
+	}
+
+	q := `SELECT COUNT(*) FROM products AS p ` + filter
+	if err := pg.db.GetContext(ctx, &page.Total, q, args...); err != nil {
+		return nil, errors.Wrap(err, "counting products")
+	}
+
+	// Pages are walked with keyset pagination on the sort column, using the
+	// product id to break ties, so deep pages cost no more than the first.
+	sort, op, dir := listSort(f), ">", "ASC"
+	if f.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	after := ""
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		after = fmt.Sprintf("WHERE (%s, p.product_id) %s (%s::%s, %s::uuid)",
+			key.expr, op, arg(c.Value), key.cast, arg(c.ID))
+	}
+
+	q = `SELECT * FROM (` + selectProducts + ` ` + filter + `) AS p
+		` + after + `
+		ORDER BY ` + key.expr + ` ` + dir + `, p.product_id ` + dir + `
+		LIMIT ` + arg(f.Limit+1)
+
+	if err := pg.db.SelectContext(ctx, &page.Items, q, args...); err != nil {
 		return nil, errors.Wrap(err, "selecting products")
 	}
 
-	return products, nil
+	trimProducts(&page, f.Limit, sort, key)
+
+	return &page, nil
+}
+
+// checkListFilter fills in the defaults of f and checks what it asks for. It
+// gives the sortKey the Products are listed by.
+func checkListFilter(f *ListFilter) (sortKey, error) {
+	if f.Sort == "" {
+		f.Sort = SortDateCreated
+	}
+	key, ok := sortKeys[f.Sort]
+	if !ok {
+		return key, ErrInvalidSort
+	}
+	f.Limit = pageLimit(f.Limit)
+	if f.UserID != "" {
+		if _, err := uuid.Parse(f.UserID); err != nil {
+			return key, ErrInvalidID
+		}
+	}
+	if f.CategoryID != "" {
+		if _, err := uuid.Parse(f.CategoryID); err != nil {
+			return key, ErrInvalidID
+		}
+	}
+	return key, nil
+}
+
+// listSort names the ordering of f in the cursors of its pages, so a cursor
+// cannot be used with another ordering or direction.
+func listSort(f ListFilter) string {
+	if f.Desc {
+		return "-" + f.Sort
+	}
+	return f.Sort
+}
+
+// trimProducts cuts page down to limit Products. The one extra Product asked
+// for tells there is another page, which starts after the last one kept.
+func trimProducts(page *ProductPage, limit int, sort string, key sortKey) {
+	if len(page.Items) <= limit {
+		return
+	}
+	page.Items = page.Items[:limit]
+	last := page.Items[limit-1]
+	page.NextCursor = encodeCursor(cursor{Sort: sort, Value: key.value(last), ID: last.ID})
 }
 
 // Create adds a Product to the database. It returns the created Product with
 // fields like ID and DateCreated populated.
-func Create(ctx context.Context, db *sqlx.DB, user auth.Claims, np NewProduct, now time.Time) (*Product, error) {
+func (pg *Postgres) Create(ctx context.Context, user auth.Claims, np NewProduct, now time.Time) (*Product, error) {
 
 	ctx, span := global.Tracer("service").Start(ctx, "internal.product.create")
 	defer span.End()
 
-	p := Product{
+	p := newProduct(user, np, now)
+
+	if err := insertProduct(ctx, pg.db, p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newProduct builds the Product a user creates from np. Its aggregates start
+// out empty the way Get reads them for a Product with no sales.
+func newProduct(user auth.Claims, np NewProduct, now time.Time) Product {
+	return Product{
 		ID:          uuid.New().String(),
 		Name:        np.Name,
+		Description: np.Description,
 		Cost:        np.Cost,
 		Quantity:    np.Quantity,
+		Threshold:   np.Threshold,
 		UserID:      user.Subject,
+		CategoryID:  np.CategoryID,
+		Tags:        normalizeTags(np.Tags),
+		Revenue:     money.Totals{},
+		Attachments: Attachments{},
+		Variants:    Variants{},
+		Version:     1,
 		DateCreated: now.UTC(),
 		DateUpdated: now.UTC(),
 	}
+}
 
+// insertProduct writes a new Product using either the database or a
+// transaction.
+func insertProduct(ctx context.Context, db sqlx.ExecerContext, p Product) error {
 	const q = `
 	INSERT INTO products
-	(product_id,user_id,name,cost,quantity,date_created,date_updated)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	(product_id,user_id,name,description,cost,currency,quantity,reorder_threshold,category_id,tags,version,date_created,date_updated)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
 
-	_, err := db.ExecContext(ctx, q, p.ID, p.UserID, p.Name, p.Cost, p.Quantity, p.DateCreated, p.DateUpdated)
+	_, err := db.ExecContext(ctx, q, p.ID, p.UserID, p.Name, p.Description, p.Cost.Amount, p.Cost.Currency, p.Quantity, p.Threshold, p.CategoryID, p.Tags, p.Version, p.DateCreated, p.DateUpdated)
 	if err != nil {
-		return nil, errors.Wrap(err, "inserting product")
+		if isCategoryViolation(err) {
+			return ErrCategoryNotFound
+		}
+		return errors.Wrap(err, "inserting product")
 	}
-	return &p, nil
+	return nil
 }
 
-// Get finds the product identified by a given ID.
-func Get(ctx context.Context, db *sqlx.DB, id string) (*Product, error) {
+// normalizeTags trims and lower cases tags and drops blanks and duplicates so
+// tag filters match regardless of how the tags were entered. It never returns
+// nil so the tags column is never written as NULL.
+func normalizeTags(tags []string) pq.StringArray {
+	out := pq.StringArray{}
+	seen := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// isCategoryViolation reports whether err is the database rejecting a
+// category_id that does not reference a category.
+func isCategoryViolation(err error) bool {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	return ok && pqErr.Code == "23503" && pqErr.Constraint == "products_category_id_fkey"
+}
+
+// Get finds the product identified by a given ID. Products in the trash are
+// reported as ErrNotFound.
+func (pg *Postgres) Get(ctx context.Context, id string) (*Product, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "product.get")
 	defer span.End()
 
+	return get(ctx, pg.db, id)
+}
+
+// get implements Get using either the database or a transaction.
+func get(ctx context.Context, db sqlx.QueryerContext, id string) (*Product, error) {
 	if _, err := uuid.Parse(id); err != nil {
 		return nil, ErrInvalidID
 	}
 
 	var p Product
 
-	const q = `SELECT
-			p.*,
-			COALESCE(SUM(s.quantity), 0) AS sold,
-			COALESCE(SUM(s.paid), 0) AS revenue
-		FROM products AS p
-		LEFT JOIN sales AS s ON p.product_id = s.product_id
-		WHERE p.product_id = $1
-		GROUP BY p.product_id`
+	const q = selectProducts + `
+		WHERE p.product_id = $1 AND p.deleted_at IS NULL`
 
-	if err := db.GetContext(ctx, &p, q, id); err != nil {
+	if err := sqlx.GetContext(ctx, db, &p, q, id); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNotFound
 		}
@@ -109,12 +403,36 @@ func Get(ctx context.Context, db *sqlx.DB, id string) (*Product, error) {
 }
 
 // Update modifies data about a Product. It will error if the specified ID is
-// invalid or does not reference an existing Product.
-func Update(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, update UpdateProduct, now time.Time) error {
+// invalid or does not reference an existing Product. When version is not zero
+// it must match the current Version of the Product or ErrVersionConflict is
+// returned. Every field that changes is recorded in the Product's history. A
+// change of quantity or threshold that leaves the Product below its reorder
+// threshold raises a StockAlert. The quantity of a Product with Variants is
+// changed through them; setting it here gives ErrHasVariants.
+func (pg *Postgres) Update(ctx context.Context, user auth.Claims, id string, update UpdateProduct, version int, now time.Time) error {
 	ctx, span := global.Tracer("service").Start(ctx, "internal.product.update")
 	defer span.End()
 
-	p, err := Get(ctx, db, id)
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting update transaction")
+	}
+	defer tx.Rollback()
+
+	if err := applyUpdate(ctx, tx, user, id, update, version, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing product update")
+	}
+
+	return nil
+}
+
+// applyUpdate implements Update within tx.
+func applyUpdate(ctx context.Context, tx *sqlx.Tx, user auth.Claims, id string, update UpdateProduct, version int, now time.Time) error {
+	p, err := get(ctx, tx, id)
 	if err != nil {
 		return err
 	}
@@ -126,46 +444,214 @@ func Update(ctx context.Context, db *sqlx.DB, user auth.Claims, id string, updat
 		return ErrForbidden
 	}
 
+	if version != 0 && version != p.Version {
+		return ErrVersionConflict
+	}
+
+	if update.Quantity != nil && len(p.Variants) > 0 {
+		return ErrHasVariants
+	}
+
+	before := *p
+	patchProduct(p, update)
+	p.DateUpdated = now
+
+	// The version read above is checked again so a write that lands between
+	// the read and this statement is not silently overwritten.
+	const q = `UPDATE products SET
+		"name" = $3,
+		"description" = $4,
+		"cost" = $5,
+		"currency" = $6,
+		"quantity" = $7,
+		"reorder_threshold" = $8,
+		"category_id" = $9,
+		"tags" = $10,
+		"date_updated" = $11,
+		"version" = version + 1
+		WHERE product_id = $1 AND version = $2`
+
+	res, err := tx.ExecContext(ctx, q, id, p.Version,
+		p.Name, p.Description, p.Cost.Amount, p.Cost.Currency,
+		p.Quantity, p.Threshold, p.CategoryID, p.Tags,
+		p.DateUpdated,
+	)
+	if err != nil {
+		if isCategoryViolation(err) {
+			return ErrCategoryNotFound
+		}
+		return errors.Wrap(err, "updating product")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "checking updated product")
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+
+	if err := insertChanges(ctx, tx, diffProducts(user, before, *p, now)); err != nil {
+		return err
+	}
+
+	return checkStock(ctx, tx, []string{id}, now)
+}
+
+// patchProduct applies the fields set in update to p.
+func patchProduct(p *Product, update UpdateProduct) {
 	if update.Name != nil {
 		p.Name = *update.Name
 	}
+	if update.Description != nil {
+		p.Description = *update.Description
+	}
 	if update.Cost != nil {
 		p.Cost = *update.Cost
 	}
 	if update.Quantity != nil {
 		p.Quantity = *update.Quantity
 	}
-	p.DateUpdated = now
+	if update.Threshold != nil {
+		p.Threshold = *update.Threshold
+	}
+	if update.CategoryID != nil {
+		p.CategoryID = nil
+		if *update.CategoryID != "" {
+			p.CategoryID = update.CategoryID
+		}
+	}
+	if update.Tags != nil {
+		p.Tags = normalizeTags(update.Tags)
+	}
+}
+
+// Delete moves the product identified by a given ID to the trash. It is hidden
+// from List and Get but keeps its sales history until it is purged.
+func (pg *Postgres) Delete(ctx context.Context, user auth.Claims, id string, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.delete")
+	defer span.End()
+
+	// Deleting a product that is already gone is not an error.
+	if err := trash(ctx, pg.db, user, id, now); err != nil && err != ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// trash implements Delete using either the database or a transaction. It
+// returns ErrNotFound if there is no live product to delete.
+func trash(ctx context.Context, db sqlx.ExecerContext, user auth.Claims, id string, now time.Time) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
 
 	const q = `UPDATE products SET
-		"name" = $2,
-		"cost" = $3,
-		"quantity" = $4,
-		"date_updated" = $5
-		WHERE product_id = $1`
-	_, err = db.ExecContext(ctx, q, id,
-		p.Name, p.Cost,
-		p.Quantity, p.DateUpdated,
-	)
+		"deleted_at" = $2,
+		"deleted_by" = $3,
+		"version" = version + 1
+		WHERE product_id = $1 AND deleted_at IS NULL`
+
+	res, err := db.ExecContext(ctx, q, id, now.UTC(), user.Subject)
 	if err != nil {
-		return errors.Wrap(err, "updating product")
+		return errors.Wrapf(err, "deleting product %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "checking deleted product %s", id)
+	}
+	if n == 0 {
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-// Delete removes the product identified by a given ID.
-func Delete(ctx context.Context, db *sqlx.DB, id string) error {
-	ctx, span := global.Tracer("service").Start(ctx, "internal.product.delete")
+// Restore takes the product identified by a given ID out of the trash.
+func (pg *Postgres) Restore(ctx context.Context, id string, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.restore")
 	defer span.End()
 	if _, err := uuid.Parse(id); err != nil {
 		return ErrInvalidID
 	}
 
-	const q = `DELETE FROM products WHERE product_id = $1`
+	const q = `UPDATE products SET
+		"deleted_at" = NULL,
+		"deleted_by" = NULL,
+		"date_updated" = $2,
+		"version" = version + 1
+		WHERE product_id = $1 AND deleted_at IS NOT NULL`
 
-	if _, err := db.ExecContext(ctx, q, id); err != nil {
-		return errors.Wrapf(err, "deleting product %s", id)
+	res, err := pg.db.ExecContext(ctx, q, id, now.UTC())
+	if err != nil {
+		return errors.Wrapf(err, "restoring product %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "checking restored product %s", id)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Purge permanently removes the product identified by a given ID along with
+// its sales and attachments. Only products already in the trash can be purged.
+// The files of its attachments are removed from the blob store once the rows
+// are gone.
+func (pg *Postgres) Purge(ctx context.Context, id string) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.purge")
+	defer span.End()
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting purge transaction")
+	}
+	defer tx.Rollback()
+
+	// A product in the trash cannot gain attachments, so the ones read here
+	// are all the delete below takes with it.
+	var files []struct {
+		ID           string `db:"attachment_id"`
+		HasThumbnail bool   `db:"has_thumbnail"`
+	}
+	const attachments = `SELECT attachment_id, has_thumbnail FROM attachments WHERE product_id = $1`
+	if err := tx.SelectContext(ctx, &files, attachments, id); err != nil {
+		return errors.Wrapf(err, "selecting attachments of product %s", id)
+	}
+
+	const q = `DELETE FROM products WHERE product_id = $1 AND deleted_at IS NOT NULL`
+
+	res, err := tx.ExecContext(ctx, q, id)
+	if err != nil {
+		return errors.Wrapf(err, "purging product %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "checking purged product %s", id)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing purge")
+	}
+
+	// The rows are gone so a failure here only leaves unreachable files.
+	for _, f := range files {
+		if err := deleteFiles(ctx, pg.blobs, id, f.ID, f.HasThumbnail); err != nil {
+			return err
+		}
 	}
 
 	return nil
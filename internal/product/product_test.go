@@ -6,18 +6,21 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/category"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
 	"github.com/rakshans1/service/internal/product"
 	"github.com/rakshans1/service/internal/tests"
 )
 
 func TestProducts(t *testing.T) {
-	db, teardown := tests.NewUnit(t)
-	defer teardown()
+	eachStore(t, testProducts)
+}
 
+func testProducts(t *testing.T, store product.Store) {
 	newP := product.NewProduct{
 		Name:     "Comic Book",
-		Cost:     10,
+		Cost:     money.Money{Amount: 10, Currency: "INR"},
 		Quantity: 55,
 	}
 	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
@@ -29,12 +32,12 @@ func TestProducts(t *testing.T) {
 		now, time.Hour,
 	)
 
-	p0, err := product.Create(ctx, db, claims, newP, now)
+	p0, err := store.Create(ctx, claims, newP, now)
 	if err != nil {
 		t.Fatalf("creating product p0: %s", err)
 	}
 
-	p1, err := product.Get(ctx, db, p0.ID)
+	p1, err := store.Get(ctx, p0.ID)
 	if err != nil {
 		t.Fatalf("getting product p0: %s", err)
 	}
@@ -45,15 +48,20 @@ func TestProducts(t *testing.T) {
 
 	update := product.UpdateProduct{
 		Name: tests.StringPointer("Comics"),
-		Cost: tests.IntPointer(25),
+		Cost: &money.Money{Amount: 25, Currency: "INR"},
 	}
 	updatedTime := time.Date(2019, time.January, 1, 1, 1, 1, 0, time.UTC)
 
-	if err := product.Update(ctx, db, claims, p0.ID, update, updatedTime); err != nil {
+	if err := store.Update(ctx, claims, p0.ID, update, p0.Version, updatedTime); err != nil {
 		t.Fatalf("creating product p0: %s", err)
 	}
 
-	saved, err := product.Get(ctx, db, p0.ID)
+	// A second update based on the original version must be refused.
+	if err := store.Update(ctx, claims, p0.ID, update, p0.Version, updatedTime); err != product.ErrVersionConflict {
+		t.Fatalf("updating stale product: expected %v, got %v", product.ErrVersionConflict, err)
+	}
+
+	saved, err := store.Get(ctx, p0.ID)
 	if err != nil {
 		t.Fatalf("getting product p0: %s", err)
 	}
@@ -62,32 +70,227 @@ func TestProducts(t *testing.T) {
 	// and change just the fields we expect then diff it with what was saved.
 	want := *p0
 	want.Name = "Comics"
-	want.Cost = 25
+	want.Cost = money.Money{Amount: 25, Currency: "INR"}
+	want.Version = p0.Version + 1
 	want.DateUpdated = updatedTime
 
 	if diff := cmp.Diff(want, *saved); diff != "" {
 		t.Fatalf("updated record did not match:\n%s", diff)
 	}
 
-	if err := product.Delete(ctx, db, p0.ID); err != nil {
+	if err := store.Delete(ctx, claims, p0.ID, now); err != nil {
 		t.Fatalf("deleting product: %v", err)
 	}
 
-	_, err = product.Get(ctx, db, p0.ID)
+	_, err = store.Get(ctx, p0.ID)
 	if err == nil {
 		t.Fatalf("should not be able to retrieve deleted product")
 	}
+
+	trash, err := store.List(ctx, product.ListFilter{Deleted: true})
+	if err != nil {
+		t.Fatalf("listing trash: %s", err)
+	}
+	if exp, got := 1, len(trash.Items); exp != got {
+		t.Fatalf("expected trash size %v, got %v", exp, got)
+	}
+	if exp, got := claims.Subject, *trash.Items[0].DeletedBy; exp != got {
+		t.Fatalf("expected product deleted by %v, got %v", exp, got)
+	}
+
+	if err := store.Restore(ctx, p0.ID, now); err != nil {
+		t.Fatalf("restoring product: %v", err)
+	}
+	if _, err := store.Get(ctx, p0.ID); err != nil {
+		t.Fatalf("getting restored product: %s", err)
+	}
+
+	if err := store.Purge(ctx, p0.ID); err != product.ErrNotFound {
+		t.Fatalf("purging live product: expected %v, got %v", product.ErrNotFound, err)
+	}
+	if err := store.Delete(ctx, claims, p0.ID, now); err != nil {
+		t.Fatalf("deleting product: %v", err)
+	}
+	if err := store.Purge(ctx, p0.ID); err != nil {
+		t.Fatalf("purging product: %v", err)
+	}
+	if err := store.Restore(ctx, p0.ID, now); err != product.ErrNotFound {
+		t.Fatalf("restoring purged product: expected %v, got %v", product.ErrNotFound, err)
+	}
 }
 
 func TestProductList(t *testing.T) {
+	eachStore(t, testProductList)
+}
+
+func testProductList(t *testing.T, store product.Store) {
+	ctx := context.Background()
+
+	page, err := store.List(ctx, product.ListFilter{})
+	if err != nil {
+		t.Fatalf("listing products: %s", err)
+	}
+	if exp, got := 2, len(page.Items); exp != got {
+		t.Fatalf("expected product list size %v, got %v", exp, got)
+	}
+	if exp, got := 2, page.Total; exp != got {
+		t.Fatalf("expected product total %v, got %v", exp, got)
+	}
+	if page.NextCursor != "" {
+		t.Fatalf("expected no next cursor on the only page, got %q", page.NextCursor)
+	}
+
+	{ // Filter
+		f := product.ListFilter{Name: "toys", MinCost: tests.IntPointer(60)}
+		page, err := store.List(ctx, f)
+		if err != nil {
+			t.Fatalf("listing products: %s", err)
+		}
+		if exp, got := 1, len(page.Items); exp != got {
+			t.Fatalf("expected filtered list size %v, got %v", exp, got)
+		}
+		if exp, got := "McDonalds Toys", page.Items[0].Name; exp != got {
+			t.Fatalf("expected filtered product %q, got %q", exp, got)
+		}
+	}
+
+	{ // Sort and paginate
+		f := product.ListFilter{Sort: product.SortRevenue, Desc: true, Limit: 1}
+
+		first, err := store.List(ctx, f)
+		if err != nil {
+			t.Fatalf("listing first page: %s", err)
+		}
+		if exp, got := "Comic Books", first.Items[0].Name; exp != got {
+			t.Fatalf("expected first page product %q, got %q", exp, got)
+		}
+		if first.NextCursor == "" {
+			t.Fatal("expected a next cursor after the first page")
+		}
+
+		f.Cursor = first.NextCursor
+		second, err := store.List(ctx, f)
+		if err != nil {
+			t.Fatalf("listing second page: %s", err)
+		}
+		if exp, got := "McDonalds Toys", second.Items[0].Name; exp != got {
+			t.Fatalf("expected second page product %q, got %q", exp, got)
+		}
+		if second.NextCursor != "" {
+			t.Fatalf("expected no next cursor on the last page, got %q", second.NextCursor)
+		}
+
+		f.Sort = product.SortName
+		if _, err := store.List(ctx, f); err != product.ErrInvalidCursor {
+			t.Fatalf("expected cursor for another ordering to be rejected, got %v", err)
+		}
+	}
+
+	{ // Tags
+		now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+		claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+		np := product.NewProduct{Name: "Box Kite", Cost: money.Money{Amount: 40, Currency: "INR"}, Quantity: 3, Tags: []string{" Outdoor", "summer", "outdoor"}}
+		kite, err := store.Create(ctx, claims, np, now)
+		if err != nil {
+			t.Fatalf("creating product: %s", err)
+		}
+		if diff := cmp.Diff([]string{"outdoor", "summer"}, []string(kite.Tags)); diff != "" {
+			t.Fatalf("tags were not normalized:\n%s", diff)
+		}
+
+		page, err := store.List(ctx, product.ListFilter{Tags: []string{"OUTDOOR"}})
+		if err != nil {
+			t.Fatalf("listing products: %s", err)
+		}
+		if len(page.Items) != 1 || page.Items[0].ID != kite.ID {
+			t.Fatalf("expected only %q with the tag, got %+v", kite.Name, page.Items)
+		}
+
+		page, err = store.List(ctx, product.ListFilter{Tags: []string{"outdoor", "winter"}})
+		if err != nil {
+			t.Fatalf("listing products: %s", err)
+		}
+		if exp, got := 0, len(page.Items); exp != got {
+			t.Fatalf("expected products with every tag %v, got %v", exp, got)
+		}
+	}
+}
+
+// TestProductCategories needs categories, which only the database has. Memory
+// must refuse them outright.
+func TestProductCategories(t *testing.T) {
+	t.Run("Postgres", testProductCategories)
+
+	// Memory keeps no categories and says so rather than finding nothing.
+	t.Run("Memory", func(t *testing.T) {
+		store := tests.NewMemoryProducts(nil)
+
+		ctx := context.Background()
+		now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+		claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+		categoryID := "a224a8d6-3f9e-4b11-9900-e81a25d80702"
+		comicsID := "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+
+		np := product.NewProduct{Name: "Puzzle", Cost: money.Money{Amount: 10, Currency: "INR"}, Quantity: 1, CategoryID: &categoryID}
+		if _, err := store.Create(ctx, claims, np, now); err != product.ErrNeedsDatabase {
+			t.Fatalf("creating in a category: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+		if err := store.Update(ctx, claims, comicsID, product.UpdateProduct{CategoryID: &categoryID}, 0, now); err != product.ErrNeedsDatabase {
+			t.Fatalf("moving into a category: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+		bu := product.BatchUpdate{Items: []product.BatchUpdateItem{{ID: comicsID, UpdateProduct: product.UpdateProduct{CategoryID: &categoryID}}}}
+		if _, err := store.UpdateBatch(ctx, claims, bu, now); err != product.ErrNeedsDatabase {
+			t.Fatalf("moving a batch into a category: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+		if _, err := store.List(ctx, product.ListFilter{CategoryID: categoryID}); err != product.ErrNeedsDatabase {
+			t.Fatalf("filtering by category: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+
+		// Taking a Product out of a category needs nothing to be looked up.
+		empty := ""
+		if err := store.Update(ctx, claims, comicsID, product.UpdateProduct{CategoryID: &empty}, 0, now); err != nil {
+			t.Fatalf("clearing the category: %s", err)
+		}
+	})
+}
+
+func testProductCategories(t *testing.T) {
 	db, teardown := tests.NewUnit(t)
 	defer teardown()
+	store := product.NewPostgres(db, nil)
+
+	ctx := context.Background()
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	toys, err := category.Create(ctx, db, category.NewCategory{Name: "Toys"}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+	kites, err := category.Create(ctx, db, category.NewCategory{Name: "Kites", ParentID: &toys.ID}, now)
+	if err != nil {
+		t.Fatalf("creating child category: %s", err)
+	}
+
+	np := product.NewProduct{Name: "Box Kite", Cost: money.Money{Amount: 40, Currency: "INR"}, Quantity: 3, CategoryID: &kites.ID, Tags: []string{"outdoor"}}
+	kite, err := store.Create(ctx, claims, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
 
-	ps, err := product.List(context.Background(), db)
+	// A category matches the products in its descendants too.
+	page, err := store.List(ctx, product.ListFilter{CategoryID: toys.ID, Tags: []string{"OUTDOOR"}})
 	if err != nil {
 		t.Fatalf("listing products: %s", err)
 	}
-	if exp, got := 2, len(ps); exp != got {
-		t.Fatalf("expected product list size %v, got %v", exp, got)
+	if len(page.Items) != 1 || page.Items[0].ID != kite.ID {
+		t.Fatalf("expected only %q in the category, got %+v", kite.Name, page.Items)
+	}
+
+	missing := "d3d9446e-0b1c-4b3a-9d1e-000000000000"
+	np.CategoryID = &missing
+	if _, err := store.Create(ctx, claims, np, now); err != product.ErrCategoryNotFound {
+		t.Fatalf("creating in a missing category: expected %v, got %v", product.ErrCategoryNotFound, err)
 	}
 }
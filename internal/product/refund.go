@@ -0,0 +1,218 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors for refunds.
+var (
+	// ErrSaleNotFound is used when a specific Sale is requested but does not
+	// exist for the given Product.
+	ErrSaleNotFound = errors.New("sale not found")
+
+	// ErrEmptyRefund is used when a refund would return neither units nor money.
+	ErrEmptyRefund = errors.New("refund must return a quantity or an amount")
+
+	// ErrRefundExceedsSale is used when a refund asks for more units or money
+	// than remain of a Sale after earlier refunds.
+	ErrRefundExceedsSale = errors.New("refund exceeds what remains of the sale")
+)
+
+// AddRefund records a refund against a Sale of a Product. The refunded units
+// are put back into the stock of the Product, and of the Variant sold, in the
+// same transaction.
+func (pg *Postgres) AddRefund(ctx context.Context, user auth.Claims, nr NewRefund, productID, saleID string, now time.Time) (*Refund, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.addrefund")
+	defer span.End()
+
+	return pg.refund(ctx, user, nr, false, productID, saleID, now)
+}
+
+// VoidSale refunds everything that remains of a Sale of a Product and marks
+// the refund as a void.
+func (pg *Postgres) VoidSale(ctx context.Context, user auth.Claims, nv NewVoid, productID, saleID string, now time.Time) (*Refund, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.voidsale")
+	defer span.End()
+
+	return pg.refund(ctx, user, NewRefund{Reason: nv.Reason}, true, productID, saleID, now)
+}
+
+// refund implements AddRefund and VoidSale. When void is true the quantity
+// and amount of nr are replaced by whatever remains of the sale.
+func (pg *Postgres) refund(ctx context.Context, user auth.Claims, nr NewRefund, void bool, productID, saleID string, now time.Time) (*Refund, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting refund transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the sale so concurrent refunds of it are applied one at a time and
+	// each sees the refunds before it.
+	const lock = `SELECT s.variant_id, s.quantity, s.paid, s.currency FROM sales AS s
+		JOIN products AS p ON p.product_id = s.product_id
+		WHERE s.sale_id = $1 AND s.product_id = $2 AND p.deleted_at IS NULL
+		FOR UPDATE OF s`
+
+	var sale struct {
+		VariantID *string `db:"variant_id"`
+		Quantity  int     `db:"quantity"`
+		Paid      int     `db:"paid"`
+		Currency  string  `db:"currency"`
+	}
+	if err := tx.GetContext(ctx, &sale, lock, saleID, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSaleNotFound
+		}
+		return nil, errors.Wrap(err, "locking sale")
+	}
+
+	const refunded = `SELECT
+		COALESCE(SUM(quantity), 0) AS quantity,
+		COALESCE(SUM(amount), 0) AS amount
+		FROM refunds WHERE sale_id = $1`
+
+	var prior struct {
+		Quantity int `db:"quantity"`
+		Amount   int `db:"amount"`
+	}
+	if err := tx.GetContext(ctx, &prior, refunded, saleID); err != nil {
+		return nil, errors.Wrap(err, "summing earlier refunds")
+	}
+
+	if err := checkRefund(&nr, void, sale.Quantity-prior.Quantity, sale.Paid-prior.Amount); err != nil {
+		return nil, err
+	}
+
+	r := Refund{
+		ID:          uuid.New().String(),
+		SaleID:      saleID,
+		ProductID:   productID,
+		Quantity:    nr.Quantity,
+		Amount:      money.Money{Amount: nr.Amount, Currency: sale.Currency},
+		Reason:      nr.Reason,
+		Void:        void,
+		UserID:      user.Subject,
+		DateCreated: now.UTC(),
+	}
+
+	if r.Quantity > 0 {
+		const stock = `UPDATE products SET
+			"quantity" = quantity + $2,
+			"version" = version + 1
+			WHERE product_id = $1
+			RETURNING quantity`
+
+		var restocked int
+		if err := tx.GetContext(ctx, &restocked, stock, productID, r.Quantity); err != nil {
+			return nil, errors.Wrap(err, "restocking product")
+		}
+		if err := recordQuantity(ctx, tx, user, productID, restocked-r.Quantity, restocked, now); err != nil {
+			return nil, err
+		}
+
+		if sale.VariantID != nil {
+			const variant = `UPDATE variants SET "quantity" = quantity + $2 WHERE variant_id = $1`
+
+			if _, err := tx.ExecContext(ctx, variant, *sale.VariantID, r.Quantity); err != nil {
+				return nil, errors.Wrap(err, "restocking variant")
+			}
+		}
+
+		if err := checkStock(ctx, tx, []string{productID}, now); err != nil {
+			return nil, err
+		}
+	}
+
+	const q = `INSERT INTO refunds
+		(refund_id, sale_id, product_id, quantity, amount, currency, reason, void, user_id, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	_, err = tx.ExecContext(ctx, q,
+		r.ID, r.SaleID, r.ProductID,
+		r.Quantity, r.Amount.Amount, r.Amount.Currency, r.Reason, r.Void,
+		r.UserID, r.DateCreated,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting refund")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing refund")
+	}
+
+	return &r, nil
+}
+
+// checkRefund checks nr against what remains of a sale after earlier refunds.
+// A void is given the whole remainder.
+func checkRefund(nr *NewRefund, void bool, remainingQty, remainingAmt int) error {
+	if void {
+		nr.Quantity, nr.Amount = remainingQty, remainingAmt
+	}
+
+	switch {
+	case nr.Quantity > remainingQty || nr.Amount > remainingAmt:
+		return ErrRefundExceedsSale
+	case nr.Quantity == 0 && nr.Amount == 0:
+		if void {
+			return ErrRefundExceedsSale
+		}
+		return ErrEmptyRefund
+	}
+	return nil
+}
+
+// ListRefunds gives all Refunds of a Sale of a Product.
+func (pg *Postgres) ListRefunds(ctx context.Context, productID, saleID string) ([]Refund, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.listrefunds")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(saleID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const exists = `SELECT EXISTS (
+		SELECT 1 FROM sales AS s
+		JOIN products AS p ON p.product_id = s.product_id
+		WHERE s.sale_id = $1 AND s.product_id = $2 AND p.deleted_at IS NULL
+	)`
+
+	var found bool
+	if err := pg.db.GetContext(ctx, &found, exists, saleID, productID); err != nil {
+		return nil, errors.Wrap(err, "checking sale")
+	}
+	if !found {
+		return nil, ErrSaleNotFound
+	}
+
+	refunds := []Refund{}
+
+	const q = `SELECT
+		refund_id, sale_id, product_id, quantity,
+		amount AS "amount.amount", currency AS "amount.currency",
+		reason, void, user_id, date_created
+		FROM refunds WHERE sale_id = $1 ORDER BY date_created`
+	if err := pg.db.SelectContext(ctx, &refunds, q, saleID); err != nil {
+		return nil, errors.Wrap(err, "selecting refunds")
+	}
+
+	return refunds, nil
+}
@@ -0,0 +1,86 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+)
+
+func TestRefunds(t *testing.T) {
+	eachStore(t, testRefunds)
+}
+
+func testRefunds(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(
+		"718ffbea-f4a1-4667-8ae3-b349da52675e", // This is just some random UUID.
+		[]string{auth.RoleAdmin, auth.RoleUser},
+		now, time.Hour,
+	)
+
+	kites, err := store.Create(ctx, claims, product.NewProduct{Name: "Kites", Cost: money.Money{Amount: 25, Currency: "INR"}, Quantity: 10}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	sale, err := store.AddSale(ctx, claims, product.NewSale{Quantity: 4, Paid: money.Money{Amount: 100, Currency: "INR"}}, kites.ID, now)
+	if err != nil {
+		t.Fatalf("adding sale: %s", err)
+	}
+
+	// check compares the stock and aggregates of kites with what is expected.
+	check := func(quantity, sold, revenue int) {
+		t.Helper()
+
+		p, err := store.Get(ctx, kites.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if p.Quantity != quantity || p.Sold != sold || p.Revenue.In("INR") != revenue {
+			t.Fatalf("expected quantity/sold/revenue %d/%d/%d, got %d/%d/%d",
+				quantity, sold, revenue, p.Quantity, p.Sold, p.Revenue.In("INR"))
+		}
+	}
+
+	{ // Partial refund
+		nr := product.NewRefund{Quantity: 1, Amount: 25, Reason: "damaged"}
+		if _, err := store.AddRefund(ctx, claims, nr, kites.ID, sale.ID, now); err != nil {
+			t.Fatalf("adding refund: %s", err)
+		}
+		check(7, 3, 75)
+
+		nr = product.NewRefund{Quantity: 4, Amount: 0, Reason: "too many"}
+		if _, err := store.AddRefund(ctx, claims, nr, kites.ID, sale.ID, now); err != product.ErrRefundExceedsSale {
+			t.Fatalf("over refunding: expected %v, got %v", product.ErrRefundExceedsSale, err)
+		}
+	}
+
+	{ // Void
+		r, err := store.VoidSale(ctx, claims, product.NewVoid{Reason: "rung up twice"}, kites.ID, sale.ID, now)
+		if err != nil {
+			t.Fatalf("voiding sale: %s", err)
+		}
+		if !r.Void || r.Quantity != 3 || r.Amount.Amount != 75 {
+			t.Fatalf("expected void of the remaining 3 units and 75 paid, got %+v", r)
+		}
+		check(10, 0, 0)
+
+		if _, err := store.VoidSale(ctx, claims, product.NewVoid{Reason: "again"}, kites.ID, sale.ID, now); err != product.ErrRefundExceedsSale {
+			t.Fatalf("voiding twice: expected %v, got %v", product.ErrRefundExceedsSale, err)
+		}
+	}
+
+	refunds, err := store.ListRefunds(ctx, kites.ID, sale.ID)
+	if err != nil {
+		t.Fatalf("listing refunds: %s", err)
+	}
+	if exp, got := 2, len(refunds); exp != got {
+		t.Fatalf("expected refund list size %v, got %v", exp, got)
+	}
+}
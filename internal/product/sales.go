@@ -2,49 +2,349 @@ package product
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/promotion"
 	"go.opentelemetry.io/otel/api/global"
 )
 
-// AddSale records a sales transaction for a single Product.
-func AddSale(ctx context.Context, db *sqlx.DB, ns NewSale, productID string, now time.Time) (*Sale, error) {
+// InsufficientStockError is returned when a sale asks for more units of a
+// Product, or of one of its Variants, than are on hand.
+type InsufficientStockError struct {
+	ProductID string
+	VariantID string
+	Available int
+	Requested int
+}
+
+// Error implements the error interface.
+func (e *InsufficientStockError) Error() string {
+	if e.VariantID != "" {
+		return fmt.Sprintf("insufficient stock for variant %s of product %s: %d available, %d requested", e.VariantID, e.ProductID, e.Available, e.Requested)
+	}
+	return fmt.Sprintf("insufficient stock for product %s: %d available, %d requested", e.ProductID, e.Available, e.Requested)
+}
+
+// selectSales reads sale rows with the paid amount and its currency mapped
+// onto Sale.Paid.
+const selectSales = `SELECT
+	sale_id, product_id, variant_id, quantity,
+	paid AS "paid.amount", currency AS "paid.currency",
+	user_id, order_id, line, promotion_id, discount, expected, date_created
+	FROM sales`
+
+// AddSale records a sales transaction for a single Product. It will error if
+// the specified ID is invalid or does not reference an existing Product. The
+// sold units are taken out of the Product's quantity in the same transaction;
+// if there are not enough an *InsufficientStockError is returned and nothing
+// is recorded. The user making the call is recorded as the seller. A promotion
+// code is redeemed in the same transaction; see applyPromotion. A sale taking
+// the Product below its reorder threshold raises a StockAlert. A Product with
+// Variants is sold one Variant at a time and the units are taken out of the
+// stock of both.
+func (pg *Postgres) AddSale(ctx context.Context, user auth.Claims, ns NewSale, productID string, now time.Time) (*Sale, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "internal.product.addsale")
 	defer span.End()
 
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if ns.VariantID != nil {
+		if _, err := uuid.Parse(*ns.VariantID); err != nil {
+			return nil, ErrInvalidID
+		}
+	}
+
 	s := Sale{
 		ID:          uuid.New().String(),
 		ProductID:   productID,
+		VariantID:   ns.VariantID,
 		Quantity:    ns.Quantity,
 		Paid:        ns.Paid,
-		DateCreated: now,
+		UserID:      &user.Subject,
+		DateCreated: now.UTC(),
 	}
 
-	const q = `INSERT into sales
-		(sale_id, product_id,  quantity, paid, date_created)
-		VALUES ($1,$2,$3,$4, $5)`
-
-	_, err := db.ExecContext(ctx, q, s.ID, s.ProductID, s.Quantity, s.Paid, s.DateCreated)
+	tx, err := pg.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "inserting sale")
+		return nil, errors.Wrap(err, "starting sale transaction")
+	}
+	defer tx.Rollback()
+
+	// Lock the product row so concurrent sales of the same product queue up
+	// behind this one and always see the quantity it leaves behind.
+	const lock = `SELECT ` + lockedProductColumns + ` FROM products
+		WHERE product_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+
+	var locked lockedProduct
+	if err := tx.GetContext(ctx, &locked, lock, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "locking product")
+	}
+
+	var variants map[string]lockedVariant
+	if s.VariantID != nil {
+		if variants, err = lockVariants(ctx, tx, []string{*s.VariantID}); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSale(s, locked, variants); err != nil {
+		return nil, err
+	}
+
+	if ns.Code != "" {
+		products := map[string]lockedProduct{productID: locked}
+		if err := applyPromotion(ctx, tx, ns.Code, products, variants, []*Sale{&s}, now); err != nil {
+			return nil, err
+		}
+	}
+
+	const stock = `UPDATE products SET
+		"quantity" = quantity - $2,
+		"version" = version + 1
+		WHERE product_id = $1`
+
+	if _, err := tx.ExecContext(ctx, stock, productID, s.Quantity); err != nil {
+		return nil, errors.Wrap(err, "decrementing product quantity")
+	}
+	if err := recordQuantity(ctx, tx, user, productID, locked.Quantity, locked.Quantity-s.Quantity, now); err != nil {
+		return nil, err
+	}
+	if s.VariantID != nil {
+		if _, err := tx.ExecContext(ctx, decrementVariant, *s.VariantID, s.Quantity); err != nil {
+			return nil, errors.Wrap(err, "decrementing variant quantity")
+		}
+	}
+
+	if err := checkStock(ctx, tx, []string{productID}, now); err != nil {
+		return nil, err
+	}
+
+	if err := insertSale(ctx, tx, s); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing sale")
 	}
 
 	return &s, nil
 }
 
-// ListSales gives all Sales for a Product.
-func ListSales(ctx context.Context, db *sqlx.DB, productID string) ([]Sale, error) {
+// lockedProduct is what a sale needs to know about the Product it sells.
+type lockedProduct struct {
+	ProductID   string `db:"product_id"`
+	Quantity    int    `db:"quantity"`
+	Cost        int    `db:"cost"`
+	Currency    string `db:"currency"`
+	HasVariants bool   `db:"has_variants"`
+}
+
+// checkSale checks that the locked Product p has the units s sells, and so
+// does the Variant among variants that s names. A Product with Variants must
+// be sold one of them.
+func checkSale(s Sale, p lockedProduct, variants map[string]lockedVariant) error {
+	switch {
+	case s.VariantID != nil:
+		v := variants[*s.VariantID]
+		if v.ProductID != s.ProductID {
+			return ErrVariantNotFound
+		}
+		if v.Quantity < s.Quantity {
+			return &InsufficientStockError{
+				ProductID: s.ProductID,
+				VariantID: v.VariantID,
+				Available: v.Quantity,
+				Requested: s.Quantity,
+			}
+		}
+	case p.HasVariants:
+		return ErrVariantRequired
+	}
+
+	if p.Quantity < s.Quantity {
+		return &InsufficientStockError{
+			ProductID: s.ProductID,
+			Available: p.Quantity,
+			Requested: s.Quantity,
+		}
+	}
+	return nil
+}
+
+// lockedProductColumns are the columns of the products table read into a
+// lockedProduct.
+const lockedProductColumns = `product_id, quantity, cost, currency,
+	EXISTS (SELECT 1 FROM variants WHERE variants.product_id = products.product_id) AS has_variants`
+
+// unitCost is the list price of one unit of what s sells: the cost of its
+// Variant if it has one, otherwise that of its Product.
+func unitCost(s *Sale, products map[string]lockedProduct, variants map[string]lockedVariant) money.Money {
+	if s.VariantID != nil {
+		v := variants[*s.VariantID]
+		return money.Money{Amount: v.Cost, Currency: v.Currency}
+	}
+	p := products[s.ProductID]
+	return money.Money{Amount: p.Cost, Currency: p.Currency}
+}
+
+// insertSale writes a Sale as part of a transaction.
+func insertSale(ctx context.Context, tx *sqlx.Tx, s Sale) error {
+	const q = `INSERT INTO sales
+		(sale_id, product_id, variant_id, quantity, paid, currency, user_id, order_id,
+		line, promotion_id, discount, expected, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+
+	_, err := tx.ExecContext(ctx, q,
+		s.ID, s.ProductID, s.VariantID, s.Quantity, s.Paid.Amount, s.Paid.Currency, s.UserID, s.OrderID,
+		s.Line, s.PromotionID, s.Discount, s.Expected, s.DateCreated,
+	)
+	if err != nil {
+		return errors.Wrap(err, "inserting sale")
+	}
+
+	return nil
+}
+
+// applyPromotion redeems the promotion code once for a set of sales being
+// made in tx, given the locked Products and Variants they sell. Each sale the
+// promotion covers gets its discount off its list price and the amount
+// expected to be paid after it. It is an error for the promotion to cover
+// none of the sales or for a covered sale to be paid in another currency than
+// what it sells costs, or to be paid anything but the expected amount.
+func applyPromotion(ctx context.Context, tx *sqlx.Tx, code string, products map[string]lockedProduct, variants map[string]lockedVariant, sales []*Sale, now time.Time) error {
+	promo, err := promotion.Redeem(ctx, tx, code, now)
+	if err != nil {
+		return err
+	}
+
+	var (
+		covered []*Sale
+		prices  []money.Money
+	)
+	for _, s := range sales {
+		ok, err := promotion.Covers(ctx, tx, *promo, s.ProductID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		cost := unitCost(s, products, variants)
+		if s.Paid.Currency != cost.Currency {
+			return promotion.ErrCurrencyMismatch
+		}
+		covered = append(covered, s)
+		prices = append(prices, money.Money{Amount: cost.Amount * s.Quantity, Currency: cost.Currency})
+	}
+	if len(covered) == 0 {
+		return promotion.ErrNotApplicable
+	}
+
+	discounts, err := promo.Apply(prices)
+	if err != nil {
+		return err
+	}
+	for i, s := range covered {
+		expected := prices[i].Amount - discounts[i]
+		if s.Paid.Amount != expected {
+			return promotion.ErrPaidMismatch
+		}
+		s.PromotionID = &promo.ID
+		s.Discount = discounts[i]
+		s.Expected = &expected
+	}
+
+	return nil
+}
+
+// ListSales gives a page of the Sales for a Product in the order they were
+// made. It will error if the specified ID is invalid or does not reference an
+// existing Product.
+func (pg *Postgres) ListSales(ctx context.Context, productID string, f SalesFilter) (*SalePage, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "internal.product.listsales")
 	defer span.End()
 
-	sales := []Sale{}
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	f.Limit = pageLimit(f.Limit)
+
+	const exists = `SELECT EXISTS (
+		SELECT 1 FROM products WHERE product_id = $1 AND deleted_at IS NULL
+	)`
+
+	var found bool
+	if err := pg.db.GetContext(ctx, &found, exists, productID); err != nil {
+		return nil, errors.Wrap(err, "checking product")
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	// Pages are walked on (date_created, sale_id) so each one is a range scan
+	// of the product's sales index however deep it is.
+	var after, afterID interface{}
+	if f.Cursor != "" {
+		t, id, err := decodeSalesCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after, afterID = t, id
+	}
+
+	page := SalePage{
+		Items: []Sale{},
+	}
 
-	const q = `SELECT * FROM sales WHERE product_id = $1`
-	if err := db.SelectContext(ctx, &sales, q, productID); err != nil {
+	const q = selectSales + `
+		WHERE product_id = $1
+		AND ($2::timestamp IS NULL OR date_created >= $2)
+		AND ($3::timestamp IS NULL OR date_created < $3)
+		AND ($4::timestamp IS NULL OR (date_created, sale_id) > ($4, $5::uuid))
+		ORDER BY date_created, sale_id
+		LIMIT $6`
+
+	err := pg.db.SelectContext(ctx, &page.Items, q, productID, nullTime(f.From), nullTime(f.To), after, afterID, f.Limit+1)
+	if err != nil {
 		return nil, errors.Wrap(err, "selecting sales")
 	}
+
+	trimSales(&page, f.Limit)
+
+	return &page, nil
+}
+
+// ListSalesByUser gives all Sales made by a user, newest first. Users may
+// list their own sales; listing anyone else's requires the admin role.
+func (pg *Postgres) ListSalesByUser(ctx context.Context, user auth.Claims, userID string) ([]Sale, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.listsalesbyuser")
+	defer span.End()
+
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	if !user.HasRole(auth.RoleAdmin) && userID != user.Subject {
+		return nil, ErrForbidden
+	}
+
+	sales := []Sale{}
+
+	const q = selectSales + ` WHERE user_id = $1 ORDER BY date_created DESC, sale_id`
+	if err := pg.db.SelectContext(ctx, &sales, q, userID); err != nil {
+		return nil, errors.Wrap(err, "selecting sales by user")
+	}
 	return sales, nil
 }
@@ -5,15 +5,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/category"
 	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
 	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/promotion"
 	"github.com/rakshans1/service/internal/tests"
 )
 
 func TestSales(t *testing.T) {
-	db, teardown := tests.NewUnit(t)
-	defer teardown()
+	eachStore(t, testSales)
+}
 
+func testSales(t *testing.T, store product.Store) {
 	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
 
 	ctx := context.Background()
@@ -21,7 +26,7 @@ func TestSales(t *testing.T) {
 	// Create two products to work with.
 	newPuzzles := product.NewProduct{
 		Name:     "Puzzles",
-		Cost:     25,
+		Cost:     money.Money{Amount: 25, Currency: "INR"},
 		Quantity: 6,
 	}
 	claims := auth.NewClaims(
@@ -30,17 +35,17 @@ func TestSales(t *testing.T) {
 		now, time.Hour,
 	)
 
-	puzzles, err := product.Create(ctx, db, claims, newPuzzles, now)
+	puzzles, err := store.Create(ctx, claims, newPuzzles, now)
 	if err != nil {
 		t.Fatalf("creating product: %s", err)
 	}
 
 	newToys := product.NewProduct{
 		Name:     "Toys",
-		Cost:     40,
+		Cost:     money.Money{Amount: 40, Currency: "INR"},
 		Quantity: 3,
 	}
-	toys, err := product.Create(ctx, db, claims, newToys, now)
+	toys, err := store.Create(ctx, claims, newToys, now)
 	if err != nil {
 		t.Fatalf("creating product: %s", err)
 	}
@@ -49,34 +54,309 @@ func TestSales(t *testing.T) {
 
 		ns := product.NewSale{
 			Quantity: 3,
-			Paid:     70,
+			Paid:     money.Money{Amount: 70, Currency: "INR"},
 		}
 
-		s, err := product.AddSale(ctx, db, ns, puzzles.ID, now)
+		s, err := store.AddSale(ctx, claims, ns, puzzles.ID, now)
 		if err != nil {
 			t.Fatalf("adding sale: %s", err)
 		}
 
 		// Puzzles should show the 1 sale.
-		sales, err := product.ListSales(ctx, db, puzzles.ID)
+		page, err := store.ListSales(ctx, puzzles.ID, product.SalesFilter{})
 		if err != nil {
 			t.Fatalf("listing sales: %s", err)
 		}
-		if exp, got := 1, len(sales); exp != got {
+		if exp, got := 1, len(page.Items); exp != got {
 			t.Fatalf("expected sale list size %v, got %v", exp, got)
 		}
 
-		if exp, got := s.ID, sales[0].ID; exp != got {
+		if exp, got := s.ID, page.Items[0].ID; exp != got {
 			t.Fatalf("expected first sale ID %v, got %v", exp, got)
 		}
 
 		// Toys should have 0 sales.
-		sales, err = product.ListSales(ctx, db, toys.ID)
+		page, err = store.ListSales(ctx, toys.ID, product.SalesFilter{})
 		if err != nil {
 			t.Fatalf("listing sales: %s", err)
 		}
+		if exp, got := 0, len(page.Items); exp != got {
+			t.Fatalf("expected sale list size %v, got %v", exp, got)
+		}
+	}
+
+	{ // By seller
+		sales, err := store.ListSalesByUser(ctx, claims, claims.Subject)
+		if err != nil {
+			t.Fatalf("listing sales by user: %s", err)
+		}
+		if len(sales) != 1 || *sales[0].UserID != claims.Subject {
+			t.Fatalf("expected the one sale made by %s, got %+v", claims.Subject, sales)
+		}
+
+		other := auth.NewClaims(tests.UserID, []string{auth.RoleUser}, now, time.Hour)
+		if _, err := store.ListSalesByUser(ctx, other, claims.Subject); err != product.ErrForbidden {
+			t.Fatalf("listing another user's sales: expected %v, got %v", product.ErrForbidden, err)
+		}
+		sales, err = store.ListSalesByUser(ctx, other, other.Subject)
+		if err != nil {
+			t.Fatalf("listing own sales: %s", err)
+		}
 		if exp, got := 0, len(sales); exp != got {
 			t.Fatalf("expected sale list size %v, got %v", exp, got)
 		}
 	}
+
+	{ // Unknown products
+
+		ns := product.NewSale{Quantity: 1, Paid: money.Money{Amount: 10, Currency: "INR"}}
+		if _, err := store.AddSale(ctx, claims, ns, "not-a-uuid", now); err != product.ErrInvalidID {
+			t.Fatalf("adding sale with bad id: expected %v, got %v", product.ErrInvalidID, err)
+		}
+
+		missing := "6a9c1c4e-1f28-4a53-9b0e-1d0e1d9b2f11"
+		if _, err := store.AddSale(ctx, claims, ns, missing, now); err != product.ErrNotFound {
+			t.Fatalf("adding sale for missing product: expected %v, got %v", product.ErrNotFound, err)
+		}
+		if _, err := store.ListSales(ctx, missing, product.SalesFilter{}); err != product.ErrNotFound {
+			t.Fatalf("listing sales for missing product: expected %v, got %v", product.ErrNotFound, err)
+		}
+	}
+
+	{ // Stock
+
+		// Puzzles started with 6 units and 3 were sold above.
+		p, err := store.Get(ctx, puzzles.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if exp, got := 3, p.Quantity; exp != got {
+			t.Fatalf("expected remaining quantity %v, got %v", exp, got)
+		}
+
+		ns := product.NewSale{
+			Quantity: 4,
+			Paid:     money.Money{Amount: 100, Currency: "INR"},
+		}
+
+		_, err = store.AddSale(ctx, claims, ns, puzzles.ID, now)
+		if _, ok := err.(*product.InsufficientStockError); !ok {
+			t.Fatalf("overselling: expected *InsufficientStockError, got %v", err)
+		}
+	}
+
+	{ // Date ranges and paging
+
+		// Two more puzzle sales a day apart give three sales to page through.
+		ns := product.NewSale{Quantity: 1, Paid: money.Money{Amount: 25, Currency: "INR"}}
+		for _, at := range []time.Time{now.Add(24 * time.Hour), now.Add(48 * time.Hour)} {
+			if _, err := store.AddSale(ctx, claims, ns, puzzles.ID, at); err != nil {
+				t.Fatalf("adding sale: %s", err)
+			}
+		}
+
+		var seen []product.Sale
+		f := product.SalesFilter{Limit: 2}
+		for {
+			page, err := store.ListSales(ctx, puzzles.ID, f)
+			if err != nil {
+				t.Fatalf("listing sales page: %s", err)
+			}
+			seen = append(seen, page.Items...)
+			if page.NextCursor == "" {
+				break
+			}
+			f.Cursor = page.NextCursor
+		}
+		if exp, got := 3, len(seen); exp != got {
+			t.Fatalf("expected %v sales across pages, got %v", exp, got)
+		}
+		for i := 1; i < len(seen); i++ {
+			if !seen[i-1].DateCreated.Before(seen[i].DateCreated) {
+				t.Fatalf("expected sales in date order, got %+v", seen)
+			}
+		}
+
+		page, err := store.ListSales(ctx, puzzles.ID, product.SalesFilter{From: now.Add(time.Hour), To: now.Add(48 * time.Hour)})
+		if err != nil {
+			t.Fatalf("listing sales in range: %s", err)
+		}
+		if len(page.Items) != 1 || !page.Items[0].DateCreated.Equal(now.Add(24*time.Hour)) {
+			t.Fatalf("expected only the sale inside the range, got %+v", page.Items)
+		}
+
+		if _, err := store.ListSales(ctx, puzzles.ID, product.SalesFilter{Cursor: "garbage"}); err != product.ErrInvalidCursor {
+			t.Fatalf("listing with bad cursor: expected %v, got %v", product.ErrInvalidCursor, err)
+		}
+	}
+
+	{ // Concurrent sales never oversell
+
+		// Toys has 3 units so only 3 of these sales can succeed.
+		const attempts = 10
+		errs := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			go func() {
+				ns := product.NewSale{Quantity: 1, Paid: money.Money{Amount: 40, Currency: "INR"}}
+				_, err := store.AddSale(ctx, claims, ns, toys.ID, now)
+				errs <- err
+			}()
+		}
+
+		var sold int
+		for i := 0; i < attempts; i++ {
+			err := <-errs
+			switch err.(type) {
+			case nil:
+				sold++
+			case *product.InsufficientStockError:
+			default:
+				t.Fatalf("adding concurrent sale: %s", err)
+			}
+		}
+		if exp, got := 3, sold; exp != got {
+			t.Fatalf("expected %v successful sales, got %v", exp, got)
+		}
+
+		p, err := store.Get(ctx, toys.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if exp, got := 0, p.Quantity; exp != got {
+			t.Fatalf("expected remaining quantity %v, got %v", exp, got)
+		}
+	}
+}
+
+func TestSalePromotions(t *testing.T) {
+	t.Run("Postgres", testSalePromotions)
+
+	// Memory keeps no promotions and says so rather than finding none.
+	t.Run("Memory", func(t *testing.T) {
+		store := tests.NewMemoryProducts(nil)
+
+		ctx := context.Background()
+		now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+		claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+		comicsID := "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		paid := money.Money{Amount: 45, Currency: "INR"}
+
+		ns := product.NewSale{Quantity: 1, Paid: paid, Code: "SAVE10"}
+		if _, err := store.AddSale(ctx, claims, ns, comicsID, now); err != product.ErrNeedsDatabase {
+			t.Fatalf("selling with a code: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+		no := product.NewOrder{Items: []product.NewOrderItem{{ProductID: comicsID, Quantity: 1, Paid: paid}}, Code: "SAVE10"}
+		if _, err := store.CreateOrder(ctx, claims, no, now); err != product.ErrNeedsDatabase {
+			t.Fatalf("ordering with a code: expected %v, got %v", product.ErrNeedsDatabase, err)
+		}
+	})
+}
+
+func testSalePromotions(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+	store := product.NewPostgres(db, nil)
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	games, err := category.Create(ctx, db, category.NewCategory{Name: "Games"}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+	cards, err := category.Create(ctx, db, category.NewCategory{Name: "Cards", ParentID: &games.ID}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+
+	poker, err := store.Create(ctx, claims, product.NewProduct{Name: "Poker", Cost: money.Money{Amount: 200, Currency: "INR"}, Quantity: 10, CategoryID: &cards.ID}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+	socks, err := store.Create(ctx, claims, product.NewProduct{Name: "Socks", Cost: money.Money{Amount: 50, Currency: "INR"}, Quantity: 10}, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	// GAMES covers poker through its parent category but not socks.
+	_, err = promotion.Create(ctx, db, promotion.NewPromotion{Code: "GAMES", Kind: promotion.KindPercent, Value: 25, CategoryIDs: []string{games.ID}}, now)
+	if err != nil {
+		t.Fatalf("creating promotion: %s", err)
+	}
+	_, err = promotion.Create(ctx, db, promotion.NewPromotion{Code: "FLAT", Kind: promotion.KindFixed, Value: 450, Currency: tests.StringPointer("INR")}, now)
+	if err != nil {
+		t.Fatalf("creating promotion: %s", err)
+	}
+
+	{ // Sales
+
+		ns := product.NewSale{Quantity: 2, Paid: money.Money{Amount: 300, Currency: "INR"}, Code: "games"}
+		s, err := store.AddSale(ctx, claims, ns, poker.ID, now)
+		if err != nil {
+			t.Fatalf("adding sale with code: %s", err)
+		}
+		if s.PromotionID == nil || s.Discount != 100 || s.Expected == nil || *s.Expected != 300 {
+			t.Fatalf("expected 100 off a list price of 400, got %+v", s)
+		}
+
+		page, err := store.ListSales(ctx, poker.ID, product.SalesFilter{})
+		if err != nil {
+			t.Fatalf("listing sales: %s", err)
+		}
+		if diff := cmp.Diff([]product.Sale{*s}, page.Items); diff != "" {
+			t.Fatalf("saved sale did not match:\n%s", diff)
+		}
+
+		ns.Code = "GAMES"
+		ns.Paid.Amount = 400
+		if _, err := store.AddSale(ctx, claims, ns, poker.ID, now); err != promotion.ErrPaidMismatch {
+			t.Fatalf("paying the list price with a code: expected %v, got %v", promotion.ErrPaidMismatch, err)
+		}
+
+		if _, err := store.AddSale(ctx, claims, ns, socks.ID, now); err != promotion.ErrNotApplicable {
+			t.Fatalf("using a code on a product it does not cover: expected %v, got %v", promotion.ErrNotApplicable, err)
+		}
+
+		ns.Paid.Currency = "USD"
+		if _, err := store.AddSale(ctx, claims, ns, poker.ID, now); err != promotion.ErrCurrencyMismatch {
+			t.Fatalf("using a code in another currency: expected %v, got %v", promotion.ErrCurrencyMismatch, err)
+		}
+	}
+
+	{ // Orders
+
+		no := product.NewOrder{
+			Code: "FLAT",
+			Items: []product.NewOrderItem{
+				{ProductID: poker.ID, Quantity: 2, Paid: money.Money{Amount: 0, Currency: "INR"}},
+				{ProductID: socks.ID, Quantity: 2, Paid: money.Money{Amount: 50, Currency: "INR"}},
+			},
+		}
+		o, err := store.CreateOrder(ctx, claims, no, now)
+		if err != nil {
+			t.Fatalf("creating order with code: %s", err)
+		}
+
+		// The 450 off is used up across the lines in order.
+		if got := o.Items[0]; got.Discount != 400 || *got.Expected != 0 {
+			t.Fatalf("expected the poker line to be free, got %+v", got)
+		}
+		if got := o.Items[1]; got.Discount != 50 || *got.Expected != 50 {
+			t.Fatalf("expected 50 off the socks line, got %+v", got)
+		}
+
+		saved, err := store.GetOrder(ctx, claims, o.ID)
+		if err != nil {
+			t.Fatalf("getting order: %s", err)
+		}
+		var discount int
+		for _, s := range saved.Items {
+			discount += s.Discount
+		}
+		if exp, got := 450, discount; exp != got {
+			t.Fatalf("expected %v off the saved order, got %v", exp, got)
+		}
+	}
 }
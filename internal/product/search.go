@@ -0,0 +1,107 @@
+package product
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// ErrEmptySearch is used when a search has no words to match.
+var ErrEmptySearch = errors.New("search must contain at least one word")
+
+// searchResult is a Product matched by Search along with how well it matched.
+type searchResult struct {
+	Product
+	Rank float32 `db:"rank"`
+}
+
+// Search gets a page of the live Products matching a full-text query, best
+// matches first. Names weigh more than descriptions in the ranking.
+func (pg *Postgres) Search(ctx context.Context, sq SearchQuery) (*ProductPage, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.search")
+	defer span.End()
+
+	query := prefixQuery(sq.Text)
+	if query == "" {
+		return nil, ErrEmptySearch
+	}
+	sq.Limit = pageLimit(sq.Limit)
+
+	page := ProductPage{
+		Items: []Product{},
+	}
+
+	const count = `SELECT COUNT(*) FROM products AS p
+		WHERE p.deleted_at IS NULL AND p.search @@ to_tsquery('english', $1)`
+
+	if err := pg.db.GetContext(ctx, &page.Total, count, query); err != nil {
+		return nil, errors.Wrap(err, "counting search results")
+	}
+
+	args := []interface{}{query, sq.Limit + 1}
+
+	// Results are paged by rank and id the same way List pages by its sort
+	// key. The cursor is bound to the query since ranks mean nothing across
+	// different searches.
+	sort := "rank:" + query
+	after := ""
+	if sq.Cursor != "" {
+		c, err := decodeCursor(sq.Cursor, sort)
+		if err != nil {
+			return nil, err
+		}
+		after = "WHERE (p.rank, p.product_id) < ($3::real, $4::uuid)"
+		args = append(args, c.Value, c.ID)
+	}
+
+	q := `SELECT * FROM (
+			SELECT` + productColumns + `, ts_rank(p.search, query) AS rank` + productsFrom + `
+			CROSS JOIN to_tsquery('english', $1) AS query
+			WHERE p.deleted_at IS NULL AND p.search @@ query
+		) AS p
+		` + after + `
+		ORDER BY p.rank DESC, p.product_id DESC
+		LIMIT $2`
+
+	var results []searchResult
+	if err := pg.db.SelectContext(ctx, &results, q, args...); err != nil {
+		return nil, errors.Wrap(err, "searching products")
+	}
+
+	// One extra row was requested to learn if there is another page.
+	if len(results) > sq.Limit {
+		results = results[:sq.Limit]
+		last := results[sq.Limit-1]
+		value := strconv.FormatFloat(float64(last.Rank), 'g', -1, 32)
+		page.NextCursor = encodeCursor(cursor{Sort: sort, Value: value, ID: last.ID})
+	}
+
+	for _, r := range results {
+		page.Items = append(page.Items, r.Product)
+	}
+
+	return &page, nil
+}
+
+// prefixQuery turns user provided search text into a tsquery matching every
+// word as a prefix. Punctuation only separates words so the text can never
+// be malformed tsquery syntax. It returns an empty string when there are no
+// words.
+func prefixQuery(text string) string {
+	words := searchWords(text)
+	for i, w := range words {
+		words[i] = w + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// searchWords splits text into lower case words of letters and digits.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
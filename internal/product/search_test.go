@@ -0,0 +1,73 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestSearch(t *testing.T) {
+	eachStore(t, testSearch)
+}
+
+func testSearch(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	for _, np := range []product.NewProduct{
+		{Name: "Box Kite", Description: "A sturdy kite for windy beaches", Cost: money.Money{Amount: 40, Currency: "INR"}, Quantity: 3},
+		{Name: "Kite String", Description: "Two hundred feet of line", Cost: money.Money{Amount: 5, Currency: "INR"}, Quantity: 30},
+		{Name: "Beach Ball", Description: "Bright and bouncy, goes well with a kite", Cost: money.Money{Amount: 10, Currency: "INR"}, Quantity: 12},
+	} {
+		if _, err := store.Create(ctx, claims, np, now); err != nil {
+			t.Fatalf("creating product: %s", err)
+		}
+	}
+
+	// A partial word matches as a prefix and name matches outrank
+	// description matches.
+	page, err := store.Search(ctx, product.SearchQuery{Text: "kit", Limit: 2})
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+	if exp, got := 3, page.Total; exp != got {
+		t.Fatalf("expected %v matches, got %v", exp, got)
+	}
+	for _, p := range page.Items {
+		if p.Name == "Beach Ball" {
+			t.Fatalf("expected the description match on the last page, got %+v", page.Items)
+		}
+	}
+
+	next, err := store.Search(ctx, product.SearchQuery{Text: "kit", Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("searching second page: %s", err)
+	}
+	if len(next.Items) != 1 || next.Items[0].Name != "Beach Ball" || next.NextCursor != "" {
+		t.Fatalf("expected only Beach Ball on the last page, got %+v", next.Items)
+	}
+
+	if _, err := store.Search(ctx, product.SearchQuery{Text: "beach", Cursor: page.NextCursor}); err != product.ErrInvalidCursor {
+		t.Fatalf("expected a cursor from another search to be rejected, got %v", err)
+	}
+
+	// Every word must match.
+	page, err = store.Search(ctx, product.SearchQuery{Text: "kite beach!"})
+	if err != nil {
+		t.Fatalf("searching: %s", err)
+	}
+	if exp, got := 2, len(page.Items); exp != got {
+		t.Fatalf("expected %v matches for both words, got %v", exp, got)
+	}
+
+	if _, err := store.Search(ctx, product.SearchQuery{Text: " & !"}); err != product.ErrEmptySearch {
+		t.Fatalf("expected %v, got %v", product.ErrEmptySearch, err)
+	}
+}
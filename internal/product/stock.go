@@ -0,0 +1,131 @@
+package product
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// LowStock gets the Products whose quantity is below their reorder threshold,
+// lowest quantity first.
+func (pg *Postgres) LowStock(ctx context.Context) ([]Product, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.lowstock")
+	defer span.End()
+
+	products := []Product{}
+
+	const q = selectProducts + `
+		WHERE p.deleted_at IS NULL AND p.quantity < p.reorder_threshold
+		ORDER BY p.quantity, p.product_id`
+
+	if err := pg.db.SelectContext(ctx, &products, q); err != nil {
+		return nil, errors.Wrap(err, "selecting low stock products")
+	}
+
+	return products, nil
+}
+
+// checkStock raises a StockAlert for each of the Products that has just
+// fallen below its reorder threshold in tx. The alerts are delivered once tx
+// commits by DeliverAlerts. A Product that has been replenished is cleared so
+// it is alerted on again the next time it runs low.
+func checkStock(ctx context.Context, tx *sqlx.Tx, productIDs []string, now time.Time) error {
+
+	// low_stock_alerted remembers which side of the threshold the Product was
+	// on last time, so only the rows that crossed it are changed.
+	const q = `UPDATE products SET
+		"low_stock_alerted" = quantity < reorder_threshold
+		WHERE product_id = ANY($1::uuid[])
+		AND low_stock_alerted <> (quantity < reorder_threshold)
+		RETURNING product_id, quantity, reorder_threshold, low_stock_alerted`
+
+	var crossed []struct {
+		ProductID string `db:"product_id"`
+		Quantity  int    `db:"quantity"`
+		Threshold int    `db:"reorder_threshold"`
+		Alerted   bool   `db:"low_stock_alerted"`
+	}
+	if err := tx.SelectContext(ctx, &crossed, q, pq.Array(productIDs)); err != nil {
+		return errors.Wrap(err, "checking stock levels")
+	}
+
+	const alert = `INSERT INTO stock_alerts
+		(alert_id, product_id, quantity, threshold, date_created)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	for _, c := range crossed {
+		if !c.Alerted {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, alert, uuid.New().String(), c.ProductID, c.Quantity, c.Threshold, now.UTC()); err != nil {
+			return errors.Wrap(err, "raising stock alert")
+		}
+	}
+
+	return nil
+}
+
+// DeliverAlerts sends the StockAlerts that have not been delivered yet through
+// n, oldest first, and returns how many were sent. It stops at the first one
+// n fails to deliver, leaving it and the rest to be tried again on the next
+// call. Concurrent calls skip the alerts another call is sending.
+func (pg *Postgres) DeliverAlerts(ctx context.Context, n notify.Notifier, now time.Time) (int, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.deliveralerts")
+	defer span.End()
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "starting alert transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `SELECT a.alert_id, a.product_id, p.name, a.quantity, a.threshold, a.date_created
+		FROM stock_alerts AS a
+		JOIN products AS p ON p.product_id = a.product_id
+		WHERE a.date_delivered IS NULL
+		ORDER BY a.date_created, a.alert_id
+		FOR UPDATE OF a SKIP LOCKED`
+
+	var alerts []StockAlert
+	if err := tx.SelectContext(ctx, &alerts, q); err != nil {
+		return 0, errors.Wrap(err, "selecting pending stock alerts")
+	}
+
+	var (
+		sent    []string
+		sendErr error
+	)
+	for _, a := range alerts {
+		if err := n.Notify(ctx, alertNotification(a)); err != nil {
+			sendErr = errors.Wrapf(err, "delivering stock alert %s", a.ID)
+			break
+		}
+		sent = append(sent, a.ID)
+	}
+
+	const mark = `UPDATE stock_alerts SET date_delivered = $2 WHERE alert_id = ANY($1::uuid[])`
+	if _, err := tx.ExecContext(ctx, mark, pq.Array(sent), now.UTC()); err != nil {
+		return 0, errors.Wrap(err, "marking stock alerts delivered")
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "committing delivered stock alerts")
+	}
+
+	return len(sent), sendErr
+}
+
+// alertNotification is how a StockAlert is delivered.
+func alertNotification(a StockAlert) notify.Notification {
+	return notify.Notification{
+		ID:   a.ID,
+		Kind: KindLowStock,
+		Time: a.DateCreated,
+		Data: a,
+	}
+}
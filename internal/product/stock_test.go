@@ -0,0 +1,101 @@
+package product_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/platform/notify"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// recorder is a Notifier that keeps what it is sent, or fails when told to.
+type recorder struct {
+	sent []notify.Notification
+	fail bool
+}
+
+func (r *recorder) Notify(ctx context.Context, n notify.Notification) error {
+	if r.fail {
+		return errors.New("notifier is down")
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func TestLowStock(t *testing.T) {
+	eachStore(t, testLowStock)
+}
+
+func testLowStock(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	np := product.NewProduct{Name: "Batteries", Cost: money.Money{Amount: 30, Currency: "INR"}, Quantity: 5, Threshold: 3}
+	batteries, err := store.Create(ctx, claims, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	sell := func(quantity int) {
+		t.Helper()
+		ns := product.NewSale{Quantity: quantity, Paid: money.Money{Amount: 30 * quantity, Currency: "INR"}}
+		if _, err := store.AddSale(ctx, claims, ns, batteries.ID, now); err != nil {
+			t.Fatalf("adding sale: %s", err)
+		}
+	}
+
+	var r recorder
+	deliver := func() int {
+		t.Helper()
+		n, err := store.DeliverAlerts(ctx, &r, now)
+		if err != nil && !r.fail {
+			t.Fatalf("delivering alerts: %s", err)
+		}
+		return n
+	}
+
+	// 5 to 3 is not below the threshold yet.
+	sell(2)
+	if n := deliver(); n != 0 {
+		t.Fatalf("expected no alerts at the threshold, got %v", n)
+	}
+
+	// 3 to 2 crosses it; 2 to 1 is already below and is not alerted again.
+	r.fail = true
+	sell(1)
+	if n := deliver(); n != 0 {
+		t.Fatalf("expected nothing delivered while the notifier is down, got %v", n)
+	}
+	r.fail = false
+	sell(1)
+	if n := deliver(); n != 1 {
+		t.Fatalf("expected the failed alert to be delivered once, got %v", n)
+	}
+	if a, ok := r.sent[0].Data.(product.StockAlert); !ok || a.ProductID != batteries.ID || a.Quantity != 2 || a.Threshold != 3 {
+		t.Fatalf("expected an alert for 2 batteries against a threshold of 3, got %+v", r.sent[0])
+	}
+
+	low, err := store.LowStock(ctx)
+	if err != nil {
+		t.Fatalf("listing low stock: %s", err)
+	}
+	if len(low) != 1 || low[0].ID != batteries.ID {
+		t.Fatalf("expected the batteries to be low on stock, got %+v", low)
+	}
+
+	// Replenishing clears the alert so the next drop is alerted again.
+	if err := store.Update(ctx, claims, batteries.ID, product.UpdateProduct{Quantity: tests.IntPointer(10)}, 0, now); err != nil {
+		t.Fatalf("restocking: %s", err)
+	}
+	sell(8)
+	if n := deliver(); n != 1 {
+		t.Fatalf("expected a new alert after restocking, got %v", n)
+	}
+}
@@ -0,0 +1,130 @@
+package product
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/blob"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/platform/notify"
+)
+
+// Store keeps Products along with their Sales, Orders, Refunds, Variants,
+// Attachments and history. Every implementation reports the predefined errors
+// of this package for the same conditions so callers can handle them alike.
+type Store interface {
+
+	// List gets a page of Products matching the filter.
+	List(ctx context.Context, f ListFilter) (*ProductPage, error)
+
+	// Search gets a page of live Products matching a full text query.
+	Search(ctx context.Context, sq SearchQuery) (*ProductPage, error)
+
+	// Create adds a Product owned by user.
+	Create(ctx context.Context, user auth.Claims, np NewProduct, now time.Time) (*Product, error)
+
+	// Get finds the live Product identified by id.
+	Get(ctx context.Context, id string) (*Product, error)
+
+	// Update changes a Product. A non-zero version must match its Version.
+	Update(ctx context.Context, user auth.Claims, id string, update UpdateProduct, version int, now time.Time) error
+
+	// Delete moves a Product to the trash.
+	Delete(ctx context.Context, user auth.Claims, id string, now time.Time) error
+
+	// Restore takes a Product back out of the trash.
+	Restore(ctx context.Context, id string, now time.Time) error
+
+	// Purge removes a Product in the trash for good.
+	Purge(ctx context.Context, id string) error
+
+	// UpdateBatch applies many changes at once.
+	UpdateBatch(ctx context.Context, user auth.Claims, bu BatchUpdate, now time.Time) ([]BatchResult, error)
+
+	// DeleteBatch moves many Products to the trash at once.
+	DeleteBatch(ctx context.Context, user auth.Claims, bd BatchDelete, now time.Time) ([]BatchResult, error)
+
+	// Import creates Products from rows, all or none.
+	Import(ctx context.Context, user auth.Claims, rows []ImportRow, dryRun bool, now time.Time) (*ImportReport, error)
+
+	// ExportProducts calls fn for every live Product.
+	ExportProducts(ctx context.Context, fn func(Product) error) error
+
+	// ExportSales calls fn for every Sale made in [from, to).
+	ExportSales(ctx context.Context, from, to time.Time, fn func(Sale) error) error
+
+	// History lists the changes made to a Product.
+	History(ctx context.Context, id, field string) ([]Change, error)
+
+	// CostAt finds what a Product cost at a point in time.
+	CostAt(ctx context.Context, id string, at time.Time) (money.Money, error)
+
+	// AddSale records a Sale of a Product.
+	AddSale(ctx context.Context, user auth.Claims, ns NewSale, productID string, now time.Time) (*Sale, error)
+
+	// ListSales gets a page of the Sales of a Product.
+	ListSales(ctx context.Context, productID string, f SalesFilter) (*SalePage, error)
+
+	// ListSalesByUser lists the Sales recorded by a user.
+	ListSalesByUser(ctx context.Context, user auth.Claims, userID string) ([]Sale, error)
+
+	// CreateOrder records the Sales of an Order, all or none.
+	CreateOrder(ctx context.Context, user auth.Claims, no NewOrder, now time.Time) (*Order, error)
+
+	// GetOrder finds an Order along with its Sales.
+	GetOrder(ctx context.Context, user auth.Claims, id string) (*Order, error)
+
+	// AddRefund records a Refund of part of a Sale.
+	AddRefund(ctx context.Context, user auth.Claims, nr NewRefund, productID, saleID string, now time.Time) (*Refund, error)
+
+	// VoidSale refunds whatever remains of a Sale.
+	VoidSale(ctx context.Context, user auth.Claims, nv NewVoid, productID, saleID string, now time.Time) (*Refund, error)
+
+	// ListRefunds lists the Refunds of a Sale.
+	ListRefunds(ctx context.Context, productID, saleID string) ([]Refund, error)
+
+	// LowStock lists the live Products below their reorder threshold.
+	LowStock(ctx context.Context) ([]Product, error)
+
+	// DeliverAlerts sends the StockAlerts not yet delivered to n.
+	DeliverAlerts(ctx context.Context, n notify.Notifier, now time.Time) (int, error)
+
+	// AddVariant adds a Variant to a Product.
+	AddVariant(ctx context.Context, user auth.Claims, productID string, nv NewVariant, now time.Time) (*Variant, error)
+
+	// GetVariant finds a Variant of a live Product.
+	GetVariant(ctx context.Context, productID, id string) (*Variant, error)
+
+	// EditVariant changes a Variant of a Product.
+	EditVariant(ctx context.Context, user auth.Claims, productID, id string, uv UpdateVariant, now time.Time) error
+
+	// DeleteVariant removes a Variant that was never sold.
+	DeleteVariant(ctx context.Context, user auth.Claims, productID, id string, now time.Time) error
+
+	// AddAttachment stores a file uploaded for a Product.
+	AddAttachment(ctx context.Context, user auth.Claims, productID, kind, filename string, r io.Reader, now time.Time) (*Attachment, error)
+
+	// GetAttachment finds an Attachment of a Product.
+	GetAttachment(ctx context.Context, productID, id string) (*Attachment, error)
+
+	// OpenAttachment finds an Attachment and opens its file, or its thumbnail.
+	OpenAttachment(ctx context.Context, productID, id string, thumb bool) (*Attachment, io.ReadCloser, error)
+
+	// DeleteAttachment removes an Attachment and its files.
+	DeleteAttachment(ctx context.Context, productID, id string) error
+}
+
+// Postgres is a Store keeping Products in a PostgreSQL database and the files
+// of their Attachments in a blob store.
+type Postgres struct {
+	db    *sqlx.DB
+	blobs blob.Store
+}
+
+// NewPostgres constructs a Store using db, keeping attachment files in blobs.
+func NewPostgres(db *sqlx.DB, blobs blob.Store) *Postgres {
+	return &Postgres{db: db, blobs: blobs}
+}
@@ -0,0 +1,32 @@
+package product_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/rakshans1/service/internal/platform/blob"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+// eachStore runs fn against every Store implementation, each holding the seed
+// data, so they are held to the same behavior.
+func eachStore(t *testing.T, fn func(t *testing.T, store product.Store)) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatalf("creating blob dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	blobs := blob.NewLocal(dir)
+
+	t.Run("Postgres", func(t *testing.T) {
+		db, teardown := tests.NewUnit(t)
+		defer teardown()
+
+		fn(t, product.NewPostgres(db, blobs))
+	})
+	t.Run("Memory", func(t *testing.T) {
+		fn(t, tests.NewMemoryProducts(blobs))
+	})
+}
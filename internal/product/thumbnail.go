@@ -0,0 +1,80 @@
+package product
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	_ "image/gif"  // Register the GIF decoder.
+	_ "image/jpeg" // Register the JPEG decoder.
+	"image/png"
+
+	"github.com/pkg/errors"
+)
+
+// ThumbnailSize is the longest side of a thumbnail in pixels.
+const ThumbnailSize = 256
+
+// maxImagePixels bounds the images thumbnails are made from so a small file
+// cannot claim huge dimensions and exhaust memory when decoded.
+const maxImagePixels = 40 << 20
+
+// thumbnail scales an image down so its longest side is at most ThumbnailSize
+// and encodes it as PNG. Smaller images keep their size. Each thumbnail pixel
+// is the average of the image pixels it covers.
+func thumbnail(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, ErrInvalidImage
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	switch {
+	case w >= h && w > ThumbnailSize:
+		tw, th = ThumbnailSize, h*ThumbnailSize/w
+	case h > w && h > ThumbnailSize:
+		tw, th = w*ThumbnailSize/h, ThumbnailSize
+	}
+	if th < 1 {
+		th = 1
+	}
+	if tw < 1 {
+		tw = 1
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.Set(x, y, color.NRGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, errors.Wrap(err, "encoding thumbnail")
+	}
+
+	return buf.Bytes(), nil
+}
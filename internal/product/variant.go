@@ -0,0 +1,442 @@
+package product
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors for variants.
+var (
+	// ErrVariantNotFound is used when a specific Variant is requested but does
+	// not exist for the given Product.
+	ErrVariantNotFound = errors.New("variant not found")
+
+	// ErrSKUTaken is used when a Variant is given a SKU already used by another.
+	ErrSKUTaken = errors.New("SKU is already in use")
+
+	// ErrInvalidSKU is used when a SKU is blank once trimmed.
+	ErrInvalidSKU = errors.New("SKU must not be blank")
+
+	// ErrVariantRequired is used when a Product with Variants is sold without
+	// saying which Variant.
+	ErrVariantRequired = errors.New("product has variants; a variant must be chosen")
+
+	// ErrHasVariants is used when the quantity of a Product with Variants is
+	// changed directly instead of through its Variants.
+	ErrHasVariants = errors.New("quantity of a product with variants is set on its variants")
+
+	// ErrVariantInUse is used when a Variant that has been sold is deleted.
+	ErrVariantInUse = errors.New("variant has sales and cannot be deleted")
+)
+
+// variantColumns are the columns read for a Variant from the variants table
+// aliased as v.
+const variantColumns = `
+	v.variant_id, v.product_id, v.sku, v.attributes,
+	v.cost AS "cost.amount", v.currency AS "cost.currency",
+	v.quantity, v.date_created, v.date_updated`
+
+// Scan implements the sql.Scanner interface.
+func (a *Attributes) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*a = Attributes{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into attributes", src)
+	}
+
+	attrs := Attributes{}
+	if err := json.Unmarshal(b, &attrs); err != nil {
+		return errors.Wrap(err, "decoding attributes")
+	}
+	*a = attrs
+	return nil
+}
+
+// Value implements the driver.Valuer interface. Nil Attributes are stored as
+// an empty object.
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string(a))
+}
+
+// Scan implements the sql.Scanner interface.
+func (vs *Variants) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*vs = Variants{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into variants", src)
+	}
+
+	variants := Variants{}
+	if err := json.Unmarshal(b, &variants); err != nil {
+		return errors.Wrap(err, "decoding variants")
+	}
+	*vs = variants
+	return nil
+}
+
+// normalizeSKU trims and upper cases a SKU so it is found however it is typed.
+func normalizeSKU(sku string) string {
+	return strings.ToUpper(strings.TrimSpace(sku))
+}
+
+// isSKUViolation reports whether err is the database rejecting a duplicate SKU.
+func isSKUViolation(err error) bool {
+	pqErr, ok := errors.Cause(err).(*pq.Error)
+	return ok && pqErr.Code == "23505" && pqErr.Constraint == "variants_sku_idx"
+}
+
+// lockProduct locks a Product for a change to its Variants so the change and
+// the new total quantity are made by one writer at a time.
+func lockProduct(ctx context.Context, tx *sqlx.Tx, productID string) error {
+	const q = `SELECT product_id FROM products
+		WHERE product_id = $1 AND deleted_at IS NULL
+		FOR UPDATE`
+
+	var id string
+	if err := tx.GetContext(ctx, &id, q, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return errors.Wrap(err, "locking product")
+	}
+	return nil
+}
+
+// syncQuantity sets the quantity of a Product to the total of its Variants,
+// recording the change as made by user.
+func syncQuantity(ctx context.Context, tx *sqlx.Tx, user auth.Claims, productID string, now time.Time) error {
+	const q = `WITH old AS (SELECT quantity FROM products WHERE product_id = $1)
+		UPDATE products SET
+		"quantity" = (SELECT COALESCE(SUM(quantity), 0) FROM variants WHERE product_id = $1),
+		"date_updated" = $2,
+		"version" = version + 1
+		WHERE product_id = $1
+		RETURNING (SELECT quantity FROM old) AS old, quantity AS new`
+
+	var row struct {
+		Old int `db:"old"`
+		New int `db:"new"`
+	}
+	if err := tx.GetContext(ctx, &row, q, productID, now.UTC()); err != nil {
+		return errors.Wrap(err, "totalling variant quantities")
+	}
+	if err := recordQuantity(ctx, tx, user, productID, row.Old, row.New, now); err != nil {
+		return err
+	}
+
+	return checkStock(ctx, tx, []string{productID}, now)
+}
+
+// AddVariant adds a Variant to a Product. The Product's quantity becomes the
+// total of its Variants, so the stock it had of its own is replaced by that of
+// its first Variant.
+func (pg *Postgres) AddVariant(ctx context.Context, user auth.Claims, productID string, nv NewVariant, now time.Time) (*Variant, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.addvariant")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	v, err := newVariant(productID, nv, now)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "starting variant transaction")
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	const q = `INSERT INTO variants
+		(variant_id, product_id, sku, attributes, cost, currency, quantity, date_created, date_updated)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err = tx.ExecContext(ctx, q,
+		v.ID, v.ProductID, v.SKU, v.Attributes, v.Cost.Amount, v.Cost.Currency,
+		v.Quantity, v.DateCreated, v.DateUpdated,
+	)
+	if err != nil {
+		if isSKUViolation(err) {
+			return nil, ErrSKUTaken
+		}
+		return nil, errors.Wrap(err, "inserting variant")
+	}
+
+	if err := syncQuantity(ctx, tx, user, productID, now); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "committing variant")
+	}
+
+	return &v, nil
+}
+
+// newVariant builds the Variant of a Product described by nv.
+func newVariant(productID string, nv NewVariant, now time.Time) (Variant, error) {
+	v := Variant{
+		ID:          uuid.New().String(),
+		ProductID:   productID,
+		SKU:         normalizeSKU(nv.SKU),
+		Attributes:  nv.Attributes,
+		Cost:        nv.Cost,
+		Quantity:    nv.Quantity,
+		DateCreated: now.UTC(),
+		DateUpdated: now.UTC(),
+	}
+	if v.SKU == "" {
+		return Variant{}, ErrInvalidSKU
+	}
+	if v.Attributes == nil {
+		v.Attributes = Attributes{}
+	}
+	return v, nil
+}
+
+// GetVariant finds a Variant of a Product.
+func (pg *Postgres) GetVariant(ctx context.Context, productID, id string) (*Variant, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.getvariant")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var v Variant
+
+	const q = `SELECT` + variantColumns + `
+		FROM variants AS v
+		JOIN products AS p ON p.product_id = v.product_id
+		WHERE v.variant_id = $1 AND v.product_id = $2 AND p.deleted_at IS NULL`
+
+	if err := pg.db.GetContext(ctx, &v, q, id, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrVariantNotFound
+		}
+		return nil, errors.Wrap(err, "selecting variant")
+	}
+
+	return &v, nil
+}
+
+// EditVariant modifies a Variant of a Product. A change of quantity is
+// carried over to the Product's total.
+func (pg *Postgres) EditVariant(ctx context.Context, user auth.Claims, productID, id string, uv UpdateVariant, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.editvariant")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting variant transaction")
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	var v Variant
+
+	const get = `SELECT` + variantColumns + `
+		FROM variants AS v
+		WHERE v.variant_id = $1 AND v.product_id = $2`
+
+	if err := tx.GetContext(ctx, &v, get, id, productID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrVariantNotFound
+		}
+		return errors.Wrap(err, "selecting variant")
+	}
+
+	if err := patchVariant(&v, uv, now); err != nil {
+		return err
+	}
+
+	const q = `UPDATE variants SET
+		"sku" = $2,
+		"attributes" = $3,
+		"cost" = $4,
+		"currency" = $5,
+		"quantity" = $6,
+		"date_updated" = $7
+		WHERE variant_id = $1`
+
+	_, err = tx.ExecContext(ctx, q, id,
+		v.SKU, v.Attributes, v.Cost.Amount, v.Cost.Currency, v.Quantity, v.DateUpdated,
+	)
+	if err != nil {
+		if isSKUViolation(err) {
+			return ErrSKUTaken
+		}
+		return errors.Wrap(err, "updating variant")
+	}
+
+	if uv.Quantity != nil {
+		if err := syncQuantity(ctx, tx, user, productID, now); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing variant update")
+	}
+
+	return nil
+}
+
+// patchVariant applies the fields set in uv to v.
+func patchVariant(v *Variant, uv UpdateVariant, now time.Time) error {
+	if uv.SKU != nil {
+		if v.SKU = normalizeSKU(*uv.SKU); v.SKU == "" {
+			return ErrInvalidSKU
+		}
+	}
+	if uv.Attributes != nil {
+		v.Attributes = uv.Attributes
+	}
+	if uv.Cost != nil {
+		v.Cost = *uv.Cost
+	}
+	if uv.Quantity != nil {
+		v.Quantity = *uv.Quantity
+	}
+	v.DateUpdated = now.UTC()
+	return nil
+}
+
+// DeleteVariant removes a Variant from a Product along with its stock. A
+// Variant that has been sold is kept for its sales history and reported as
+// ErrVariantInUse.
+func (pg *Postgres) DeleteVariant(ctx context.Context, user auth.Claims, productID, id string, now time.Time) error {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.product.deletevariant")
+	defer span.End()
+
+	if _, err := uuid.Parse(productID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidID
+	}
+
+	tx, err := pg.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting variant transaction")
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(ctx, tx, productID); err != nil {
+		return err
+	}
+
+	const q = `DELETE FROM variants WHERE variant_id = $1 AND product_id = $2`
+
+	res, err := tx.ExecContext(ctx, q, id, productID)
+	if err != nil {
+		if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrVariantInUse
+		}
+		return errors.Wrapf(err, "deleting variant %s", id)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrapf(err, "checking deleted variant %s", id)
+	}
+	if n == 0 {
+		return ErrVariantNotFound
+	}
+
+	if err := syncQuantity(ctx, tx, user, productID, now); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing variant delete")
+	}
+
+	return nil
+}
+
+// lockedVariant is what a sale needs to know about the Variant it sells.
+type lockedVariant struct {
+	VariantID string `db:"variant_id"`
+	ProductID string `db:"product_id"`
+	Quantity  int    `db:"quantity"`
+	Cost      int    `db:"cost"`
+	Currency  string `db:"currency"`
+}
+
+// lockVariants locks the Variants being sold in tx, in id order so concurrent
+// sales cannot deadlock. Their Products must already be locked. It returns
+// ErrVariantNotFound if a Variant does not exist.
+func lockVariants(ctx context.Context, tx *sqlx.Tx, ids []string) (map[string]lockedVariant, error) {
+	const q = `SELECT variant_id, product_id, quantity, cost, currency FROM variants
+		WHERE variant_id = ANY($1::uuid[])
+		ORDER BY variant_id
+		FOR UPDATE`
+
+	var locked []lockedVariant
+	if err := tx.SelectContext(ctx, &locked, q, pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "locking variants")
+	}
+	if len(locked) != len(ids) {
+		return nil, ErrVariantNotFound
+	}
+
+	variants := make(map[string]lockedVariant, len(locked))
+	for _, v := range locked {
+		variants[v.VariantID] = v
+	}
+	return variants, nil
+}
+
+// decrementVariant takes sold units out of the stock of a Variant.
+const decrementVariant = `UPDATE variants SET
+	"quantity" = quantity - $2
+	WHERE variant_id = $1`
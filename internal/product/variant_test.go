@@ -0,0 +1,159 @@
+package product_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/platform/auth"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestVariants(t *testing.T) {
+	eachStore(t, testVariants)
+}
+
+func testVariants(t *testing.T, store product.Store) {
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	claims := auth.NewClaims(tests.AdminID, []string{auth.RoleAdmin}, now, time.Hour)
+
+	np := product.NewProduct{Name: "T-Shirt", Cost: money.Money{Amount: 500, Currency: "INR"}, Quantity: 1}
+	shirt, err := store.Create(ctx, claims, np, now)
+	if err != nil {
+		t.Fatalf("creating product: %s", err)
+	}
+
+	nv := product.NewVariant{
+		SKU:        " tee-red-m ",
+		Attributes: product.Attributes{"colour": "red", "size": "M"},
+		Cost:       money.Money{Amount: 500, Currency: "INR"},
+		Quantity:   10,
+	}
+	medium, err := store.AddVariant(ctx, claims, shirt.ID, nv, now)
+	if err != nil {
+		t.Fatalf("adding variant: %s", err)
+	}
+	if exp, got := "TEE-RED-M", medium.SKU; exp != got {
+		t.Fatalf("expected SKU %q, got %q", exp, got)
+	}
+
+	nv = product.NewVariant{
+		SKU:        "TEE-RED-XL",
+		Attributes: product.Attributes{"colour": "red", "size": "XL"},
+		Cost:       money.Money{Amount: 600, Currency: "INR"},
+		Quantity:   5,
+	}
+	large, err := store.AddVariant(ctx, claims, shirt.ID, nv, now)
+	if err != nil {
+		t.Fatalf("adding variant: %s", err)
+	}
+
+	if _, err := store.AddVariant(ctx, claims, shirt.ID, product.NewVariant{SKU: "tee-red-xl", Cost: nv.Cost}, now); err != product.ErrSKUTaken {
+		t.Fatalf("reusing a SKU: expected %v, got %v", product.ErrSKUTaken, err)
+	}
+
+	saved, err := store.Get(ctx, shirt.ID)
+	if err != nil {
+		t.Fatalf("getting product: %s", err)
+	}
+	if exp, got := 15, saved.Quantity; exp != got {
+		t.Fatalf("expected the quantity of both variants %v, got %v", exp, got)
+	}
+	if diff := cmp.Diff(product.Variants{*medium, *large}, saved.Variants); diff != "" {
+		t.Fatalf("saved variants did not match:\n%s", diff)
+	}
+
+	{ // Selling
+
+		ns := product.NewSale{Quantity: 1, Paid: money.Money{Amount: 500, Currency: "INR"}}
+		if _, err := store.AddSale(ctx, claims, ns, shirt.ID, now); err != product.ErrVariantRequired {
+			t.Fatalf("selling without a variant: expected %v, got %v", product.ErrVariantRequired, err)
+		}
+
+		ns = product.NewSale{VariantID: &large.ID, Quantity: 6, Paid: money.Money{Amount: 3600, Currency: "INR"}}
+		_, err := store.AddSale(ctx, claims, ns, shirt.ID, now)
+		if stockErr, ok := err.(*product.InsufficientStockError); !ok || stockErr.VariantID != large.ID || stockErr.Available != 5 {
+			t.Fatalf("overselling a variant: expected *InsufficientStockError for 5 of %s, got %v", large.ID, err)
+		}
+
+		ns = product.NewSale{VariantID: &large.ID, Quantity: 2, Paid: money.Money{Amount: 1200, Currency: "INR"}}
+		sale, err := store.AddSale(ctx, claims, ns, shirt.ID, now)
+		if err != nil {
+			t.Fatalf("selling a variant: %s", err)
+		}
+
+		no := product.NewOrder{Items: []product.NewOrderItem{
+			{ProductID: shirt.ID, VariantID: &medium.ID, Quantity: 3, Paid: money.Money{Amount: 1500, Currency: "INR"}},
+		}}
+		if _, err := store.CreateOrder(ctx, claims, no, now); err != nil {
+			t.Fatalf("ordering a variant: %s", err)
+		}
+
+		nr := product.NewRefund{Quantity: 1, Amount: 600, Reason: "Too big"}
+		if _, err := store.AddRefund(ctx, claims, nr, shirt.ID, sale.ID, now); err != nil {
+			t.Fatalf("refunding a variant: %s", err)
+		}
+
+		saved, err := store.Get(ctx, shirt.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if exp, got := 11, saved.Quantity; exp != got {
+			t.Fatalf("expected product quantity %v, got %v", exp, got)
+		}
+		if exp, got := 4, saved.Sold; exp != got {
+			t.Fatalf("expected %v sold across variants, got %v", exp, got)
+		}
+		if exp, got := 2100, saved.Revenue.In("INR"); exp != got {
+			t.Fatalf("expected revenue %v across variants, got %v", exp, got)
+		}
+		if exp, got := 7, saved.Variants[0].Quantity; exp != got {
+			t.Fatalf("expected %v of the medium left, got %v", exp, got)
+		}
+		if exp, got := 4, saved.Variants[1].Quantity; exp != got {
+			t.Fatalf("expected %v of the extra large left, got %v", exp, got)
+		}
+	}
+
+	{ // Stock is changed through the variants
+
+		update := product.UpdateProduct{Quantity: tests.IntPointer(100)}
+		if err := store.Update(ctx, claims, shirt.ID, update, 0, now); err != product.ErrHasVariants {
+			t.Fatalf("setting the product quantity: expected %v, got %v", product.ErrHasVariants, err)
+		}
+
+		if err := store.EditVariant(ctx, claims, shirt.ID, medium.ID, product.UpdateVariant{Quantity: tests.IntPointer(20)}, now); err != nil {
+			t.Fatalf("restocking variant: %s", err)
+		}
+		saved, err := store.Get(ctx, shirt.ID)
+		if err != nil {
+			t.Fatalf("getting product: %s", err)
+		}
+		if exp, got := 24, saved.Quantity; exp != got {
+			t.Fatalf("expected product quantity %v after restocking, got %v", exp, got)
+		}
+	}
+
+	{ // Searching by SKU
+
+		page, err := store.List(ctx, product.ListFilter{SKU: "tee-red"})
+		if err != nil {
+			t.Fatalf("listing by SKU: %s", err)
+		}
+		if page.Total != 1 || page.Items[0].ID != shirt.ID {
+			t.Fatalf("expected the shirt for SKU prefix, got %+v", page.Items)
+		}
+	}
+
+	{ // Deleting
+
+		if err := store.DeleteVariant(ctx, claims, shirt.ID, large.ID, now); err != product.ErrVariantInUse {
+			t.Fatalf("deleting a sold variant: expected %v, got %v", product.ErrVariantInUse, err)
+		}
+	}
+}
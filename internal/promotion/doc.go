@@ -0,0 +1,3 @@
+// Package promotion implements all business logic regarding discount codes
+// and the promotions they redeem.
+package promotion
@@ -0,0 +1,46 @@
+package promotion
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// These are the kinds of discount a Promotion can give.
+const (
+	KindPercent = "percent" // Value percent off the list price.
+	KindFixed   = "fixed"   // Value off the list price, in the minor unit of Currency.
+)
+
+// Promotion is a discount redeemed with a code. It can be limited to a window
+// of time, to a number of redemptions and to some Products, either named
+// directly or through a Category they are in. With no Products or Categories
+// it covers everything.
+type Promotion struct {
+	ID             string         `db:"promotion_id" json:"id"`
+	Code           string         `db:"code" json:"code"`
+	Kind           string         `db:"kind" json:"kind"`
+	Value          int            `db:"value" json:"value"`
+	Currency       *string        `db:"currency" json:"currency,omitempty"`
+	StartsAt       *time.Time     `db:"starts_at" json:"starts_at,omitempty"`
+	EndsAt         *time.Time     `db:"ends_at" json:"ends_at,omitempty"`
+	MaxRedemptions *int           `db:"max_redemptions" json:"max_redemptions,omitempty"`
+	Redemptions    int            `db:"redemptions" json:"redemptions"`
+	ProductIDs     pq.StringArray `db:"product_ids" json:"product_ids"`
+	CategoryIDs    pq.StringArray `db:"category_ids" json:"category_ids"`
+	DateCreated    time.Time      `db:"date_created" json:"date_created"`
+}
+
+// NewPromotion is what we require from clients when adding a Promotion. A
+// fixed discount needs a Currency and a percentage must not have one.
+type NewPromotion struct {
+	Code           string     `json:"code" validate:"required,max=64"`
+	Kind           string     `json:"kind" validate:"required,oneof=percent fixed"`
+	Value          int        `json:"value" validate:"gte=1"`
+	Currency       *string    `json:"currency" validate:"omitempty,iso4217"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	MaxRedemptions *int       `json:"max_redemptions" validate:"omitempty,gte=1"`
+	ProductIDs     []string   `json:"product_ids" validate:"omitempty,dive,uuid"`
+	CategoryIDs    []string   `json:"category_ids" validate:"omitempty,dive,uuid"`
+}
@@ -0,0 +1,267 @@
+package promotion
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrNotFound is used when a specific Promotion is requested, by ID or by
+	// code, but does not exist.
+	ErrNotFound = errors.New("promotion not found")
+
+	// ErrInvalidID is used when an invalid UUID is provided.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrCodeTaken is used when a Promotion is added with a code another one
+	// already has.
+	ErrCodeTaken = errors.New("promotion code is already in use")
+
+	// ErrInvalidDiscount is used when a percentage is over 100 or has a
+	// currency, or a fixed discount has none.
+	ErrInvalidDiscount = errors.New("percent discounts must be at most 100 with no currency and fixed discounts need a currency")
+
+	// ErrInvalidWindow is used when a Promotion would end before it starts.
+	ErrInvalidWindow = errors.New("promotion must end after it starts")
+
+	// ErrNotActive is used when a code is redeemed outside of its window.
+	ErrNotActive = errors.New("promotion is not active")
+
+	// ErrExhausted is used when a code has been redeemed as many times as it
+	// allows.
+	ErrExhausted = errors.New("promotion has no redemptions left")
+
+	// ErrNotApplicable is used when a code is redeemed for Products it does not
+	// cover.
+	ErrNotApplicable = errors.New("promotion does not cover these products")
+
+	// ErrCurrencyMismatch is used when a discount would be taken from a price
+	// in another currency than the discount or the payment.
+	ErrCurrencyMismatch = errors.New("promotion does not apply in this currency")
+
+	// ErrPaidMismatch is used when a sale made with a code is paid something
+	// other than its price after the discount.
+	ErrPaidMismatch = errors.New("paid amount does not match the discounted price")
+)
+
+// normalizeCode makes codes case insensitive.
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// List gets all Promotions from the database, newest first.
+func List(ctx context.Context, db *sqlx.DB) ([]Promotion, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.promotion.list")
+	defer span.End()
+
+	promotions := []Promotion{}
+
+	const q = `SELECT * FROM promotions ORDER BY date_created DESC, promotion_id`
+	if err := db.SelectContext(ctx, &promotions, q); err != nil {
+		return nil, errors.Wrap(err, "selecting promotions")
+	}
+
+	return promotions, nil
+}
+
+// Create adds a Promotion to the database. It returns the created Promotion
+// with fields like ID and DateCreated populated.
+func Create(ctx context.Context, db *sqlx.DB, np NewPromotion, now time.Time) (*Promotion, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.promotion.create")
+	defer span.End()
+
+	switch np.Kind {
+	case KindPercent:
+		if np.Value > 100 || np.Currency != nil {
+			return nil, ErrInvalidDiscount
+		}
+	case KindFixed:
+		if np.Currency == nil {
+			return nil, ErrInvalidDiscount
+		}
+	}
+	if np.StartsAt != nil && np.EndsAt != nil && !np.EndsAt.After(*np.StartsAt) {
+		return nil, ErrInvalidWindow
+	}
+
+	p := Promotion{
+		ID:             uuid.New().String(),
+		Code:           normalizeCode(np.Code),
+		Kind:           np.Kind,
+		Value:          np.Value,
+		Currency:       np.Currency,
+		StartsAt:       utc(np.StartsAt),
+		EndsAt:         utc(np.EndsAt),
+		MaxRedemptions: np.MaxRedemptions,
+		ProductIDs:     pq.StringArray(np.ProductIDs),
+		CategoryIDs:    pq.StringArray(np.CategoryIDs),
+		DateCreated:    now.UTC(),
+	}
+	if p.ProductIDs == nil {
+		p.ProductIDs = pq.StringArray{}
+	}
+	if p.CategoryIDs == nil {
+		p.CategoryIDs = pq.StringArray{}
+	}
+
+	const q = `INSERT INTO promotions
+		(promotion_id, code, kind, value, currency, starts_at, ends_at,
+		max_redemptions, product_ids, category_ids, date_created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	_, err := db.ExecContext(ctx, q,
+		p.ID, p.Code, p.Kind, p.Value, p.Currency, p.StartsAt, p.EndsAt,
+		p.MaxRedemptions, p.ProductIDs, p.CategoryIDs, p.DateCreated,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrCodeTaken
+		}
+		return nil, errors.Wrap(err, "inserting promotion")
+	}
+
+	return &p, nil
+}
+
+// utc converts an optional time to UTC.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// Get finds the Promotion identified by a given ID.
+func Get(ctx context.Context, db *sqlx.DB, id string) (*Promotion, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.promotion.get")
+	defer span.End()
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	var p Promotion
+
+	const q = `SELECT * FROM promotions WHERE promotion_id = $1`
+	if err := db.GetContext(ctx, &p, q, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "selecting single promotion")
+	}
+
+	return &p, nil
+}
+
+// Redeem uses up one redemption of the Promotion with the given code as part
+// of tx. The Promotion stays locked until tx ends, so concurrent redemptions
+// of the same code queue up and can never go over its limit. Rolling tx back
+// gives the redemption back.
+func Redeem(ctx context.Context, tx *sqlx.Tx, code string, now time.Time) (*Promotion, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.promotion.redeem")
+	defer span.End()
+
+	var p Promotion
+
+	const lock = `SELECT * FROM promotions WHERE code = $1 FOR UPDATE`
+	if err := tx.GetContext(ctx, &p, lock, normalizeCode(code)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "locking promotion")
+	}
+
+	now = now.UTC()
+	if (p.StartsAt != nil && now.Before(*p.StartsAt)) || (p.EndsAt != nil && !now.Before(*p.EndsAt)) {
+		return nil, ErrNotActive
+	}
+	if p.MaxRedemptions != nil && p.Redemptions >= *p.MaxRedemptions {
+		return nil, ErrExhausted
+	}
+
+	const q = `UPDATE promotions SET redemptions = redemptions + 1 WHERE promotion_id = $1`
+	if _, err := tx.ExecContext(ctx, q, p.ID); err != nil {
+		return nil, errors.Wrap(err, "counting redemption")
+	}
+	p.Redemptions++
+
+	return &p, nil
+}
+
+// Covers reports whether the Promotion applies to the Product with the given
+// ID. A Product is covered when it is named by the Promotion or is in one of
+// its Categories or any of their descendants.
+func Covers(ctx context.Context, db sqlx.QueryerContext, p Promotion, productID string) (bool, error) {
+	if len(p.ProductIDs) == 0 && len(p.CategoryIDs) == 0 {
+		return true, nil
+	}
+	for _, id := range p.ProductIDs {
+		if id == productID {
+			return true, nil
+		}
+	}
+	if len(p.CategoryIDs) == 0 {
+		return false, nil
+	}
+
+	// Walk up from the Product's category looking for one of the promotion's.
+	const q = `WITH RECURSIVE ancestors AS (
+			SELECT c.category_id, c.parent_id FROM categories AS c
+			JOIN products AS p ON p.category_id = c.category_id
+			WHERE p.product_id = $1
+			UNION ALL
+			SELECT c.category_id, c.parent_id FROM categories AS c
+			JOIN ancestors AS a ON c.category_id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE category_id = ANY($2::uuid[]))`
+
+	var covered bool
+	if err := sqlx.GetContext(ctx, db, &covered, q, productID, p.CategoryIDs); err != nil {
+		return false, errors.Wrap(err, "checking promotion categories")
+	}
+
+	return covered, nil
+}
+
+// Apply works out the discount on each of a set of list prices covered by the
+// Promotion, such as the lines of an order. A percentage is taken off every
+// price, rounding down. A fixed amount is used up across the prices in order
+// so that in total no more than the amount is taken off; the prices must then
+// be in the Promotion's currency.
+func (p Promotion) Apply(prices []money.Money) ([]int, error) {
+	discounts := make([]int, len(prices))
+
+	switch p.Kind {
+	case KindPercent:
+		for i, price := range prices {
+			discounts[i] = price.Amount * p.Value / 100
+		}
+
+	case KindFixed:
+		left := p.Value
+		for i, price := range prices {
+			if p.Currency == nil || price.Currency != *p.Currency {
+				return nil, ErrCurrencyMismatch
+			}
+			d := price.Amount
+			if d > left {
+				d = left
+			}
+			discounts[i] = d
+			left -= d
+		}
+	}
+
+	return discounts, nil
+}
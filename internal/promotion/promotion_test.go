@@ -0,0 +1,133 @@
+package promotion_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/promotion"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestApply(t *testing.T) {
+	inr := "INR"
+	prices := []money.Money{{Amount: 150, Currency: "INR"}, {Amount: 99, Currency: "INR"}}
+
+	tt := []struct {
+		name  string
+		promo promotion.Promotion
+		want  []int
+		err   error
+	}{
+		{"Percent", promotion.Promotion{Kind: promotion.KindPercent, Value: 10}, []int{15, 9}, nil},
+		{"FixedSpreadsOverLines", promotion.Promotion{Kind: promotion.KindFixed, Value: 200, Currency: &inr}, []int{150, 50}, nil},
+		{"FixedCoversEverything", promotion.Promotion{Kind: promotion.KindFixed, Value: 500, Currency: &inr}, []int{150, 99}, nil},
+		{"FixedOtherCurrency", promotion.Promotion{Kind: promotion.KindFixed, Value: 5, Currency: tests.StringPointer("USD")}, nil, promotion.ErrCurrencyMismatch},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.promo.Apply(prices)
+			if err != tc.err {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if diff := cmp.Diff(tc.want, got); tc.err == nil && diff != "" {
+				t.Fatalf("discounts did not match:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPromotions(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	tomorrow := now.Add(24 * time.Hour)
+
+	{ // Create
+
+		np := promotion.NewPromotion{Code: " spring10 ", Kind: promotion.KindPercent, Value: 10, EndsAt: &tomorrow, MaxRedemptions: tests.IntPointer(2)}
+		p, err := promotion.Create(ctx, db, np, now)
+		if err != nil {
+			t.Fatalf("creating promotion: %s", err)
+		}
+		if exp, got := "SPRING10", p.Code; exp != got {
+			t.Fatalf("expected code %q, got %q", exp, got)
+		}
+
+		saved, err := promotion.Get(ctx, db, p.ID)
+		if err != nil {
+			t.Fatalf("getting promotion: %s", err)
+		}
+		if diff := cmp.Diff(p, saved, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("saved promotion did not match:\n%s", diff)
+		}
+
+		if _, err := promotion.Create(ctx, db, promotion.NewPromotion{Code: "Spring10", Kind: promotion.KindPercent, Value: 5}, now); err != promotion.ErrCodeTaken {
+			t.Fatalf("reusing a code: expected %v, got %v", promotion.ErrCodeTaken, err)
+		}
+		if _, err := promotion.Create(ctx, db, promotion.NewPromotion{Code: "HALF", Kind: promotion.KindPercent, Value: 150}, now); err != promotion.ErrInvalidDiscount {
+			t.Fatalf("over 100 percent: expected %v, got %v", promotion.ErrInvalidDiscount, err)
+		}
+		if _, err := promotion.Create(ctx, db, promotion.NewPromotion{Code: "FIVE", Kind: promotion.KindFixed, Value: 5}, now); err != promotion.ErrInvalidDiscount {
+			t.Fatalf("fixed without a currency: expected %v, got %v", promotion.ErrInvalidDiscount, err)
+		}
+		if _, err := promotion.Create(ctx, db, promotion.NewPromotion{Code: "NEVER", Kind: promotion.KindPercent, Value: 5, StartsAt: &tomorrow, EndsAt: &now}, now); err != promotion.ErrInvalidWindow {
+			t.Fatalf("ending before starting: expected %v, got %v", promotion.ErrInvalidWindow, err)
+		}
+	}
+
+	redeem := func(code string, at time.Time) error {
+		tx, err := db.BeginTxx(ctx, nil)
+		if err != nil {
+			t.Fatalf("starting transaction: %s", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := promotion.Redeem(ctx, tx, code, at); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	{ // Redeem
+
+		if err := redeem("spring10", tomorrow); err != promotion.ErrNotActive {
+			t.Fatalf("redeeming after the end: expected %v, got %v", promotion.ErrNotActive, err)
+		}
+		if err := redeem("winter", now); err != promotion.ErrNotFound {
+			t.Fatalf("redeeming an unknown code: expected %v, got %v", promotion.ErrNotFound, err)
+		}
+	}
+
+	{ // Concurrent redemptions never go over the limit
+
+		const attempts = 10
+		errs := make(chan error, attempts)
+		for i := 0; i < attempts; i++ {
+			go func() {
+				errs <- redeem("SPRING10", now)
+			}()
+		}
+
+		var redeemed int
+		for i := 0; i < attempts; i++ {
+			switch err := <-errs; err {
+			case nil:
+				redeemed++
+			case promotion.ErrExhausted:
+			default:
+				t.Fatalf("redeeming concurrently: %s", err)
+			}
+		}
+		if exp, got := 2, redeemed; exp != got {
+			t.Fatalf("expected %v successful redemptions, got %v", exp, got)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Package report implements the analytics computed over sales for finance.
+package report
@@ -0,0 +1,81 @@
+package report
+
+import (
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/money"
+)
+
+// These are the widths of the time buckets a sales report can use.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// These are the ways the rows of a sales report can be broken down within
+// each bucket.
+const (
+	GroupProduct  = "product"
+	GroupUser     = "user"
+	GroupCategory = "category"
+)
+
+// SalesQuery describes a sales report. Sales are included when From <= date
+// created < To. Buckets start at midnight in TimeZone, which defaults to UTC,
+// and GroupBy is optional.
+type SalesQuery struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	GroupBy  string
+	TimeZone string
+}
+
+// SalesBucket is one row of a sales report: the units sold and the revenue
+// taken in one currency during the bucket starting at Start, net of refunds.
+// Sales in different currencies are reported in separate rows. GroupID is the id
+// of the product, user or category the row is for when the report is grouped.
+// Products without a category are reported together with no GroupID.
+type SalesBucket struct {
+	Start    time.Time   `db:"bucket" json:"start"`
+	GroupID  *string     `db:"group_id" json:"group_id,omitempty"`
+	Quantity int         `db:"quantity" json:"quantity"`
+	Revenue  money.Money `db:"revenue" json:"revenue"`
+}
+
+// These are the measures products can be ranked by in a top products report.
+const (
+	RankUnits   = "units"
+	RankRevenue = "revenue"
+)
+
+// TopQuery describes a top products report. Products are ranked by what they
+// sold when From <= date created < To and compared with the period of the same
+// length just before From. Ranking by revenue counts revenue in Currency only.
+// CategoryID is optional and includes the categories below it.
+type TopQuery struct {
+	From       time.Time
+	To         time.Time
+	By         string
+	Limit      int
+	Currency   string
+	CategoryID string
+}
+
+// TopProduct is one row of a top products report. Quantity and Revenue are
+// net of refunds over the period, with Revenue per currency. Products that
+// sold the same share a Rank. PreviousRank is nil when the product sold
+// nothing in the previous period, and RankChange is positive when it moved up.
+// The other changes are from the previous period.
+type TopProduct struct {
+	Rank           int          `db:"rank" json:"rank"`
+	ProductID      string       `db:"product_id" json:"product_id"`
+	Name           string       `db:"name" json:"name"`
+	Quantity       int          `db:"quantity" json:"quantity"`
+	Revenue        money.Totals `db:"revenue" json:"revenue"`
+	PreviousRank   *int         `db:"previous_rank" json:"previous_rank"`
+	RankChange     *int         `db:"rank_change" json:"rank_change"`
+	QuantityChange int          `db:"quantity_change" json:"quantity_change"`
+	RevenueChange  money.Totals `db:"revenue_change" json:"revenue_change"`
+}
@@ -0,0 +1,225 @@
+package report
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/category"
+	"github.com/rakshans1/service/internal/platform/money"
+	"go.opentelemetry.io/otel/api/global"
+)
+
+// Predefined errors identify expected failure conditions.
+var (
+	// ErrInvalidRange is used when a report ends before it starts.
+	ErrInvalidRange = errors.New("report range must end after it starts")
+
+	// ErrInvalidInterval is used when an unknown bucket width is requested.
+	ErrInvalidInterval = errors.New("interval must be day, week or month")
+
+	// ErrInvalidGroup is used when an unknown grouping is requested.
+	ErrInvalidGroup = errors.New("group must be product, user or category")
+
+	// ErrInvalidTimeZone is used when the time zone is not a known IANA name.
+	ErrInvalidTimeZone = errors.New("time zone is not recognized")
+
+	// ErrInvalidRank is used when products are ranked by an unknown measure.
+	ErrInvalidRank = errors.New("products must be ranked by units or revenue")
+
+	// ErrInvalidLimit is used when more top products are requested than a
+	// report holds, or none.
+	ErrInvalidLimit = errors.New("limit must be between 1 and 100")
+
+	// ErrCurrencyRequired is used when products are ranked by revenue without
+	// a known currency to compare it in.
+	ErrCurrencyRequired = errors.New("ranking by revenue needs a known currency")
+
+	// ErrInvalidCategory is used when the category is not a UUID.
+	ErrInvalidCategory = errors.New("category ID is not in its proper form")
+)
+
+// MaxTopProducts is the most products a top products report holds.
+const MaxTopProducts = 100
+
+// groups maps each supported grouping to the column it groups by.
+var groups = map[string]string{
+	"":            "NULL::text",
+	GroupProduct:  "p.product_id::text",
+	GroupUser:     "p.user_id::text",
+	GroupCategory: "p.category_id::text",
+}
+
+// Sales reports the units sold and revenue taken in each time bucket of the
+// query range. Refunds are subtracted in the bucket they were made in.
+// Revenue in different currencies is never added together; each currency has
+// its own row in a bucket. Like TopProducts it leaves out products in the
+// trash.
+func Sales(ctx context.Context, db *sqlx.DB, sq SalesQuery) ([]SalesBucket, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.report.sales")
+	defer span.End()
+
+	if !sq.From.Before(sq.To) {
+		return nil, ErrInvalidRange
+	}
+	switch sq.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return nil, ErrInvalidInterval
+	}
+	group, ok := groups[sq.GroupBy]
+	if !ok {
+		return nil, ErrInvalidGroup
+	}
+	if sq.TimeZone == "" {
+		sq.TimeZone = "UTC"
+	}
+	if _, err := time.LoadLocation(sq.TimeZone); err != nil || sq.TimeZone == "Local" {
+		return nil, ErrInvalidTimeZone
+	}
+
+	// Dates are stored as UTC timestamps. They are shifted to local time in
+	// the requested zone to be truncated and the bucket start is shifted back
+	// so it is returned as an absolute time.
+	q := `WITH entries AS (
+			SELECT product_id, date_created, quantity, paid AS amount, currency
+			FROM sales
+			WHERE date_created >= $1 AND date_created < $2
+			UNION ALL
+			SELECT product_id, date_created, -quantity, -amount, currency
+			FROM refunds
+			WHERE date_created >= $1 AND date_created < $2
+		)
+		SELECT
+			date_trunc($3, e.date_created AT TIME ZONE 'UTC' AT TIME ZONE $4) AT TIME ZONE $4 AS bucket,
+			` + group + ` AS group_id,
+			SUM(e.quantity) AS quantity,
+			SUM(e.amount) AS "revenue.amount",
+			e.currency AS "revenue.currency"
+		FROM entries AS e
+		JOIN products AS p ON p.product_id = e.product_id
+		WHERE p.deleted_at IS NULL
+		GROUP BY 1, 2, e.currency
+		ORDER BY 1, 2, e.currency`
+
+	buckets := []SalesBucket{}
+	if err := db.SelectContext(ctx, &buckets, q, sq.From.UTC(), sq.To.UTC(), sq.Interval, sq.TimeZone); err != nil {
+		return nil, errors.Wrap(err, "selecting sales report")
+	}
+
+	return buckets, nil
+}
+
+// TopProducts ranks the products that sold in the query range by units or
+// revenue and compares each with how it did in the period of the same length
+// before. Refunds are subtracted in the period they were made in. Ranked by
+// revenue, only products that sold in the query currency are included.
+// Products in the trash are left out.
+func TopProducts(ctx context.Context, db *sqlx.DB, tq TopQuery) ([]TopProduct, error) {
+	ctx, span := global.Tracer("service").Start(ctx, "internal.report.topproducts")
+	defer span.End()
+
+	if !tq.From.Before(tq.To) {
+		return nil, ErrInvalidRange
+	}
+	if tq.Limit < 1 || tq.Limit > MaxTopProducts {
+		return nil, ErrInvalidLimit
+	}
+
+	// Each product is ranked separately in the two periods, among the
+	// products that sold in that period.
+	var measure, previous string
+	switch tq.By {
+	case RankUnits:
+		measure, previous = "t.quantity", "t.previous_quantity"
+	case RankRevenue:
+		if !money.IsCurrency(tq.Currency) {
+			return nil, ErrCurrencyRequired
+		}
+		measure, previous = "t.amount", "t.previous_amount"
+	default:
+		return nil, ErrInvalidRank
+	}
+
+	prevFrom := tq.From.Add(-tq.To.Sub(tq.From))
+	args := []interface{}{prevFrom.UTC(), tq.From.UTC(), tq.To.UTC(), tq.Currency, tq.Limit}
+
+	filter := "WHERE p.deleted_at IS NULL"
+	if tq.CategoryID != "" {
+		if _, err := uuid.Parse(tq.CategoryID); err != nil {
+			return nil, ErrInvalidCategory
+		}
+		args = append(args, tq.CategoryID)
+		filter += " AND p.category_id IN (" + category.SubtreeQuery("$6") + ")"
+	}
+
+	// Sums are NULL for a period the product did not sell in, or did not sell
+	// in the query currency, which keeps it out of the ranking for that
+	// period.
+	q := `WITH entries AS (
+			SELECT product_id, date_created, quantity, paid AS amount, currency
+			FROM sales
+			WHERE date_created >= $1 AND date_created < $3
+			UNION ALL
+			SELECT product_id, date_created, -quantity, -amount, currency
+			FROM refunds
+			WHERE date_created >= $1 AND date_created < $3
+		),
+		amounts AS (
+			SELECT
+				e.product_id,
+				e.currency,
+				SUM(e.quantity) FILTER (WHERE e.date_created >= $2) AS quantity,
+				SUM(e.amount) FILTER (WHERE e.date_created >= $2) AS amount,
+				SUM(e.quantity) FILTER (WHERE e.date_created < $2) AS previous_quantity,
+				SUM(e.amount) FILTER (WHERE e.date_created < $2) AS previous_amount
+			FROM entries AS e
+			JOIN products AS p ON p.product_id = e.product_id
+			` + filter + `
+			GROUP BY e.product_id, e.currency
+		),
+		totals AS (
+			SELECT
+				product_id,
+				SUM(quantity) AS quantity,
+				SUM(previous_quantity) AS previous_quantity,
+				SUM(amount) FILTER (WHERE currency = $4) AS amount,
+				SUM(previous_amount) FILTER (WHERE currency = $4) AS previous_amount,
+				COALESCE(json_agg(json_build_object('amount', amount, 'currency', currency) ORDER BY currency)
+					FILTER (WHERE amount IS NOT NULL), '[]') AS revenue,
+				json_agg(json_build_object('amount', COALESCE(amount, 0) - COALESCE(previous_amount, 0), 'currency', currency)
+					ORDER BY currency) AS revenue_change
+			FROM amounts
+			GROUP BY product_id
+		),
+		ranked AS (
+			SELECT
+				t.*,
+				CASE WHEN ` + measure + ` IS NOT NULL THEN
+					RANK() OVER (PARTITION BY ` + measure + ` IS NULL ORDER BY ` + measure + ` DESC)
+				END AS rank,
+				CASE WHEN ` + previous + ` IS NOT NULL THEN
+					RANK() OVER (PARTITION BY ` + previous + ` IS NULL ORDER BY ` + previous + ` DESC)
+				END AS previous_rank
+			FROM totals AS t
+		)
+		SELECT
+			r.rank, r.product_id, p.name, r.quantity, r.revenue, r.previous_rank,
+			r.previous_rank - r.rank AS rank_change,
+			r.quantity - COALESCE(r.previous_quantity, 0) AS quantity_change,
+			r.revenue_change
+		FROM ranked AS r
+		JOIN products AS p ON p.product_id = r.product_id
+		WHERE r.rank IS NOT NULL
+		ORDER BY r.rank, r.product_id
+		LIMIT $5`
+
+	top := []TopProduct{}
+	if err := db.SelectContext(ctx, &top, q, args...); err != nil {
+		return nil, errors.Wrapf(err, "selecting top products by %s", tq.By)
+	}
+
+	return top, nil
+}
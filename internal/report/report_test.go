@@ -0,0 +1,222 @@
+package report_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/rakshans1/service/internal/category"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/report"
+	"github.com/rakshans1/service/internal/tests"
+)
+
+func TestSales(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	// The seed has 3 sales of 2 products in the first seconds of 2019 UTC.
+	sq := report.SalesQuery{
+		From:     time.Date(2018, time.December, 30, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2019, time.January, 2, 0, 0, 0, 0, time.UTC),
+		Interval: report.IntervalDay,
+		GroupBy:  report.GroupProduct,
+	}
+
+	buckets, err := report.Sales(ctx, db, sq)
+	if err != nil {
+		t.Fatalf("reporting sales: %s", err)
+	}
+	if exp, got := 2, len(buckets); exp != got {
+		t.Fatalf("expected %v buckets, got %v", exp, got)
+	}
+
+	var quantity, revenue int
+	for _, b := range buckets {
+		if !b.Start.Equal(sq.To.AddDate(0, 0, -1)) {
+			t.Fatalf("expected bucket to start at %v, got %v", sq.To.AddDate(0, 0, -1), b.Start)
+		}
+		quantity += b.Quantity
+		revenue += b.Revenue.Amount
+	}
+	if quantity != 10 || revenue != 575 {
+		t.Fatalf("expected 10 units and 575 revenue, got %v and %v", quantity, revenue)
+	}
+
+	// West of UTC the same sales fall on the last day of 2018.
+	sq.GroupBy = ""
+	sq.TimeZone = "America/New_York"
+
+	buckets, err = report.Sales(ctx, db, sq)
+	if err != nil {
+		t.Fatalf("reporting sales: %s", err)
+	}
+	if exp, got := 1, len(buckets); exp != got {
+		t.Fatalf("expected %v bucket, got %v", exp, got)
+	}
+
+	ny, err := time.LoadLocation(sq.TimeZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := time.Date(2018, time.December, 31, 0, 0, 0, 0, ny); !buckets[0].Start.Equal(exp) {
+		t.Fatalf("expected bucket to start at %v, got %v", exp, buckets[0].Start)
+	}
+
+	sq.TimeZone = "Mars/Olympus_Mons"
+	if _, err := report.Sales(ctx, db, sq); err != report.ErrInvalidTimeZone {
+		t.Fatalf("expected %v, got %v", report.ErrInvalidTimeZone, err)
+	}
+}
+
+func TestTopProducts(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	const (
+		comics = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		toys   = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+	)
+
+	// The seed sells 5 comics and 3 toys in these two seconds, and 2 comics
+	// in the two before.
+	tq := report.TopQuery{
+		From:  time.Date(2019, time.January, 1, 0, 0, 4, 0, time.UTC),
+		To:    time.Date(2019, time.January, 1, 0, 0, 6, 0, time.UTC),
+		By:    report.RankUnits,
+		Limit: 10,
+	}
+
+	top, err := report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products: %s", err)
+	}
+
+	one := 1
+	zero := 0
+	want := []report.TopProduct{
+		{
+			Rank: 1, ProductID: comics, Name: "Comic Books", Quantity: 5,
+			Revenue:      money.Totals{{Amount: 250, Currency: "INR"}},
+			PreviousRank: &one, RankChange: &zero, QuantityChange: 3,
+			RevenueChange: money.Totals{{Amount: 150, Currency: "INR"}},
+		},
+		{
+			Rank: 2, ProductID: toys, Name: "McDonalds Toys", Quantity: 3,
+			Revenue:        money.Totals{{Amount: 225, Currency: "INR"}},
+			QuantityChange: 3,
+			RevenueChange:  money.Totals{{Amount: 225, Currency: "INR"}},
+		},
+	}
+	if diff := cmp.Diff(want, top); diff != "" {
+		t.Fatalf("top products did not match:\n%s", diff)
+	}
+
+	tq.By = report.RankRevenue
+	if _, err := report.TopProducts(ctx, db, tq); err != report.ErrCurrencyRequired {
+		t.Fatalf("expected %v, got %v", report.ErrCurrencyRequired, err)
+	}
+
+	tq.Currency = "INR"
+	tq.Limit = 1
+	top, err = report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products by revenue: %s", err)
+	}
+	if len(top) != 1 || top[0].ProductID != comics {
+		t.Fatalf("expected only the comics to top revenue, got %+v", top)
+	}
+
+	// Nothing sold in dollars so there is no revenue to rank by.
+	tq.Currency = "USD"
+	top, err = report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products by revenue in another currency: %s", err)
+	}
+	if len(top) != 0 {
+		t.Fatalf("expected no products to rank by dollar revenue, got %+v", top)
+	}
+	tq.Currency = "INR"
+
+	// Filtering by a category includes the categories below it.
+	now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	toysCat, err := category.Create(ctx, db, category.NewCategory{Name: "Toys"}, now)
+	if err != nil {
+		t.Fatalf("creating category: %s", err)
+	}
+	figures, err := category.Create(ctx, db, category.NewCategory{Name: "Figures", ParentID: &toysCat.ID}, now)
+	if err != nil {
+		t.Fatalf("creating child category: %s", err)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE products SET category_id = $1 WHERE product_id = $2`, figures.ID, toys); err != nil {
+		t.Fatalf("categorizing product: %s", err)
+	}
+
+	tq.CategoryID = toysCat.ID
+	top, err = report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products in a category: %s", err)
+	}
+	if len(top) != 1 || top[0].ProductID != toys || top[0].Rank != 1 {
+		t.Fatalf("expected only the toys in the category, got %+v", top)
+	}
+
+	// Products in the trash are not ranked, so the toys move up to first.
+	if _, err := db.ExecContext(ctx, `UPDATE products SET deleted_at = $1 WHERE product_id = $2`, now, comics); err != nil {
+		t.Fatalf("trashing product: %s", err)
+	}
+
+	tq = report.TopQuery{From: tq.From, To: tq.To, By: report.RankUnits, Limit: 10}
+	top, err = report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products with one in the trash: %s", err)
+	}
+	if len(top) != 1 || top[0].ProductID != toys || top[0].Rank != 1 {
+		t.Fatalf("expected only the toys once the comics are trashed, got %+v", top)
+	}
+}
+
+// TestTrashedProducts ensures both reports leave out a product in the trash
+// so their figures agree.
+func TestTrashedProducts(t *testing.T) {
+	db, teardown := tests.NewUnit(t)
+	defer teardown()
+
+	ctx := context.Background()
+
+	const (
+		comics = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+		toys   = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+	)
+
+	now := time.Date(2019, time.January, 2, 0, 0, 0, 0, time.UTC)
+	if _, err := db.ExecContext(ctx, `UPDATE products SET deleted_at = $1 WHERE product_id = $2`, now, toys); err != nil {
+		t.Fatalf("trashing product: %s", err)
+	}
+
+	// Only the 7 comics sold for 350 are left of the seeded sales.
+	from := time.Date(2018, time.December, 30, 0, 0, 0, 0, time.UTC)
+	sq := report.SalesQuery{From: from, To: now, Interval: report.IntervalDay, GroupBy: report.GroupProduct}
+
+	buckets, err := report.Sales(ctx, db, sq)
+	if err != nil {
+		t.Fatalf("reporting sales: %s", err)
+	}
+	if len(buckets) != 1 || buckets[0].Quantity != 7 || buckets[0].Revenue.Amount != 350 {
+		t.Fatalf("expected one bucket of 7 comics for 350, got %+v", buckets)
+	}
+
+	tq := report.TopQuery{From: from, To: now, By: report.RankUnits, Limit: 10}
+	top, err := report.TopProducts(ctx, db, tq)
+	if err != nil {
+		t.Fatalf("reporting top products: %s", err)
+	}
+	if len(top) != 1 || top[0].ProductID != comics || top[0].Quantity != 7 {
+		t.Fatalf("expected only the 7 comics to rank, got %+v", top)
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"time"
+
+	"github.com/rakshans1/service/internal/platform/blob"
+	"github.com/rakshans1/service/internal/platform/money"
+	"github.com/rakshans1/service/internal/product"
+	"github.com/rakshans1/service/internal/user"
+)
+
+// These are the IDs of the seeded products.
+const (
+	comicsID = "a2b0639f-2cc6-44b8-b97b-15d69dbb511e"
+	toysID   = "72f8b983-3eb4-48db-9ed0-e45cc6bd716b"
+)
+
+// seedTime is a time on the day the seeded products and sales were made.
+func seedTime(sec int) time.Time {
+	return time.Date(2019, time.January, 1, 0, 0, sec, 1000, time.UTC)
+}
+
+// NewMemoryProducts creates a product.Memory holding the same products and
+// sales testdata/seed.sql puts in a test database, with the defaults the
+// database gives them.
+func NewMemoryProducts(blobs blob.Store) *product.Memory {
+	newProduct := func(id, name string, cost, quantity, sec int) product.Product {
+		return product.Product{
+			ID:          id,
+			Name:        name,
+			Cost:        money.Money{Amount: cost, Currency: "INR"},
+			Quantity:    quantity,
+			UserID:      "00000000-0000-0000-0000-000000000000",
+			Version:     1,
+			DateCreated: seedTime(sec),
+			DateUpdated: seedTime(sec),
+		}
+	}
+	newSale := func(id, productID string, quantity, paid, sec int) product.Sale {
+		return product.Sale{
+			ID:          id,
+			ProductID:   productID,
+			Quantity:    quantity,
+			Paid:        money.Money{Amount: paid, Currency: "INR"},
+			DateCreated: seedTime(sec),
+		}
+	}
+
+	m := product.NewMemory(blobs)
+	m.Seed(
+		[]product.Product{
+			newProduct(comicsID, "Comic Books", 50, 42, 1),
+			newProduct(toysID, "McDonalds Toys", 75, 120, 2),
+		},
+		[]product.Sale{
+			newSale("98b6d4b8-f04b-4c79-8c2e-a0aef46854b7", comicsID, 2, 100, 3),
+			newSale("85f6fb09-eb05-4874-ae39-82d1a30fe0d7", comicsID, 5, 250, 4),
+			newSale("a235be9e-ab5d-44e6-a987-fa1c749264c7", toysID, 3, 225, 5),
+		},
+	)
+	return m
+}
+
+// NewMemoryUsers creates a user.Memory holding the same users as
+// testdata/seed.sql, both with the password "gophers".
+func NewMemoryUsers() *user.Memory {
+	created := time.Date(2019, time.March, 24, 0, 0, 0, 0, time.UTC)
+
+	m := user.NewMemory()
+	m.Seed([]user.User{
+		{
+			ID:           AdminID,
+			Name:         "Admin Gopher",
+			Email:        "admin@example.com",
+			Roles:        []string{"ADMIN", "USER"},
+			PasswordHash: []byte("$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8ipdry9f2/a"),
+			DateCreated:  created,
+			DateUpdated:  created,
+		},
+		{
+			ID:           UserID,
+			Name:         "User Gopher",
+			Email:        "user@example.com",
+			Roles:        []string{"USER"},
+			PasswordHash: []byte("$2a$10$9/XASPKBbJKVfCAZKDH.UuhsuALDr5vVm6VrYA9VFR8rccK86C1hW"),
+			DateCreated:  created,
+			DateUpdated:  created,
+		},
+	})
+	return m
+}
@@ -0,0 +1,64 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rakshans1/service/internal/platform/auth"
+)
+
+// Memory is a Store keeping users in memory, for tests and for running the
+// service without a database. Like the users table, it allows one user per
+// email.
+type Memory struct {
+	mu      sync.Mutex
+	byEmail map[string]User
+}
+
+// NewMemory constructs an empty Store.
+func NewMemory() *Memory {
+	return &Memory{byEmail: make(map[string]User)}
+}
+
+// Seed adds users exactly as they are given, such as the fixtures of a test.
+func (m *Memory) Seed(users []User) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range users {
+		m.byEmail[u.Email] = u
+	}
+}
+
+// Create adds a new user.
+func (m *Memory) Create(ctx context.Context, n NewUser, now time.Time) (*User, error) {
+	u, err := newUser(n, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.byEmail[u.Email]; ok {
+		return nil, errors.Errorf("inserting user: email %q is already in use", u.Email)
+	}
+	m.byEmail[u.Email] = u
+
+	return &u, nil
+}
+
+// Authenticate finds a user by their email and verifies their password. On
+// success it returns a Claims value representing this user.
+func (m *Memory) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
+	m.mu.Lock()
+	u, ok := m.byEmail[email]
+	m.mu.Unlock()
+
+	if !ok {
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+	return checkPassword(u, now, password)
+}
@@ -19,30 +19,40 @@ var (
 	ErrAuthenticationFailure = errors.New("Authentication failed")
 )
 
+// Store keeps users and checks their credentials.
+type Store interface {
+
+	// Create adds a new user.
+	Create(ctx context.Context, n NewUser, now time.Time) (*User, error)
+
+	// Authenticate finds a user by their email and verifies their password.
+	Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error)
+}
+
+// Postgres is a Store keeping users in a PostgreSQL database.
+type Postgres struct {
+	db *sqlx.DB
+}
+
+// NewPostgres constructs a Store using db.
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
 // Create inserts a new user into the database.
-func Create(ctx context.Context, db *sqlx.DB, n NewUser, now time.Time) (*User, error) {
+func (pg *Postgres) Create(ctx context.Context, n NewUser, now time.Time) (*User, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "internal.user.create")
 	defer span.End()
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(n.Password), bcrypt.DefaultCost)
+	u, err := newUser(n, now)
 	if err != nil {
-		return nil, errors.Wrap(err, "generating password hash")
-	}
-
-	u := User{
-		ID:           uuid.New().String(),
-		Name:         n.Name,
-		Email:        n.Email,
-		PasswordHash: hash,
-		Roles:        n.Roles,
-		DateCreated:  now.UTC(),
-		DateUpdated:  now.UTC(),
+		return nil, err
 	}
 
 	const q = `INSERT INTO users
 		(user_id, name, email, password_hash, roles, date_created, date_updated)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err = db.ExecContext(
+	_, err = pg.db.ExecContext(
 		ctx, q,
 		u.ID, u.Name, u.Email,
 		u.PasswordHash, u.Roles,
@@ -55,17 +65,36 @@ func Create(ctx context.Context, db *sqlx.DB, n NewUser, now time.Time) (*User,
 	return &u, nil
 }
 
+// newUser builds the User described by n with a hash of their password.
+func newUser(n NewUser, now time.Time) (User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(n.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, errors.Wrap(err, "generating password hash")
+	}
+
+	u := User{
+		ID:           uuid.New().String(),
+		Name:         n.Name,
+		Email:        n.Email,
+		PasswordHash: hash,
+		Roles:        n.Roles,
+		DateCreated:  now.UTC(),
+		DateUpdated:  now.UTC(),
+	}
+	return u, nil
+}
+
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns a Claims value representing this user. The claims can be
 // used to generate a token for future authentication.
-func Authenticate(ctx context.Context, db *sqlx.DB, now time.Time, email, password string) (auth.Claims, error) {
+func (pg *Postgres) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
 	ctx, span := global.Tracer("service").Start(ctx, "user.authenticate")
 	defer span.End()
 
 	const q = `SELECT * FROM users WHERE email = $1`
 
 	var u User
-	if err := db.GetContext(ctx, &u, q, email); err != nil {
+	if err := pg.db.GetContext(ctx, &u, q, email); err != nil {
 
 		// Normally we would return ErrNotFound in this scenario but we do not want
 		// to leak to an unauthenticated user which emails are in the system.
@@ -76,6 +105,13 @@ func Authenticate(ctx context.Context, db *sqlx.DB, now time.Time, email, passwo
 		return auth.Claims{}, errors.Wrap(err, "selecting single user")
 	}
 
+	return checkPassword(u, now, password)
+}
+
+// checkPassword verifies the password given for u and returns the claims of
+// u when it is right.
+func checkPassword(u User, now time.Time, password string) (auth.Claims, error) {
+
 	// Compare the provided password with the saved hash. Use the bcrypt
 	// comparison function so it is cryptographically secure.
 	if err := bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)); err != nil {
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE products
+	DROP COLUMN version;
+END;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE products
+	ADD COLUMN version INT NOT NULL DEFAULT 1;
+END;
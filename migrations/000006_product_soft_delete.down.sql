@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE products
+	DROP COLUMN deleted_at,
+	DROP COLUMN deleted_by;
+END;
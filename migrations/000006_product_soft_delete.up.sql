@@ -0,0 +1,5 @@
+BEGIN;
+ALTER TABLE products
+	ADD COLUMN deleted_at TIMESTAMP,
+	ADD COLUMN deleted_by UUID;
+END;
@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE products
+	DROP CONSTRAINT products_quantity_check;
+END;
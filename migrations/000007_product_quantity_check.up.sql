@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE products
+	ADD CONSTRAINT products_quantity_check CHECK (quantity >= 0);
+END;
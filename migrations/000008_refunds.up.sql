@@ -0,0 +1,17 @@
+BEGIN;
+CREATE TABLE refunds (
+	refund_id    UUID,
+	sale_id      UUID,
+	product_id   UUID,
+	quantity     INT,
+	amount       INT,
+	reason       TEXT,
+	void         BOOLEAN NOT NULL DEFAULT false,
+	user_id      UUID,
+	date_created TIMESTAMP,
+	PRIMARY KEY (refund_id),
+	FOREIGN KEY (sale_id) REFERENCES sales(sale_id) ON DELETE CASCADE
+);
+CREATE INDEX refunds_sale_id_idx ON refunds (sale_id);
+CREATE INDEX refunds_product_id_idx ON refunds (product_id);
+END;
@@ -0,0 +1,6 @@
+BEGIN;
+ALTER TABLE products
+	DROP COLUMN category_id,
+	DROP COLUMN tags;
+DROP TABLE categories;
+END;
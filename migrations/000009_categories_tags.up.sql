@@ -0,0 +1,18 @@
+BEGIN;
+CREATE TABLE categories (
+	category_id  UUID,
+	parent_id    UUID,
+	name         TEXT,
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+	PRIMARY KEY (category_id),
+	FOREIGN KEY (parent_id) REFERENCES categories(category_id)
+);
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+
+ALTER TABLE products
+	ADD COLUMN category_id UUID REFERENCES categories(category_id) ON DELETE SET NULL,
+	ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX products_category_id_idx ON products (category_id);
+CREATE INDEX products_tags_idx ON products USING GIN (tags);
+END;
@@ -0,0 +1,6 @@
+BEGIN;
+DROP INDEX products_search_idx;
+ALTER TABLE products
+	DROP COLUMN search,
+	DROP COLUMN description;
+END;
@@ -0,0 +1,9 @@
+BEGIN;
+ALTER TABLE products
+	ADD COLUMN description TEXT NOT NULL DEFAULT '',
+	ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+		setweight(to_tsvector('english', description), 'B')
+	) STORED;
+CREATE INDEX products_search_idx ON products USING GIN (search);
+END;
@@ -0,0 +1,3 @@
+BEGIN;
+DROP TABLE product_history;
+END;
@@ -0,0 +1,14 @@
+BEGIN;
+CREATE TABLE product_history (
+	change_id    UUID,
+	product_id   UUID,
+	field        TEXT,
+	old_value    TEXT,
+	new_value    TEXT,
+	changed_by   UUID,
+	date_changed TIMESTAMP,
+	PRIMARY KEY (change_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+CREATE INDEX product_history_product_id_idx ON product_history (product_id, field, date_changed);
+END;
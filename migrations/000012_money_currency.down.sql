@@ -0,0 +1,9 @@
+BEGIN;
+UPDATE product_history SET
+	old_value = split_part(old_value, ' ', 1),
+	new_value = split_part(new_value, ' ', 1)
+	WHERE field = 'cost';
+ALTER TABLE refunds DROP COLUMN currency;
+ALTER TABLE sales DROP COLUMN currency;
+ALTER TABLE products DROP COLUMN currency;
+END;
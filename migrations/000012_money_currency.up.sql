@@ -0,0 +1,9 @@
+BEGIN;
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+ALTER TABLE sales ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+ALTER TABLE refunds ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+UPDATE product_history SET
+	old_value = old_value || ' INR',
+	new_value = new_value || ' INR'
+	WHERE field = 'cost';
+END;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP INDEX sales_user_id_idx;
+ALTER TABLE sales DROP COLUMN user_id;
+END;
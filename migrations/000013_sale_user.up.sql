@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE sales ADD COLUMN user_id UUID;
+CREATE INDEX sales_user_id_idx ON sales (user_id, date_created);
+END;
@@ -0,0 +1,3 @@
+BEGIN;
+DROP INDEX sales_product_id_date_created_idx;
+END;
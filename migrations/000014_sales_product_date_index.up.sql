@@ -0,0 +1,3 @@
+BEGIN;
+CREATE INDEX sales_product_id_date_created_idx ON sales (product_id, date_created, sale_id);
+END;
@@ -0,0 +1,5 @@
+BEGIN;
+DROP INDEX sales_order_id_idx;
+ALTER TABLE sales DROP COLUMN order_id;
+DROP TABLE orders;
+END;
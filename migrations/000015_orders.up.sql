@@ -0,0 +1,10 @@
+BEGIN;
+CREATE TABLE orders (
+	order_id     UUID,
+	user_id      UUID,
+	date_created TIMESTAMP,
+	PRIMARY KEY (order_id)
+);
+ALTER TABLE sales ADD COLUMN order_id UUID REFERENCES orders(order_id);
+CREATE INDEX sales_order_id_idx ON sales (order_id);
+END;
@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE sales
+	DROP COLUMN expected,
+	DROP COLUMN discount,
+	DROP COLUMN promotion_id;
+DROP TABLE promotions;
+END;
@@ -0,0 +1,24 @@
+BEGIN;
+CREATE TABLE promotions (
+	promotion_id    UUID,
+	code            TEXT NOT NULL,
+	kind            TEXT NOT NULL CHECK (kind IN ('percent', 'fixed')),
+	value           INT NOT NULL,
+	currency        TEXT,
+	starts_at       TIMESTAMP,
+	ends_at         TIMESTAMP,
+	max_redemptions INT,
+	redemptions     INT NOT NULL DEFAULT 0,
+	product_ids     UUID[] NOT NULL DEFAULT '{}',
+	category_ids    UUID[] NOT NULL DEFAULT '{}',
+	date_created    TIMESTAMP,
+	PRIMARY KEY (promotion_id),
+	CHECK (max_redemptions IS NULL OR redemptions <= max_redemptions)
+);
+CREATE UNIQUE INDEX promotions_code_idx ON promotions (code);
+
+ALTER TABLE sales
+	ADD COLUMN promotion_id UUID REFERENCES promotions(promotion_id),
+	ADD COLUMN discount INT NOT NULL DEFAULT 0,
+	ADD COLUMN expected INT;
+END;
@@ -0,0 +1,6 @@
+BEGIN;
+DROP TABLE stock_alerts;
+ALTER TABLE products
+	DROP COLUMN low_stock_alerted,
+	DROP COLUMN reorder_threshold;
+END;
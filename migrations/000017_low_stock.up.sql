@@ -0,0 +1,17 @@
+BEGIN;
+ALTER TABLE products
+	ADD COLUMN reorder_threshold INT NOT NULL DEFAULT 0 CHECK (reorder_threshold >= 0),
+	ADD COLUMN low_stock_alerted BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE stock_alerts (
+	alert_id       UUID,
+	product_id     UUID,
+	quantity       INT,
+	threshold      INT,
+	date_created   TIMESTAMP,
+	date_delivered TIMESTAMP,
+	PRIMARY KEY (alert_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+CREATE INDEX stock_alerts_pending_idx ON stock_alerts (date_created) WHERE date_delivered IS NULL;
+END;
@@ -0,0 +1,16 @@
+BEGIN;
+CREATE TABLE attachments (
+	attachment_id UUID,
+	product_id    UUID,
+	kind          TEXT NOT NULL CHECK (kind IN ('image', 'document')),
+	filename      TEXT NOT NULL,
+	content_type  TEXT NOT NULL,
+	size          BIGINT NOT NULL,
+	has_thumbnail BOOLEAN NOT NULL DEFAULT false,
+	user_id       UUID,
+	date_created  TIMESTAMP,
+	PRIMARY KEY (attachment_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+CREATE INDEX attachments_product_id_idx ON attachments (product_id, date_created);
+END;
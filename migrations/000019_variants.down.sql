@@ -0,0 +1,4 @@
+BEGIN;
+ALTER TABLE sales DROP COLUMN variant_id;
+DROP TABLE variants;
+END;
@@ -0,0 +1,21 @@
+BEGIN;
+CREATE TABLE variants (
+	variant_id   UUID,
+	product_id   UUID NOT NULL,
+	sku          TEXT NOT NULL,
+	attributes   JSONB NOT NULL DEFAULT '{}',
+	cost         INT NOT NULL,
+	currency     TEXT NOT NULL,
+	quantity     INT NOT NULL CHECK (quantity >= 0),
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+	PRIMARY KEY (variant_id),
+	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+);
+-- text_pattern_ops lets the same index serve SKU prefix searches.
+CREATE UNIQUE INDEX variants_sku_idx ON variants (sku text_pattern_ops);
+CREATE INDEX variants_product_id_idx ON variants (product_id);
+
+ALTER TABLE sales ADD COLUMN variant_id UUID REFERENCES variants(variant_id);
+CREATE INDEX sales_variant_id_idx ON sales (variant_id);
+END;
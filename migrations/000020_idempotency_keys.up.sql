@@ -0,0 +1,13 @@
+BEGIN;
+-- A NULL status marks a key reserved by a request that has not finished.
+CREATE TABLE idempotency_keys (
+	key          TEXT,
+	request_hash TEXT NOT NULL,
+	status       INT,
+	content_type TEXT,
+	body         BYTEA,
+	expires_at   TIMESTAMP NOT NULL,
+	PRIMARY KEY (key)
+);
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+END;
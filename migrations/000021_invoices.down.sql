@@ -0,0 +1,5 @@
+BEGIN;
+DROP TABLE invoices;
+DROP FUNCTION invoices_immutable();
+DROP TABLE invoice_numbers;
+END;
@@ -0,0 +1,35 @@
+BEGIN;
+-- A single row holding the last invoice number issued. Numbers are taken by
+-- updating it in the transaction that inserts the invoice, so a rolled back
+-- invoice gives its number back and the sequence has no gaps.
+CREATE TABLE invoice_numbers (
+	id          BOOLEAN DEFAULT TRUE CHECK (id),
+	last_number BIGINT NOT NULL,
+	PRIMARY KEY (id)
+);
+INSERT INTO invoice_numbers (id, last_number) VALUES (TRUE, 0);
+
+-- Sales and orders are not foreign keys so that purging a product leaves its
+-- invoices, which hold everything they say in the snapshot.
+CREATE TABLE invoices (
+	invoice_id   UUID,
+	number       BIGINT NOT NULL UNIQUE,
+	sale_id      UUID UNIQUE,
+	order_id     UUID UNIQUE,
+	user_id      UUID,
+	snapshot     JSONB NOT NULL,
+	date_created TIMESTAMP,
+	PRIMARY KEY (invoice_id),
+	CHECK ((sale_id IS NULL) <> (order_id IS NULL))
+);
+
+-- Issued invoices are never changed or removed.
+CREATE FUNCTION invoices_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'invoice % cannot be changed', OLD.number;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER invoices_immutable BEFORE UPDATE OR DELETE ON invoices
+	FOR EACH ROW EXECUTE FUNCTION invoices_immutable();
+END;
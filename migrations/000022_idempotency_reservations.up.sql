@@ -0,0 +1,5 @@
+BEGIN;
+-- Each reservation is tagged so only the request holding it can complete or
+-- release it, even once it has timed out and been taken over.
+ALTER TABLE idempotency_keys ADD COLUMN reservation TEXT;
+END;
@@ -0,0 +1,3 @@
+BEGIN;
+ALTER TABLE sales DROP COLUMN line;
+END;
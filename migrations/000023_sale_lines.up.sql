@@ -0,0 +1,6 @@
+BEGIN;
+-- Sales made as part of an order remember their place in it so the order
+-- reads back as it was placed. Other sales, and those of orders placed before
+-- lines were numbered, are line 0.
+ALTER TABLE sales ADD COLUMN line INT NOT NULL DEFAULT 0;
+END;